@@ -1,7 +1,27 @@
 package main
 
-import "github.com/v7ktory/wb_task_one/internal/app"
+import (
+	"os"
+
+	"github.com/v7ktory/wb_task_one/internal/app"
+)
 
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "import":
+			app.Import(os.Args[2:])
+			return
+		case "publish":
+			app.Publish(os.Args[2:])
+			return
+		case "migrate":
+			app.Migrate(os.Args[2:])
+			return
+		case "retention":
+			app.Retention(os.Args[2:])
+			return
+		}
+	}
 	app.Run()
 }
@@ -18,6 +18,7 @@ import (
 	httpserver "github.com/v7ktory/wb_task_one/internal/http_server"
 	"github.com/v7ktory/wb_task_one/internal/repo/cache"
 	"github.com/v7ktory/wb_task_one/internal/repo/pgdb"
+	"github.com/v7ktory/wb_task_one/internal/usecase"
 	"github.com/v7ktory/wb_task_one/pkg/logger"
 	natsclient "github.com/v7ktory/wb_task_one/pkg/nats_client"
 	"github.com/v7ktory/wb_task_one/pkg/postgres"
@@ -32,6 +33,10 @@ func Run() {
 
 	logger := logger.NewLogger(slog.LevelDebug)
 
+	// A signal during startup, e.g. in a long cache warmup, aborts it
+	startCtx, stopStartup := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stopStartup()
+
 	// Postgres
 	logger.Info("Initializing postgres...")
 	pg, err := postgres.New(cfg.PG.URL, postgres.MaxPoolSize(cfg.PG.MaxPoolSize), postgres.ConnAttempts(cfg.PG.ConnAttempts), postgres.ConnTimeout(cfg.PG.ConnTimeout))
@@ -40,20 +45,63 @@ func Run() {
 	}
 	defer pg.Close()
 
+	// Migrations
+	logger.Info("Checking migrations...")
+	if err := migrateOnStart(startCtx, pg, cfg.PG.MigrateOnStart, logger); err != nil {
+		log.Fatal(fmt.Errorf("app - Run - migrateOnStart: %w", err))
+	}
+
 	// PgRepo
 	logger.Info("Initializing pgRepo...")
 	pgRepo := pgdb.NewPgRepo(pg)
 
+	// Archive of the orders removed by the retention job
+	orderArchive, err := newArchive(cfg.Retention, pg)
+	if err != nil {
+		log.Fatal(fmt.Errorf("app - Run - newArchive: %w", err))
+	}
+
 	// CacheRepo
 	logger.Info("Initializing cacheRepo...")
-	cacheRepo := cache.NewLRUCache[string, *entity.Order](1_073_741_824) // Cache capacity = 1GB
+	policy, err := cache.ParsePolicy(cfg.Cache.Policy)
+	if err != nil {
+		log.Fatal(fmt.Errorf("app - Run - cache.ParsePolicy: %w", err))
+	}
+	cacheRepo, err := cache.NewSharded(policy, cfg.Cache.Shards, cfg.Cache.Capacity,
+		cache.MaxBytes[string, *entity.Order](cfg.Cache.MaxBytes),
+		cache.SizeFunc(cache.OrderSize),
+		cache.TTL[string, *entity.Order](cfg.Cache.TTL),
+		cache.CleanupInterval[string, *entity.Order](cfg.Cache.CleanupInterval),
+	)
+	if err != nil {
+		log.Fatal(fmt.Errorf("app - Run - cache.NewSharded: %w", err))
+	}
+	defer cacheRepo.Close()
 
 	// Cache Warmup
-	logger.Info("Warming up cache...")
-	err = cache.Warmup(context.Background(), pgRepo, cacheRepo)
+	logger.Info("Loading cache snapshot...")
+	loaded, err := cache.LoadSnapshot(cfg.Cache.SnapshotPath, cfg.Cache.SnapshotMaxAge, cacheRepo)
 	if err != nil {
-		log.Fatal(fmt.Errorf("app - Run - cache.Warmup: %w", err))
+		logger.Warn("Cache snapshot is not usable", slog.Any("error", err.Error()))
+
+		logger.Info("Warming up cache...")
+		warmed, err := cache.Warmup(startCtx, pgRepo, cacheRepo, cache.OrderSize, cfg.Cache.WarmupPageSize, logger)
+		if err != nil {
+			log.Fatal(fmt.Errorf("app - Run - cache.Warmup: %w", err))
+		}
+		logger.Info("Cache warmed up from postgres", slog.Any("orders", warmed))
+	} else {
+		logger.Info("Cache snapshot loaded", slog.Any("orders", loaded))
 	}
+	stats := cacheRepo.Stats()
+	logger.Info("Cache warmed up", slog.Any("policy", stats.Policy), slog.Any("entries", stats.Entries), slog.Any("bytes", stats.Bytes), slog.Any("max_entries", stats.MaxEntries), slog.Any("max_bytes", stats.MaxBytes))
+
+	// Read-through cache
+	orderCache := cache.NewReadThrough(cacheRepo, cache.ArchivedOrderLoader(pgRepo, orderArchive),
+		cache.LoadTimeout[string, *entity.Order](cfg.Cache.LoadTimeout),
+		cache.NegativeTTL[string, *entity.Order](cfg.Cache.NegativeTTL),
+		cache.NegativeCapacity[string, *entity.Order](cfg.Cache.NegativeCapacity),
+	)
 
 	// NATS
 	logger.Info("Initializing NATS...")
@@ -74,7 +122,7 @@ func Run() {
 
 	// Publisher
 	logger.Info("Initializing publisher...")
-	pub := natsjs.NewPublisher(js, logger)
+	pub := natsjs.NewPublisher(js, cfg.NATS.Subject, cfg.NATS.DuplicateWindow, logger)
 
 	// Create NATS stream
 	logger.Info("Creating NATS stream...")
@@ -83,9 +131,46 @@ func Run() {
 		log.Fatal(fmt.Errorf("app - Run - sub.CreateStream: %w", err))
 	}
 
+	// Dead letter queue
+	logger.Info("Creating DLQ stream...")
+	deadLetters := natsjs.NewDeadLetterQueue(js, cfg.NATS.DLQStreamName, cfg.NATS.DLQSubject, logger)
+	_, err = deadLetters.CreateStream(ctx)
+	if err != nil {
+		log.Fatal(fmt.Errorf("app - Run - deadLetters.CreateStream: %w", err))
+	}
+
+	// Cache invalidation
+	logger.Info("Initializing cache invalidation...", slog.Any("instance_id", cfg.NATS.InstanceID))
+	invalidator := natsjs.NewInvalidator(n.Conn, cfg.NATS.InvalidationSubject, cfg.NATS.InstanceID, orderCache, logger)
+	go func() {
+		err := invalidator.Subscribe(ctx)
+		if err != nil {
+			log.Fatal(fmt.Errorf("app - Run - invalidator.Subscribe: %w", err))
+		}
+	}()
+
+	// Ingestion
+	writeMode, err := pgdb.ParseWriteMode(cfg.PG.WriteMode)
+	if err != nil {
+		log.Fatal(fmt.Errorf("app - Run - pgdb.ParseWriteMode: %w", err))
+	}
+	orderUseCase := usecase.NewOrderUseCase(pgRepo, writeMode, orderCache, invalidator, logger)
+
 	// Subscriber
 	logger.Info("Initializing subscriber...")
-	sub := natsjs.NewSubscriber(js, pgRepo, cacheRepo, logger)
+	sub := natsjs.NewSubscriber(js, orderUseCase, deadLetters, natsjs.RetryPolicy{
+		MaxDeliver: cfg.NATS.MaxDeliver,
+		BaseDelay:  cfg.NATS.RetryBaseDelay,
+		MaxDelay:   cfg.NATS.RetryMaxDelay,
+	}, natsjs.PoolConfig{
+		Workers:       cfg.NATS.Workers,
+		PartitionBy:   cfg.NATS.PartitionBy,
+		MaxAckPending: cfg.NATS.MaxAckPending,
+		FetchBatch:    cfg.NATS.FetchBatch,
+		FetchExpiry:   cfg.NATS.FetchExpiry,
+		SaveBatch:     cfg.NATS.SaveBatch,
+		FlushInterval: cfg.NATS.FlushInterval,
+	}, logger)
 
 	// Create NATS consumer
 	logger.Info("Creating NATS consumer...")
@@ -95,16 +180,36 @@ func Run() {
 	}
 
 	// Subscribe to NATS stream and consume incoming messages
+	subDone := make(chan struct{})
 	go func() {
-		err = sub.Subscribe(ctx, c)
+		defer close(subDone)
+		err := sub.Subscribe(ctx, c)
 		if err != nil {
 			log.Fatal(fmt.Errorf("app - Run - sub.Subscribe: %w", err))
 		}
 	}()
 
+	// Retention
+	retention := usecase.NewRetentionJob(pg, pgRepo, orderArchive, orderCache, invalidator, usecase.RetentionPolicy{
+		MaxIdle:   cfg.Retention.MaxIdle,
+		Interval:  cfg.Retention.Interval,
+		BatchSize: cfg.Retention.BatchSize,
+		DryRun:    cfg.Retention.DryRun,
+	}, logger)
+	go retention.Run(ctx)
+
+	// Access tracker
+	accesses := usecase.NewAccessTracker(pgRepo, cfg.Cache.AccessFlushInterval, cfg.Cache.AccessMaxPending, logger)
+	accessCtx, stopAccesses := context.WithCancel(context.Background())
+	accessesDone := make(chan struct{})
+	go func() {
+		accesses.Run(accessCtx)
+		close(accessesDone)
+	}()
+
 	// Handlers
 	mux := http.NewServeMux()
-	v1.AddRoutes(mux, cacheRepo, pgRepo, logger)
+	v1.AddRoutes(mux, orderCache, pgRepo, orderUseCase, accesses, deadLetters, logger)
 
 	// HTTP server
 	logger.Info("Starting http server...")
@@ -113,6 +218,7 @@ func Run() {
 
 	// Waiting signal
 	logger.Info("Configuring graceful shutdown...")
+	stopStartup()
 	interrupt := make(chan os.Signal, 1)
 	signal.Notify(interrupt, os.Interrupt, syscall.SIGTERM)
 
@@ -129,4 +235,21 @@ func Run() {
 	if err != nil {
 		logger.Error("app - Run - httpServer.Shutdown: ", slog.Any("error", err.Error()))
 	}
+
+	// Stop ingesting, so the snapshot holds the orders last saved
+	cancel()
+	<-subDone
+
+	// Save the accesses of the last requests
+	stopAccesses()
+	<-accessesDone
+
+	// Cache snapshot
+	logger.Info("Saving cache snapshot...")
+	saved, err := cache.SaveSnapshot(cfg.Cache.SnapshotPath, cacheRepo)
+	if err != nil {
+		logger.Error("app - Run - cache.SaveSnapshot: ", slog.Any("error", err.Error()))
+	} else {
+		logger.Info("Cache snapshot saved", slog.Any("orders", saved))
+	}
 }
@@ -0,0 +1,120 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/v7ktory/wb_task_one/internal/config"
+	natsjs "github.com/v7ktory/wb_task_one/internal/controller/nats_js"
+	"github.com/v7ktory/wb_task_one/internal/repo/pgdb"
+	"github.com/v7ktory/wb_task_one/internal/usecase"
+	"github.com/v7ktory/wb_task_one/pkg/logger"
+	natsclient "github.com/v7ktory/wb_task_one/pkg/nats_client"
+	"github.com/v7ktory/wb_task_one/pkg/postgres"
+)
+
+// Import saves the orders of newline-delimited JSON files, or of stdin for
+// "-", and prints the report of every file to stdout.
+//
+//	main import [-batch 500] orders.jsonl ...
+//
+// Every written order is announced on the cache invalidation subject, like
+// the orders written by a running instance, so the instances drop their
+// cached copy, or the negative cache entry of an order they didn't know,
+// and read the imported order from postgres on the next lookup.
+func Import(args []string) {
+	flags := flag.NewFlagSet("import", flag.ExitOnError)
+	batchSize := flags.Int("batch", usecase.DefaultImportBatchSize, "number of orders inserted per statement")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: main import [-batch n] file.jsonl ...")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() == 0 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	// Configuration
+	cfg, err := config.Load(".env")
+	if err != nil {
+		log.Fatalf("Config error: %s", err)
+	}
+
+	logger := logger.NewLogger(slog.LevelInfo)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Postgres
+	pg, err := postgres.New(cfg.PG.URL, postgres.MaxPoolSize(cfg.PG.MaxPoolSize), postgres.ConnAttempts(cfg.PG.ConnAttempts), postgres.ConnTimeout(cfg.PG.ConnTimeout))
+	if err != nil {
+		log.Fatal(fmt.Errorf("app - Import - postgres.New: %w", err))
+	}
+	defer pg.Close()
+
+	// NATS
+	n, err := natsclient.New(cfg.NATS.URL, natsclient.WithMaxReconnects(cfg.NATS.MaxReconnects), natsclient.WithReconnectWait(cfg.NATS.ReconnectWait), natsclient.WithConnTimeout(cfg.NATS.Timeout))
+	if err != nil {
+		log.Fatal(fmt.Errorf("app - Import - nats.New: %w", err))
+	}
+	defer n.Close()
+
+	// The import only publishes invalidations, it has no cache of its own
+	invalidator := natsjs.NewInvalidator(n.Conn, cfg.NATS.InvalidationSubject, cfg.NATS.InstanceID, nil, logger)
+
+	writeMode, err := pgdb.ParseWriteMode(cfg.PG.WriteMode)
+	if err != nil {
+		log.Fatal(fmt.Errorf("app - Import - pgdb.ParseWriteMode: %w", err))
+	}
+	orderUseCase := usecase.NewOrderUseCase(pgdb.NewPgRepo(pg), writeMode, nil, invalidator, logger)
+
+	failed := false
+	out := json.NewEncoder(os.Stdout)
+	out.SetIndent("", "  ")
+	for _, path := range flags.Args() {
+		report, err := importFile(ctx, orderUseCase, path, *batchSize)
+		if err != nil {
+			logger.Error("Import failed", slog.Any("file", path), slog.Any("error", err.Error()))
+			failed = true
+		}
+		out.Encode(struct {
+			File string `json:"file"`
+			usecase.ImportReport
+		}{path, report})
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	// Invalidations are buffered by the client, make sure they left
+	if err := n.Conn.Flush(); err != nil {
+		logger.Error("Failed to flush invalidations", slog.Any("error", err.Error()))
+		failed = true
+	}
+	if failed {
+		n.Close()
+		pg.Close()
+		os.Exit(1)
+	}
+}
+
+func importFile(ctx context.Context, orderUseCase *usecase.OrderUseCase, path string, batchSize int) (usecase.ImportReport, error) {
+	var r io.Reader = os.Stdin
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return usecase.ImportReport{}, err
+		}
+		defer f.Close()
+		r = f
+	}
+	return orderUseCase.Import(ctx, r, batchSize)
+}
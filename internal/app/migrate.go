@@ -0,0 +1,137 @@
+package app
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/v7ktory/wb_task_one/internal/config"
+	"github.com/v7ktory/wb_task_one/migrations"
+	"github.com/v7ktory/wb_task_one/pkg/logger"
+	"github.com/v7ktory/wb_task_one/pkg/postgres"
+)
+
+// Migrate applies or rolls back the migrations embedded in the binary, or
+// shows which are applied.
+//
+//	main migrate up|down|status
+func Migrate(args []string) {
+	flags := flag.NewFlagSet("migrate", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: main migrate up|down|status")
+	}
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	// Configuration
+	cfg, err := config.Load(".env")
+	if err != nil {
+		log.Fatalf("Config error: %s", err)
+	}
+
+	logger := logger.NewLogger(slog.LevelInfo)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Postgres
+	pg, err := postgres.New(cfg.PG.URL, postgres.MaxPoolSize(cfg.PG.MaxPoolSize), postgres.ConnAttempts(cfg.PG.ConnAttempts), postgres.ConnTimeout(cfg.PG.ConnTimeout))
+	if err != nil {
+		log.Fatal(fmt.Errorf("app - Migrate - postgres.New: %w", err))
+	}
+	defer pg.Close()
+
+	migrator, err := newMigrator(pg)
+	if err != nil {
+		log.Fatal(fmt.Errorf("app - Migrate - %w", err))
+	}
+
+	switch flags.Arg(0) {
+	case "up":
+		applied, err := migrator.Up(ctx)
+		for _, m := range applied {
+			logger.Info("Migration applied", slog.Any("version", m.Version), slog.Any("name", m.Name))
+		}
+		if err != nil {
+			log.Fatal(fmt.Errorf("app - Migrate - migrator.Up: %w", err))
+		}
+		if len(applied) == 0 {
+			logger.Info("No migrations to apply")
+		}
+	case "down":
+		m, err := migrator.Down(ctx)
+		if err != nil {
+			log.Fatal(fmt.Errorf("app - Migrate - migrator.Down: %w", err))
+		}
+		logger.Info("Migration rolled back", slog.Any("version", m.Version), slog.Any("name", m.Name))
+	case "status":
+		statuses, err := migrator.Status(ctx)
+		printStatus(statuses)
+		if err != nil {
+			log.Fatal(fmt.Errorf("app - Migrate - migrator.Status: %w", err))
+		}
+	default:
+		flags.Usage()
+		os.Exit(2)
+	}
+}
+
+func newMigrator(pg *postgres.Postgres) (*postgres.Migrator, error) {
+	list, err := postgres.LoadMigrations(migrations.FS)
+	if err != nil {
+		return nil, err
+	}
+	return postgres.NewMigrator(pg, list), nil
+}
+
+func printStatus(statuses []postgres.MigrationStatus) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED AT")
+	for _, s := range statuses {
+		appliedAt := "pending"
+		if s.Applied {
+			appliedAt = s.AppliedAt.Format(time.DateTime)
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\n", s.Version, s.Name, appliedAt)
+	}
+	w.Flush()
+}
+
+// migrateOnStart applies pending migrations, or only reports them when
+// applying is disabled. Either way it fails if the schema is ahead of the
+// binary, which would run queries against a schema it doesn't know.
+func migrateOnStart(ctx context.Context, pg *postgres.Postgres, apply bool, logger *slog.Logger) error {
+	migrator, err := newMigrator(pg)
+	if err != nil {
+		return err
+	}
+
+	if apply {
+		applied, err := migrator.Up(ctx)
+		for _, m := range applied {
+			logger.Info("Migration applied", slog.Any("version", m.Version), slog.Any("name", m.Name))
+		}
+		return err
+	}
+
+	statuses, err := migrator.Status(ctx)
+	if err != nil {
+		return err
+	}
+	for _, s := range statuses {
+		if !s.Applied {
+			logger.Warn("Migration pending", slog.Any("version", s.Version), slog.Any("name", s.Name))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,122 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/v7ktory/wb_task_one/internal/config"
+	natsjs "github.com/v7ktory/wb_task_one/internal/controller/nats_js"
+	"github.com/v7ktory/wb_task_one/internal/model"
+	"github.com/v7ktory/wb_task_one/pkg/logger"
+	natsclient "github.com/v7ktory/wb_task_one/pkg/nats_client"
+)
+
+// Publish sends the orders of JSON files, or of stdin for "-", to the order
+// stream. A file holds one order, like order.json, or a sequence of them,
+// like a JSONL file.
+//
+//	main publish order.json ...
+func Publish(args []string) {
+	flags := flag.NewFlagSet("publish", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: main publish file.json ...")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() == 0 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	// Configuration
+	cfg, err := config.Load(".env")
+	if err != nil {
+		log.Fatalf("Config error: %s", err)
+	}
+
+	logger := logger.NewLogger(slog.LevelInfo)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// NATS
+	n, err := natsclient.New(cfg.NATS.URL, natsclient.WithMaxReconnects(cfg.NATS.MaxReconnects), natsclient.WithReconnectWait(cfg.NATS.ReconnectWait), natsclient.WithConnTimeout(cfg.NATS.Timeout))
+	if err != nil {
+		log.Fatal(fmt.Errorf("app - Publish - nats.New: %w", err))
+	}
+	defer n.Close()
+
+	js, err := jetstream.New(n.Conn)
+	if err != nil {
+		log.Fatal(fmt.Errorf("app - Publish - jetstream.New: %w", err))
+	}
+	pub := natsjs.NewPublisher(js, cfg.NATS.Subject, cfg.NATS.DuplicateWindow, logger)
+
+	var published, duplicate, failed int
+	for _, path := range flags.Args() {
+		futures, err := publishFile(pub, path)
+		if err != nil {
+			logger.Error("Publish failed", slog.Any("file", path), slog.Any("error", err.Error()))
+			failed++
+		}
+		for _, future := range futures {
+			_, err := future.Wait(ctx)
+			switch {
+			case errors.Is(err, natsjs.ErrDuplicateOrder):
+				duplicate++
+			case err != nil:
+				logger.Error("Publish failed", slog.Any("file", path), slog.Any("error", err.Error()))
+				failed++
+			default:
+				published++
+			}
+		}
+	}
+
+	logger.Info("Orders published", slog.Any("published", published), slog.Any("duplicate", duplicate), slog.Any("failed", failed))
+	if failed > 0 {
+		n.Close()
+		os.Exit(1)
+	}
+}
+
+func publishFile(pub *natsjs.Publisher, path string) ([]*natsjs.PublishFuture, error) {
+	var r io.Reader = os.Stdin
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	var futures []*natsjs.PublishFuture
+	dec := json.NewDecoder(r)
+	for {
+		var order model.Order
+		err := dec.Decode(&order)
+		if errors.Is(err, io.EOF) {
+			return futures, nil
+		}
+		if err != nil {
+			return futures, fmt.Errorf("decode json: %w", err)
+		}
+
+		future, err := pub.PublishAsync(&order)
+		if err != nil {
+			return futures, err
+		}
+		futures = append(futures, future)
+	}
+}
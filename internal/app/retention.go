@@ -0,0 +1,91 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/v7ktory/wb_task_one/internal/config"
+	"github.com/v7ktory/wb_task_one/internal/repo/archive"
+	"github.com/v7ktory/wb_task_one/internal/repo/pgdb"
+	"github.com/v7ktory/wb_task_one/internal/usecase"
+	"github.com/v7ktory/wb_task_one/pkg/logger"
+	"github.com/v7ktory/wb_task_one/pkg/postgres"
+)
+
+// Retention archives the orders idle for longer than RETENTION_MAX_IDLE once
+// and prints the report to stdout.
+//
+//	main retention [-dry-run] [-max-idle 720h]
+//
+// Running instances drop archived orders from their caches when their copy
+// expires, and load them from the archive on the next read.
+func Retention(args []string) {
+	// Configuration
+	cfg, err := config.Load(".env")
+	if err != nil {
+		log.Fatalf("Config error: %s", err)
+	}
+
+	flags := flag.NewFlagSet("retention", flag.ExitOnError)
+	dryRun := flags.Bool("dry-run", cfg.Retention.DryRun, "only report the orders which would be archived")
+	maxIdle := flags.Duration("max-idle", cfg.Retention.MaxIdle, "archive orders not accessed for longer")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: main retention [-dry-run] [-max-idle 720h]")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if *maxIdle <= 0 {
+		fmt.Fprintln(flags.Output(), "Retention is disabled, set RETENTION_MAX_IDLE or -max-idle")
+		os.Exit(2)
+	}
+
+	logger := logger.NewLogger(slog.LevelInfo)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Postgres
+	pg, err := postgres.New(cfg.PG.URL, postgres.MaxPoolSize(cfg.PG.MaxPoolSize), postgres.ConnAttempts(cfg.PG.ConnAttempts), postgres.ConnTimeout(cfg.PG.ConnTimeout))
+	if err != nil {
+		log.Fatal(fmt.Errorf("app - Retention - postgres.New: %w", err))
+	}
+	defer pg.Close()
+
+	orderArchive, err := newArchive(cfg.Retention, pg)
+	if err != nil {
+		log.Fatal(fmt.Errorf("app - Retention - newArchive: %w", err))
+	}
+
+	job := usecase.NewRetentionJob(pg, pgdb.NewPgRepo(pg), orderArchive, nil, nil, usecase.RetentionPolicy{
+		MaxIdle:   *maxIdle,
+		BatchSize: cfg.Retention.BatchSize,
+		DryRun:    *dryRun,
+	}, logger)
+	report, err := job.RunOnce(ctx)
+
+	out := json.NewEncoder(os.Stdout)
+	out.SetIndent("", "  ")
+	out.Encode(report)
+	if err != nil {
+		logger.Error("Retention failed", slog.Any("error", err.Error()))
+		os.Exit(1)
+	}
+}
+
+// newArchive returns the archive of the configured target.
+func newArchive(cfg config.Retention, pg *postgres.Postgres) (pgdb.Archive, error) {
+	switch cfg.Target {
+	case "table":
+		return pgdb.NewArchiveRepo(pg), nil
+	case "file":
+		return archive.NewFileArchive(cfg.Dir)
+	}
+	return nil, fmt.Errorf("unknown retention target %q", cfg.Target)
+}
@@ -1,8 +1,10 @@
 package config
 
 import (
+	"fmt"
 	"log"
 	"os"
+	"strconv"
 	"time"
 
 	"github.com/joho/godotenv"
@@ -14,9 +16,9 @@ const (
 	writeTimeout = 5 * time.Second
 
 	// Postgres
-	maxPoolSize  = 1
 	connAttempts = 2
 	connTimeout  = time.Second
+	writeMode    = "strict" // what saving an existing order does: strict, idempotent, upsert_by_date or upsert_by_version
 
 	// NATS
 	maxReconnects = 3
@@ -25,13 +27,69 @@ const (
 	streamName    = "example-stream"
 	subject       = "example-subject"
 	consumerName  = "example-consumer-group-name"
+
+	// messages which can't be processed are moved to the DLQ stream
+	dlqStreamName = "example-stream-dlq"
+	dlqSubject    = "dlq.example-subject"
+
+	// failed messages are redelivered with exponential backoff, then moved to the DLQ
+	maxDeliver     = 10
+	retryBaseDelay = time.Second
+	retryMaxDelay  = 5 * time.Minute
+
+	// worker pool of the subscriber
+	workers       = 8
+	partitionBy   = "order_uid" // keep messages of an order in stream order
+	maxAckPending = 1000        // max messages delivered and not yet acked
+	fetchBatch    = 0           // positive to pull batches instead of consuming continuously
+	fetchExpiry   = 5 * time.Second
+	saveBatch     = 100                   // orders saved per statement
+	flushInterval = 50 * time.Millisecond // max wait for a save batch to fill
+
+	// orders with the same order_uid published within the window are stored once
+	duplicateWindow = 2 * time.Minute
+
+	// subject of the cache invalidation events exchanged by instances
+	invalidationSubject = "orders.invalidate"
+
+	// Cache
+	cachePolicy   = "lru"
+	cacheCapacity = 1_000_000 // max number of cached orders
+	cacheMaxBytes = 1 << 30   // max estimated size of cached orders, 1GB
+	cacheShards   = 16
+	cacheTTL      = 24 * time.Hour  // orders are reloaded from postgres at least once a day
+	cacheCleanup  = 5 * time.Minute // how often expired orders are swept
+
+	// Cache warmup
+	warmupPageSize = 10_000
+
+	// Cache snapshot
+	snapshotPath   = "./data/orders.snapshot"
+	snapshotMaxAge = time.Hour // older snapshots are ignored in favour of postgres
+
+	// Order access times are saved in batches
+	accessFlushInterval = 5 * time.Second
+	accessMaxPending    = 100_000 // orders waiting for the flush before an early one
+
+	// Retention
+	retentionTarget    = "table" // where archived orders go: table or file
+	retentionInterval  = time.Hour
+	retentionBatchSize = 1000 // orders archived per transaction
+	retentionDir       = "./data/archive"
+
+	// Cache read-through
+	loadTimeout      = 3 * time.Second
+	negativeTTL      = 30 * time.Second // how long unknown order uids are answered without a query
+	negativeCapacity = 100_000
 )
 
 type (
 	Config struct {
-		HTTP HTTP
-		PG   Postgres
-		NATS NATS
+		HTTP      HTTP
+		PG        Postgres
+		NATS      NATS
+		Cache     Cache
+		Retention Retention
 	}
 
 	HTTP struct {
@@ -44,6 +102,9 @@ type (
 		MaxPoolSize  int
 		ConnAttempts int
 		ConnTimeout  time.Duration
+		WriteMode    string
+		// MigrateOnStart applies the embedded migrations before serving
+		MigrateOnStart bool
 	}
 	NATS struct {
 		URL           string
@@ -51,12 +112,68 @@ type (
 		ReconnectWait time.Duration
 		Timeout       time.Duration
 
-		StreamName   string
-		Subject      string
-		ConsumerName string
+		StreamName      string
+		Subject         string
+		ConsumerName    string
+		DuplicateWindow time.Duration
+		DLQStreamName   string
+		DLQSubject      string
+		MaxDeliver      int
+		RetryBaseDelay  time.Duration
+		RetryMaxDelay   time.Duration
+		Workers         int
+		PartitionBy     string
+		MaxAckPending   int
+		FetchBatch      int
+		FetchExpiry     time.Duration
+		SaveBatch       int
+		FlushInterval   time.Duration
+
+		InvalidationSubject string
+		InstanceID          string
+	}
+	Cache struct {
+		Policy          string
+		Capacity        int
+		MaxBytes        int64
+		Shards          int
+		TTL             time.Duration
+		CleanupInterval time.Duration
+
+		WarmupPageSize int
+
+		SnapshotPath   string
+		SnapshotMaxAge time.Duration
+
+		LoadTimeout      time.Duration
+		NegativeTTL      time.Duration
+		NegativeCapacity int
+
+		AccessFlushInterval time.Duration
+		AccessMaxPending    int
+	}
+	Retention struct {
+		// MaxIdle archives orders not accessed for longer, zero disables
+		MaxIdle   time.Duration
+		Target    string
+		Interval  time.Duration
+		BatchSize int
+		// Dir of the file target, shared by all instances and the retention command
+		Dir    string
+		DryRun bool
 	}
 )
 
+// defaultInstanceID is unique per process on a host, and per container
+// since containers get their own hostname.
+func defaultInstanceID() string {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown"
+	}
+	return fmt.Sprintf("%s-%d", hostname, os.Getpid())
+}
+
 func Load(path string) (config Config, err error) {
 	err = godotenv.Load(path)
 	if err != nil {
@@ -69,9 +186,25 @@ func Load(path string) (config Config, err error) {
 
 	// Postgres
 	config.PG.URL = os.Getenv("PG_URL")
-	config.PG.MaxPoolSize = maxPoolSize
+	// Every subscriber worker may hold a connection while saving, the rest
+	// serve HTTP lookups, access time flushes and the retention job
+	config.PG.MaxPoolSize = workers + 2
+	if value := os.Getenv("PG_MAX_POOL_SIZE"); value != "" {
+		config.PG.MaxPoolSize, err = strconv.Atoi(value)
+		if err != nil {
+			return config, fmt.Errorf("PG_MAX_POOL_SIZE: %w", err)
+		}
+		if config.PG.MaxPoolSize <= 0 {
+			return config, fmt.Errorf("PG_MAX_POOL_SIZE: must be positive, got %d", config.PG.MaxPoolSize)
+		}
+	}
 	config.PG.ConnAttempts = connAttempts
 	config.PG.ConnTimeout = connTimeout
+	config.PG.WriteMode = os.Getenv("ORDER_WRITE_MODE")
+	if config.PG.WriteMode == "" {
+		config.PG.WriteMode = writeMode
+	}
+	config.PG.MigrateOnStart = os.Getenv("MIGRATE_ON_START") != "false"
 
 	// NATS
 	config.NATS.URL = os.Getenv("NATS_URL")
@@ -83,6 +216,72 @@ func Load(path string) (config Config, err error) {
 	config.NATS.StreamName = streamName
 	config.NATS.Subject = subject
 	config.NATS.ConsumerName = consumerName
+	config.NATS.DuplicateWindow = duplicateWindow
+	config.NATS.DLQStreamName = dlqStreamName
+	config.NATS.DLQSubject = dlqSubject
+	config.NATS.MaxDeliver = maxDeliver
+	config.NATS.RetryBaseDelay = retryBaseDelay
+	config.NATS.RetryMaxDelay = retryMaxDelay
+	config.NATS.Workers = workers
+	config.NATS.PartitionBy = partitionBy
+	config.NATS.MaxAckPending = maxAckPending
+	config.NATS.FetchBatch = fetchBatch
+	config.NATS.FetchExpiry = fetchExpiry
+	config.NATS.SaveBatch = saveBatch
+	config.NATS.FlushInterval = flushInterval
+
+	// Cache invalidation
+	config.NATS.InvalidationSubject = invalidationSubject
+	config.NATS.InstanceID = os.Getenv("INSTANCE_ID")
+	if config.NATS.InstanceID == "" {
+		config.NATS.InstanceID = defaultInstanceID()
+	}
+
+	// Cache
+	config.Cache.Policy = os.Getenv("CACHE_POLICY")
+	if config.Cache.Policy == "" {
+		config.Cache.Policy = cachePolicy
+	}
+	config.Cache.Capacity = cacheCapacity
+	config.Cache.MaxBytes = cacheMaxBytes
+	config.Cache.Shards = cacheShards
+	config.Cache.TTL = cacheTTL
+	config.Cache.CleanupInterval = cacheCleanup
+
+	// Cache warmup
+	config.Cache.WarmupPageSize = warmupPageSize
+
+	// Cache snapshot
+	config.Cache.SnapshotPath = snapshotPath
+	config.Cache.SnapshotMaxAge = snapshotMaxAge
+
+	// Cache read-through
+	config.Cache.LoadTimeout = loadTimeout
+	config.Cache.NegativeTTL = negativeTTL
+	config.Cache.NegativeCapacity = negativeCapacity
+
+	// Access tracking
+	config.Cache.AccessFlushInterval = accessFlushInterval
+	config.Cache.AccessMaxPending = accessMaxPending
+
+	// Retention
+	if value := os.Getenv("RETENTION_MAX_IDLE"); value != "" {
+		config.Retention.MaxIdle, err = time.ParseDuration(value)
+		if err != nil {
+			return config, fmt.Errorf("RETENTION_MAX_IDLE: %w", err)
+		}
+	}
+	config.Retention.Target = os.Getenv("RETENTION_TARGET")
+	if config.Retention.Target == "" {
+		config.Retention.Target = retentionTarget
+	}
+	config.Retention.Interval = retentionInterval
+	config.Retention.BatchSize = retentionBatchSize
+	config.Retention.Dir = os.Getenv("RETENTION_DIR")
+	if config.Retention.Dir == "" {
+		config.Retention.Dir = retentionDir
+	}
+	config.Retention.DryRun = os.Getenv("RETENTION_DRY_RUN") == "true"
 
 	return
 }
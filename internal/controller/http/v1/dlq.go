@@ -0,0 +1,156 @@
+package v1
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	natsjs "github.com/v7ktory/wb_task_one/internal/controller/nats_js"
+)
+
+type deadLetterQueue interface {
+	List(ctx context.Context, after uint64, limit int) ([]natsjs.DeadLetter, error)
+	Get(ctx context.Context, seq uint64) (*natsjs.DeadLetter, error)
+	Replay(ctx context.Context, seq uint64, data []byte) error
+	Delete(ctx context.Context, seq uint64) error
+}
+
+// dlqRouter is the admin API of the dead letter queue. Like the rest of the
+// API it has no authentication, so it must not be exposed publicly.
+type dlqRouter struct {
+	deadLetters deadLetterQueue
+	logger      *slog.Logger
+}
+
+func newDLQRouter(deadLetters deadLetterQueue, logger *slog.Logger) http.Handler {
+	d := &dlqRouter{
+		deadLetters: deadLetters,
+		logger:      logger,
+	}
+	mux := http.NewServeMux()
+	mux.Handle("GET /dlq", d.listHandler())
+	mux.Handle("GET /dlq/{seq}", d.getHandler())
+	mux.Handle("POST /dlq/{seq}/replay", d.replayHandler())
+	mux.Handle("DELETE /dlq/{seq}", d.deleteHandler())
+
+	return mux
+}
+
+type deadLetterPage struct {
+	DeadLetters []natsjs.DeadLetter `json:"dead_letters"`
+	// NextAfter is passed as the after parameter to get the next page
+	NextAfter uint64 `json:"next_after,omitempty"`
+}
+
+func (d *dlqRouter) listHandler() http.HandlerFunc {
+	const op = "http.dlq.go - listHandler"
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		problems := make(map[string]string)
+		var after uint64
+		if value := query.Get("after"); value != "" {
+			var err error
+			after, err = strconv.ParseUint(value, 10, 64)
+			if err != nil {
+				problems["after"] = "must be a sequence number"
+			}
+		}
+		limit := defaultListLimit
+		if value := query.Get("limit"); value != "" {
+			n, err := strconv.Atoi(value)
+			if err != nil || n <= 0 || n > maxListLimit {
+				problems["limit"] = "must be an integer between 1 and " + strconv.Itoa(maxListLimit)
+			}
+			limit = n
+		}
+		if len(problems) > 0 {
+			encode(w, http.StatusBadRequest, errorResponse{Error: "invalid query", Problems: problems})
+			return
+		}
+
+		letters, err := d.deadLetters.List(r.Context(), after, limit)
+		if err != nil {
+			d.logger.Error("Error listing dead letters", slog.Any("error", err.Error()), slog.Any("operation", op))
+			encode(w, http.StatusInternalServerError, errorResponse{Error: "error listing dead letters"})
+			return
+		}
+
+		page := deadLetterPage{DeadLetters: letters}
+		if len(letters) == limit {
+			page.NextAfter = letters[len(letters)-1].Sequence
+		}
+		encode(w, http.StatusOK, page)
+	}
+}
+
+func (d *dlqRouter) getHandler() http.HandlerFunc {
+	return d.withSeq("http.dlq.go - getHandler", func(w http.ResponseWriter, r *http.Request, seq uint64) error {
+		letter, err := d.deadLetters.Get(r.Context(), seq)
+		if err != nil {
+			return err
+		}
+		encode(w, http.StatusOK, letter)
+		return nil
+	})
+}
+
+// replayHandler publishes the dead letter to its subject again. A non-empty
+// request body replaces the original payload.
+func (d *dlqRouter) replayHandler() http.HandlerFunc {
+	return d.withSeq("http.dlq.go - replayHandler", func(w http.ResponseWriter, r *http.Request, seq uint64) error {
+		data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxOrderBodySize))
+		if err != nil {
+			encode(w, http.StatusBadRequest, errorResponse{Error: "error reading body: " + err.Error()})
+			return nil
+		}
+		if len(data) == 0 {
+			data = nil
+		}
+
+		if err := d.deadLetters.Replay(r.Context(), seq, data); err != nil {
+			return err
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	})
+}
+
+func (d *dlqRouter) deleteHandler() http.HandlerFunc {
+	return d.withSeq("http.dlq.go - deleteHandler", func(w http.ResponseWriter, r *http.Request, seq uint64) error {
+		if err := d.deadLetters.Delete(r.Context(), seq); err != nil {
+			return err
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	})
+}
+
+// withSeq parses the seq path value and turns the errors of handle into
+// responses.
+func (d *dlqRouter) withSeq(op string, handle func(w http.ResponseWriter, r *http.Request, seq uint64) error) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		seq, err := strconv.ParseUint(r.PathValue("seq"), 10, 64)
+		if err != nil {
+			encode(w, http.StatusBadRequest, errorResponse{Error: "invalid sequence number"})
+			return
+		}
+
+		err = handle(w, r, seq)
+		if errors.Is(err, natsjs.ErrDeadLetterNotFound) {
+			encode(w, http.StatusNotFound, errorResponse{Error: "dead letter not found"})
+			return
+		}
+		if errors.Is(err, natsjs.ErrReplayDuplicate) {
+			encode(w, http.StatusConflict, errorResponse{Error: "dead letter was replayed recently, retry later"})
+			return
+		}
+		if err != nil {
+			d.logger.Error("Error handling dead letter", slog.Any("error", err.Error()), slog.Any("seq", seq), slog.Any("operation", op))
+			encode(w, http.StatusInternalServerError, errorResponse{Error: "error handling dead letter"})
+		}
+	}
+}
@@ -1,12 +1,18 @@
 package v1
 
 import (
+	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/v7ktory/wb_task_one/internal/entity"
 	"github.com/v7ktory/wb_task_one/internal/model"
+	"github.com/v7ktory/wb_task_one/internal/repo/pgdb"
 )
 
 func encode[T any](w http.ResponseWriter, status int, v T) error {
@@ -18,6 +24,108 @@ func encode[T any](w http.ResponseWriter, status int, v T) error {
 	return nil
 }
 
+type errorResponse struct {
+	Error    string            `json:"error"`
+	Problems map[string]string `json:"problems,omitempty"`
+}
+
+// listCursor is the content of the opaque cursor handed out by the order
+// listing. It carries the sort, so a cursor can't be reused with another one.
+type listCursor struct {
+	Sort        pgdb.OrderSort `json:"s"`
+	DateCreated time.Time      `json:"d"`
+	UID         string         `json:"u"`
+}
+
+func encodeCursor(sort pgdb.OrderSort, cursor *pgdb.ListCursor) string {
+	if cursor == nil {
+		return ""
+	}
+	data, _ := json.Marshal(listCursor{Sort: sort, DateCreated: cursor.DateCreated, UID: cursor.UID})
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(sort pgdb.OrderSort, s string) (*pgdb.ListCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("decode base64: %w", err)
+	}
+	var cursor listCursor
+	if err := json.Unmarshal(data, &cursor); err != nil {
+		return nil, fmt.Errorf("decode json: %w", err)
+	}
+	if cursor.Sort != sort || cursor.UID == "" {
+		return nil, errors.New("cursor doesn't match the query")
+	}
+	return &pgdb.ListCursor{DateCreated: cursor.DateCreated, UID: cursor.UID}, nil
+}
+
+// prefersJSON reports whether the Accept header ranks application/json above
+// text/html. Wildcards, equal ranks and a missing header yield fallback.
+func prefersJSON(r *http.Request, fallback bool) bool {
+	accept := r.Header.Get("Accept")
+	if accept == "" {
+		return fallback
+	}
+
+	jsonQ, htmlQ := -1.0, -1.0
+	for mediaType, q := range acceptedTypes(accept) {
+		switch mediaType {
+		case "application/json":
+			jsonQ = max(jsonQ, q)
+		case "text/html":
+			htmlQ = max(htmlQ, q)
+		}
+	}
+
+	if jsonQ == htmlQ {
+		return fallback
+	}
+	return jsonQ > htmlQ
+}
+
+// acceptsOnlyHTML reports whether text/html is the only media type the
+// Accept header accepts. Browsers also accept */*, so they don't qualify.
+func acceptsOnlyHTML(r *http.Request) bool {
+	html := false
+	for mediaType, q := range acceptedTypes(r.Header.Get("Accept")) {
+		if q <= 0 {
+			continue
+		}
+		if mediaType != "text/html" {
+			return false
+		}
+		html = true
+	}
+	return html
+}
+
+// acceptedTypes yields the lower-cased media types of an Accept header
+// with their quality.
+func acceptedTypes(accept string) func(yield func(string, float64) bool) {
+	return func(yield func(string, float64) bool) {
+		if accept == "" {
+			return
+		}
+		for _, mediaRange := range strings.Split(accept, ",") {
+			mediaType, params, _ := strings.Cut(mediaRange, ";")
+			q := 1.0
+			for _, param := range strings.Split(params, ";") {
+				key, value, found := strings.Cut(strings.TrimSpace(param), "=")
+				if !found || strings.TrimSpace(key) != "q" {
+					continue
+				}
+				if parsed, err := strconv.ParseFloat(strings.TrimSpace(value), 64); err == nil {
+					q = parsed
+				}
+			}
+			if !yield(strings.ToLower(strings.TrimSpace(mediaType)), q) {
+				return
+			}
+		}
+	}
+}
+
 func ConvertOrder(order *entity.Order) model.Order {
 	delivery := model.DeliveryAttrs{
 		Name:    order.Delivery.Name,
@@ -71,5 +179,6 @@ func ConvertOrder(order *entity.Order) model.Order {
 		SmID:              order.SmID,
 		DateCreated:       order.DateCreated,
 		OffShard:          order.OffShard,
+		Version:           order.Version,
 	}
 }
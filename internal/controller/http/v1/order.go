@@ -1,31 +1,61 @@
 package v1
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"html/template"
 	"log/slog"
 	"net/http"
+	"net/url"
+	"strconv"
+	"time"
 
 	"github.com/v7ktory/wb_task_one/internal/entity"
+	"github.com/v7ktory/wb_task_one/internal/model"
 	"github.com/v7ktory/wb_task_one/internal/repo/cache"
 	"github.com/v7ktory/wb_task_one/internal/repo/pgdb"
+	"github.com/v7ktory/wb_task_one/internal/usecase"
+)
+
+const (
+	defaultListLimit = 50
+	maxListLimit     = 500
+
+	// an order is a few kilobytes, this leaves room for large item lists
+	maxOrderBodySize = 1 << 20
+
+	maxBulkBodySize = 512 << 20
+	// bulk imports outlive the server read and write timeouts
+	bulkTimeout = 10 * time.Minute
 )
 
 type orderRouter struct {
-	cache     cache.Cache[string, *entity.Order]
+	cache     *cache.ReadThrough[string, *entity.Order]
 	orderRepo pgdb.Order
+	orders    *usecase.OrderUseCase
+	accesses  *usecase.AccessTracker
 	logger    *slog.Logger
 }
 
-func newOrderRouter(cache cache.Cache[string, *entity.Order], orderRepo pgdb.Order, logger *slog.Logger) http.Handler {
+func newOrderRouter(cache *cache.ReadThrough[string, *entity.Order], orderRepo pgdb.Order, orders *usecase.OrderUseCase, accesses *usecase.AccessTracker, logger *slog.Logger) http.Handler {
 	o := &orderRouter{
 		cache:     cache,
 		orderRepo: orderRepo,
+		orders:    orders,
+		accesses:  accesses,
 		logger:    logger,
 	}
 	mux := http.NewServeMux()
 	mux.Handle("GET /order/", o.orderHomeHandler())
-	mux.Handle("GET /order/my/{uid}", o.getOrderHandler())
+	mux.Handle("GET /order/my/{uid}", o.getOrderHandler(false))
+	mux.Handle("GET /orders", o.listOrdersHandler())
+	mux.Handle("POST /orders", o.createOrderHandler())
+	mux.Handle("POST /orders:bulk", o.importOrdersHandler())
+	mux.Handle("GET /orders/{uid}", o.getOrderHandler(true))
 	mux.Handle("GET /order/health", o.checkHealthHandler())
+	mux.Handle("GET /order/cache/stats", o.cacheStatsHandler())
 
 	return mux
 }
@@ -48,14 +78,28 @@ func (o *orderRouter) orderHomeHandler() http.HandlerFunc {
 		}
 	}
 }
-func (o *orderRouter) getOrderHandler() http.HandlerFunc {
+
+// getOrderHandler serves an order as JSON or as the HTML page, depending on
+// the Accept header. The page route serves HTML unless JSON ranks higher,
+// the API route (api) serves JSON unless the client accepts nothing but HTML.
+func (o *orderRouter) getOrderHandler(api bool) http.HandlerFunc {
 	const op = "http.order.go - getOrderHandler"
 
 	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept")
+		asJSON := prefersJSON(r, false)
+		if api {
+			asJSON = !acceptsOnlyHTML(r)
+		}
+
 		uid := r.PathValue("uid")
-		order, ok := o.cache.Get(uid)
-		if !ok || order == nil {
+		order, err := o.lookupOrder(r.Context(), uid)
+		if errors.Is(err, cache.ErrNotFound) {
 			o.logger.Error("Order not found", slog.Any("uid", uid), slog.Any("operation", op))
+			if asJSON {
+				encode(w, http.StatusNotFound, errorResponse{Error: "order not found"})
+				return
+			}
 			tmpl, err := template.ParseFiles("./ui/templates/not_found.html")
 			if err != nil {
 				o.logger.Error("Error parsing template", slog.Any("error", err.Error()), slog.Any("operation", op))
@@ -65,11 +109,18 @@ func (o *orderRouter) getOrderHandler() http.HandlerFunc {
 			tmpl.Execute(w, nil)
 			return
 		}
-
-		err := o.orderRepo.UpdateOrderTime(r.Context(), uid)
 		if err != nil {
-			o.logger.Error("Error updating order time", slog.Any("error", err.Error()), slog.Any("operation", op))
-			encode(w, http.StatusInternalServerError, "Error updating order time")
+			o.logger.Error("Error loading order", slog.Any("error", err.Error()), slog.Any("operation", op))
+			if asJSON {
+				encode(w, http.StatusInternalServerError, errorResponse{Error: "error loading order"})
+				return
+			}
+			encode(w, http.StatusInternalServerError, "Error loading order")
+			return
+		}
+
+		if asJSON {
+			encode(w, http.StatusOK, ConvertOrder(order))
 			return
 		}
 
@@ -83,9 +134,213 @@ func (o *orderRouter) getOrderHandler() http.HandlerFunc {
 		tmpl.Execute(w, order)
 	}
 }
+
+// lookupOrder fetches the order through the cache and records the access,
+// which is saved later. It returns cache.ErrNotFound for unknown orders.
+func (o *orderRouter) lookupOrder(ctx context.Context, uid string) (*entity.Order, error) {
+	order, err := o.cache.Fetch(ctx, uid)
+	if err != nil {
+		return nil, err
+	}
+
+	o.accesses.Record(uid)
+	return order, nil
+}
+
+// createOrderHandler ingests an order the same way as the NATS subscriber.
+// Orders saved before are answered according to the write mode.
+func (o *orderRouter) createOrderHandler() http.HandlerFunc {
+	const op = "http.order.go - createOrderHandler"
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		var orderRequest model.Order
+		err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxOrderBodySize)).Decode(&orderRequest)
+		if err != nil {
+			encode(w, http.StatusBadRequest, errorResponse{Error: "invalid json: " + err.Error()})
+			return
+		}
+
+		result, err := o.orders.Ingest(r.Context(), orderRequest)
+		var validationErr *usecase.ValidationError
+		switch {
+		case errors.As(err, &validationErr):
+			encode(w, http.StatusUnprocessableEntity, errorResponse{Error: "invalid order", Problems: validationErr.Problems})
+			return
+		case errors.Is(err, pgdb.ErrAlreadyExists):
+			encode(w, http.StatusConflict, errorResponse{Error: "order already exists"})
+			return
+		case errors.Is(err, pgdb.ErrConflict):
+			encode(w, http.StatusConflict, errorResponse{Error: "order exists with a different content"})
+			return
+		case err != nil:
+			o.logger.Error("Error saving order", slog.Any("error", err.Error()), slog.Any("operation", op))
+			encode(w, http.StatusInternalServerError, errorResponse{Error: "error saving order"})
+			return
+		}
+
+		w.Header().Set("Location", "/api/v1/orders/"+url.PathEscape(orderRequest.UID))
+		switch result.Outcome {
+		case pgdb.OutcomeInserted:
+			encode(w, http.StatusCreated, orderRequest)
+		case pgdb.OutcomeStale:
+			encode(w, http.StatusConflict, errorResponse{Error: "a newer version of the order is saved"})
+		default:
+			encode(w, http.StatusOK, orderRequest)
+		}
+	}
+}
+
+// importOrdersHandler ingests newline-delimited JSON orders and reports the
+// outcome of every line. The batch query parameter sets the insert size.
+func (o *orderRouter) importOrdersHandler() http.HandlerFunc {
+	const op = "http.order.go - importOrdersHandler"
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		batchSize := usecase.DefaultImportBatchSize
+		if value := r.URL.Query().Get("batch"); value != "" {
+			n, err := strconv.Atoi(value)
+			if err != nil || n <= 0 {
+				encode(w, http.StatusBadRequest, errorResponse{Error: "invalid query", Problems: map[string]string{"batch": "must be a positive integer"}})
+				return
+			}
+			batchSize = n
+		}
+
+		rc := http.NewResponseController(w)
+		deadline := time.Now().Add(bulkTimeout)
+		rc.SetReadDeadline(deadline)
+		rc.SetWriteDeadline(deadline)
+
+		report, err := o.orders.Import(r.Context(), http.MaxBytesReader(w, r.Body, maxBulkBodySize), batchSize)
+		status := http.StatusInternalServerError
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			status = http.StatusRequestEntityTooLarge
+		}
+		if err != nil {
+			o.logger.Error("Error importing orders", slog.Any("error", err.Error()), slog.Any("operation", op))
+			// The lines saved before the failure are reported all the same
+			encode(w, status, struct {
+				errorResponse
+				usecase.ImportReport
+			}{errorResponse{Error: "error importing orders"}, report})
+			return
+		}
+
+		encode(w, http.StatusOK, report)
+	}
+}
+
+type orderPage struct {
+	Orders     []model.Order `json:"orders"`
+	NextCursor string        `json:"next_cursor,omitempty"`
+}
+
+// listOrdersHandler serves the orders matching the query parameters, a page
+// at a time. The next_cursor of a page is passed as the cursor parameter,
+// together with the same filters and sort, to get the next one.
+func (o *orderRouter) listOrdersHandler() http.HandlerFunc {
+	const op = "http.order.go - listOrdersHandler"
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		filter, sort, after, limit, problems := parseListQuery(r)
+		if len(problems) > 0 {
+			encode(w, http.StatusBadRequest, errorResponse{Error: "invalid query", Problems: problems})
+			return
+		}
+
+		orders, next, err := o.orderRepo.ListOrders(r.Context(), filter, sort, after, limit)
+		if err != nil {
+			o.logger.Error("Error listing orders", slog.Any("error", err.Error()), slog.Any("operation", op))
+			encode(w, http.StatusInternalServerError, errorResponse{Error: "error listing orders"})
+			return
+		}
+
+		page := orderPage{
+			Orders:     make([]model.Order, len(orders)),
+			NextCursor: encodeCursor(sort, next),
+		}
+		for i, order := range orders {
+			page.Orders[i] = ConvertOrder(order)
+		}
+		encode(w, http.StatusOK, page)
+	}
+}
+
+// parseListQuery reads the listing parameters. Problems maps the invalid
+// parameters to a description.
+func parseListQuery(r *http.Request) (pgdb.OrderFilter, pgdb.OrderSort, *pgdb.ListCursor, int, map[string]string) {
+	query := r.URL.Query()
+	problems := make(map[string]string)
+
+	filter := pgdb.OrderFilter{
+		CustomerID:      query.Get("customer_id"),
+		TrackNumber:     query.Get("track_number"),
+		DeliveryService: query.Get("delivery_service"),
+		Locale:          query.Get("locale"),
+		Currency:        query.Get("currency"),
+		Provider:        query.Get("provider"),
+		Brand:           query.Get("brand"),
+	}
+	parseTime := func(param string) time.Time {
+		value := query.Get(param)
+		if value == "" {
+			return time.Time{}
+		}
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			problems[param] = "must be an RFC 3339 timestamp"
+		}
+		return t
+	}
+	filter.CreatedFrom = parseTime("date_from")
+	filter.CreatedTo = parseTime("date_to")
+	if value := query.Get("nm_id"); value != "" {
+		nmID, err := strconv.Atoi(value)
+		if err != nil || nmID <= 0 {
+			problems["nm_id"] = "must be a positive integer"
+		}
+		filter.NmID = nmID
+	}
+
+	sort := pgdb.SortNewestFirst
+	switch value := pgdb.OrderSort(query.Get("sort")); value {
+	case "":
+	case pgdb.SortNewestFirst, pgdb.SortOldestFirst:
+		sort = value
+	default:
+		problems["sort"] = fmt.Sprintf("must be %s or %s", pgdb.SortNewestFirst, pgdb.SortOldestFirst)
+	}
+
+	limit := defaultListLimit
+	if value := query.Get("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n <= 0 || n > maxListLimit {
+			problems["limit"] = fmt.Sprintf("must be an integer between 1 and %d", maxListLimit)
+		}
+		limit = n
+	}
+
+	var after *pgdb.ListCursor
+	if value := query.Get("cursor"); value != "" {
+		var err error
+		after, err = decodeCursor(sort, value)
+		if err != nil {
+			problems["cursor"] = "is not a valid cursor for this query"
+		}
+	}
+
+	return filter, sort, after, limit, problems
+}
+
 func (o *orderRouter) checkHealthHandler() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		o.logger.Debug("healz")
 		encode(w, http.StatusOK, "OK")
 	}
 }
+func (o *orderRouter) cacheStatsHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		encode(w, http.StatusOK, o.cache.Stats())
+	}
+}
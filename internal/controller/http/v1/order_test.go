@@ -0,0 +1,487 @@
+package v1
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/mock"
+	"github.com/v7ktory/wb_task_one/internal/controller/mocks"
+	"github.com/v7ktory/wb_task_one/internal/entity"
+	"github.com/v7ktory/wb_task_one/internal/model"
+	"github.com/v7ktory/wb_task_one/internal/repo/cache"
+	"github.com/v7ktory/wb_task_one/internal/repo/pgdb"
+	"github.com/v7ktory/wb_task_one/internal/usecase"
+)
+
+// accessed matches the accesses passed to TouchOrders which include uid.
+func accessed(uid string) func(map[string]time.Time) bool {
+	return func(accesses map[string]time.Time) bool {
+		_, found := accesses[uid]
+		return found
+	}
+}
+
+func TestGetOrderHandler(t *testing.T) {
+	mockLogger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	order := &entity.Order{
+		UID:         "b563feb7b2b84b6test",
+		TrackNumber: "WBILMTESTTRACK",
+		Items:       []entity.ItemAttrs{{ChrtID: 9934930, Name: "Mascaras"}},
+	}
+
+	tests := []struct {
+		name      string
+		path      string
+		accept    string
+		mockSetup func(mockCache *mocks.Cache[string, *entity.Order], mockOrder *mocks.Order)
+		status    int
+		expected  any
+	}{
+		{
+			name: "Test cached order",
+			path: "/orders/b563feb7b2b84b6test",
+			mockSetup: func(mockCache *mocks.Cache[string, *entity.Order], mockOrder *mocks.Order) {
+				mockCache.On("Get", "b563feb7b2b84b6test").Return(order, true)
+				mockOrder.On("TouchOrders", mock.Anything, mock.MatchedBy(accessed("b563feb7b2b84b6test"))).Return(nil)
+			},
+			status:   http.StatusOK,
+			expected: ConvertOrder(order),
+		},
+		{
+			name: "Test order loaded from store",
+			path: "/orders/b563feb7b2b84b6test",
+			mockSetup: func(mockCache *mocks.Cache[string, *entity.Order], mockOrder *mocks.Order) {
+				mockCache.On("Get", "b563feb7b2b84b6test").Return((*entity.Order)(nil), false)
+				mockCache.On("PutIfAbsent", "b563feb7b2b84b6test", order).Return(true)
+				mockOrder.On("GetOrder", mock.Anything, "b563feb7b2b84b6test").Return(order, nil)
+				mockOrder.On("TouchOrders", mock.Anything, mock.MatchedBy(accessed("b563feb7b2b84b6test"))).Return(nil)
+			},
+			status:   http.StatusOK,
+			expected: ConvertOrder(order),
+		},
+		{
+			name: "Test unknown order",
+			path: "/orders/bogus",
+			mockSetup: func(mockCache *mocks.Cache[string, *entity.Order], mockOrder *mocks.Order) {
+				mockCache.On("Get", "bogus").Return((*entity.Order)(nil), false)
+				mockOrder.On("GetOrder", mock.Anything, "bogus").Return(nil, pgdb.ErrNotFound)
+			},
+			status:   http.StatusNotFound,
+			expected: errorResponse{Error: "order not found"},
+		},
+		{
+			name: "Test store error",
+			path: "/orders/b563feb7b2b84b6test",
+			mockSetup: func(mockCache *mocks.Cache[string, *entity.Order], mockOrder *mocks.Order) {
+				mockCache.On("Get", "b563feb7b2b84b6test").Return((*entity.Order)(nil), false)
+				mockOrder.On("GetOrder", mock.Anything, "b563feb7b2b84b6test").Return(nil, errors.New("connection refused"))
+			},
+			status:   http.StatusInternalServerError,
+			expected: errorResponse{Error: "error loading order"},
+		},
+		{
+			name:   "Test API route serves JSON to browsers",
+			path:   "/orders/bogus",
+			accept: "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8",
+			mockSetup: func(mockCache *mocks.Cache[string, *entity.Order], mockOrder *mocks.Order) {
+				mockCache.On("Get", "bogus").Return((*entity.Order)(nil), false)
+				mockOrder.On("GetOrder", mock.Anything, "bogus").Return(nil, pgdb.ErrNotFound)
+			},
+			status:   http.StatusNotFound,
+			expected: errorResponse{Error: "order not found"},
+		},
+		{
+			name:   "Test HTML route negotiates JSON",
+			path:   "/order/my/bogus",
+			accept: "application/json",
+			mockSetup: func(mockCache *mocks.Cache[string, *entity.Order], mockOrder *mocks.Order) {
+				mockCache.On("Get", "bogus").Return((*entity.Order)(nil), false)
+				mockOrder.On("GetOrder", mock.Anything, "bogus").Return(nil, pgdb.ErrNotFound)
+			},
+			status:   http.StatusNotFound,
+			expected: errorResponse{Error: "order not found"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockCache := mocks.NewCache[string, *entity.Order](t)
+			mockOrder := mocks.NewOrder(t)
+			tt.mockSetup(mockCache, mockOrder)
+			accesses := usecase.NewAccessTracker(mockOrder, 0, 0, mockLogger)
+			router := newOrderRouter(cache.NewReadThrough(mockCache, cache.OrderLoader(mockOrder)), mockOrder, nil, accesses, mockLogger)
+
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			if tt.accept != "" {
+				req.Header.Set("Accept", tt.accept)
+			}
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+			// Served orders are saved as accessed by the next flush
+			if err := accesses.Flush(context.Background()); err != nil {
+				t.Errorf("Expected flush err=%v, received=%v", nil, err)
+			}
+
+			if rec.Code != tt.status {
+				t.Errorf("Expected status=%v, received=%v", tt.status, rec.Code)
+			}
+			if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+				t.Errorf("Expected content type=%v, received=%v", "application/json", ct)
+			}
+
+			var received any
+			switch tt.expected.(type) {
+			case model.Order:
+				var body model.Order
+				err := json.NewDecoder(rec.Body).Decode(&body)
+				if err != nil {
+					t.Fatalf("decode body: %v", err)
+				}
+				received = body
+			case errorResponse:
+				var body errorResponse
+				err := json.NewDecoder(rec.Body).Decode(&body)
+				if err != nil {
+					t.Fatalf("decode body: %v", err)
+				}
+				received = body
+			}
+			if !reflect.DeepEqual(tt.expected, received) {
+				t.Errorf("Expected body=%v, received=%v", tt.expected, received)
+			}
+		})
+	}
+}
+
+func TestPrefersJSON(t *testing.T) {
+	tests := []struct {
+		accept   string
+		fallback bool
+		expected bool
+	}{
+		{accept: "", fallback: true, expected: true},
+		{accept: "*/*", fallback: false, expected: false},
+		{accept: "application/json", fallback: false, expected: true},
+		{accept: "text/html,application/xhtml+xml,*/*;q=0.8", fallback: true, expected: false},
+		{accept: "text/html;q=0.5, application/json", fallback: false, expected: true},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Accept", tt.accept)
+		if received := prefersJSON(req, tt.fallback); received != tt.expected {
+			t.Errorf("Accept %q: Expected json=%v, received=%v", tt.accept, tt.expected, received)
+		}
+	}
+}
+
+func TestAcceptsOnlyHTML(t *testing.T) {
+	tests := []struct {
+		accept   string
+		expected bool
+	}{
+		{accept: "", expected: false},
+		{accept: "text/html", expected: true},
+		{accept: "text/html, application/json;q=0", expected: true},
+		{accept: "text/html,application/xhtml+xml,*/*;q=0.8", expected: false},
+		{accept: "application/json", expected: false},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Accept", tt.accept)
+		if received := acceptsOnlyHTML(req); received != tt.expected {
+			t.Errorf("Accept %q: Expected html=%v, received=%v", tt.accept, tt.expected, received)
+		}
+	}
+}
+
+func TestListOrdersHandler(t *testing.T) {
+	mockLogger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	dateCreated := time.Date(2021, 11, 26, 6, 22, 19, 0, time.UTC)
+	order := &entity.Order{UID: "b563feb7b2b84b6test", CustomerID: "test", DateCreated: dateCreated}
+	cursor := &pgdb.ListCursor{DateCreated: dateCreated, UID: "b563feb7b2b84b6test"}
+
+	tests := []struct {
+		name      string
+		query     string
+		mockSetup func(mockOrder *mocks.Order)
+		status    int
+		orders    int
+		next      bool
+	}{
+		{
+			name:  "Test filters",
+			query: "?customer_id=test&currency=USD&nm_id=2389212&date_from=2021-11-01T00:00:00Z&limit=1",
+			mockSetup: func(mockOrder *mocks.Order) {
+				filter := pgdb.OrderFilter{
+					CustomerID:  "test",
+					Currency:    "USD",
+					NmID:        2389212,
+					CreatedFrom: time.Date(2021, 11, 1, 0, 0, 0, 0, time.UTC),
+				}
+				mockOrder.On("ListOrders", mock.Anything, filter, pgdb.SortNewestFirst, (*pgdb.ListCursor)(nil), 1).
+					Return([]*entity.Order{order}, cursor, nil)
+			},
+			status: http.StatusOK,
+			orders: 1,
+			next:   true,
+		},
+		{
+			name:  "Test next page",
+			query: "?sort=date_created&cursor=" + encodeCursor(pgdb.SortOldestFirst, cursor),
+			mockSetup: func(mockOrder *mocks.Order) {
+				mockOrder.On("ListOrders", mock.Anything, pgdb.OrderFilter{}, pgdb.SortOldestFirst, cursor, defaultListLimit).
+					Return([]*entity.Order{}, (*pgdb.ListCursor)(nil), nil)
+			},
+			status: http.StatusOK,
+		},
+		{
+			name:      "Test cursor of another sort",
+			query:     "?cursor=" + encodeCursor(pgdb.SortOldestFirst, cursor),
+			mockSetup: func(mockOrder *mocks.Order) {},
+			status:    http.StatusBadRequest,
+		},
+		{
+			name:      "Test invalid parameters",
+			query:     "?limit=100000&date_to=yesterday&sort=price",
+			mockSetup: func(mockOrder *mocks.Order) {},
+			status:    http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockCache := mocks.NewCache[string, *entity.Order](t)
+			mockOrder := mocks.NewOrder(t)
+			tt.mockSetup(mockOrder)
+			router := newOrderRouter(cache.NewReadThrough(mockCache, cache.OrderLoader(mockOrder)), mockOrder, nil, nil, mockLogger)
+
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/orders"+tt.query, nil))
+
+			if rec.Code != tt.status {
+				t.Errorf("Expected status=%v, received=%v", tt.status, rec.Code)
+			}
+			if rec.Code != http.StatusOK {
+				return
+			}
+			var page orderPage
+			err := json.NewDecoder(rec.Body).Decode(&page)
+			if err != nil {
+				t.Fatalf("decode body: %v", err)
+			}
+			if len(page.Orders) != tt.orders {
+				t.Errorf("Expected orders=%v, received=%v", tt.orders, len(page.Orders))
+			}
+			if (page.NextCursor != "") != tt.next {
+				t.Errorf("Expected next cursor=%v, received=%q", tt.next, page.NextCursor)
+			}
+		})
+	}
+}
+
+func TestCreateOrderHandler(t *testing.T) {
+	mockLogger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	validJSON := `{
+		"order_uid": "b563feb7b2b84b6test",
+		"track_number": "WBILMTESTTRACK",
+		"entry": "WBIL",
+		"delivery": {"name": "Test Testov", "phone": "+9720000000", "zip": "2639809", "city": "Kiryat Mozkin", "address": "Ploshad Mira 15", "region": "Kraiot", "email": "test@gmail.com"},
+		"payment": {"transaction": "b563feb7b2b84b6test", "currency": "USD", "provider": "wbpay", "amount": 1817},
+		"items": [{"chrt_id": 9934930, "track_number": "WBILMTESTTRACK", "price": 453, "name": "Mascaras", "nm_id": 2389212, "brand": "Vivienne Sabo"}],
+		"locale": "en",
+		"customer_id": "test",
+		"delivery_service": "meest",
+		"shardkey": "9",
+		"sm_id": 99,
+		"date_created": "2021-11-26T06:22:19Z",
+		"oof_shard": "1"
+	}`
+
+	tests := []struct {
+		name      string
+		body      string
+		mockSetup func(mockCache *mocks.Cache[string, *entity.Order], mockOrder *mocks.Order)
+		status    int
+		problems  bool
+	}{
+		{
+			name: "Test new order",
+			body: validJSON,
+			mockSetup: func(mockCache *mocks.Cache[string, *entity.Order], mockOrder *mocks.Order) {
+				mockOrder.On("SaveOrder", mock.Anything, mock.AnythingOfType("*entity.Order")).Return("b563feb7b2b84b6test", nil)
+				mockCache.On("Put", "b563feb7b2b84b6test", mock.AnythingOfType("*entity.Order")).Return()
+			},
+			status: http.StatusCreated,
+		},
+		{
+			name: "Test existing order",
+			body: validJSON,
+			mockSetup: func(mockCache *mocks.Cache[string, *entity.Order], mockOrder *mocks.Order) {
+				mockOrder.On("SaveOrder", mock.Anything, mock.AnythingOfType("*entity.Order")).Return("", pgdb.ErrAlreadyExists)
+			},
+			status: http.StatusConflict,
+		},
+		{
+			name:      "Test invalid order",
+			body:      `{"order_uid": "b563feb7b2b84b6test"}`,
+			mockSetup: func(mockCache *mocks.Cache[string, *entity.Order], mockOrder *mocks.Order) {},
+			status:    http.StatusUnprocessableEntity,
+			problems:  true,
+		},
+		{
+			name:      "Test invalid json",
+			body:      `Invalid message`,
+			mockSetup: func(mockCache *mocks.Cache[string, *entity.Order], mockOrder *mocks.Order) {},
+			status:    http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockCache := mocks.NewCache[string, *entity.Order](t)
+			mockOrder := mocks.NewOrder(t)
+			tt.mockSetup(mockCache, mockOrder)
+			orders := usecase.NewOrderUseCase(mockOrder, pgdb.WriteStrict, mockCache, nil, mockLogger)
+			router := newOrderRouter(cache.NewReadThrough(mockCache, cache.OrderLoader(mockOrder)), mockOrder, orders, nil, mockLogger)
+
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/orders", strings.NewReader(tt.body)))
+
+			if rec.Code != tt.status {
+				t.Errorf("Expected status=%v, received=%v", tt.status, rec.Code)
+			}
+			if rec.Code == http.StatusCreated {
+				if location := rec.Header().Get("Location"); location != "/api/v1/orders/b563feb7b2b84b6test" {
+					t.Errorf("Expected location=%v, received=%v", "/api/v1/orders/b563feb7b2b84b6test", location)
+				}
+				return
+			}
+			var body errorResponse
+			err := json.NewDecoder(rec.Body).Decode(&body)
+			if err != nil {
+				t.Fatalf("decode body: %v", err)
+			}
+			if (len(body.Problems) > 0) != tt.problems {
+				t.Errorf("Expected problems=%v, received=%v", tt.problems, body.Problems)
+			}
+		})
+	}
+}
+
+func TestImportOrdersHandler(t *testing.T) {
+	mockLogger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	line := func(uid string) string {
+		return `{"order_uid": "` + uid + `", "track_number": "WBILMTESTTRACK", "entry": "WBIL", ` +
+			`"delivery": {"name": "Test Testov", "phone": "+9720000000", "zip": "2639809", "city": "Kiryat Mozkin", "address": "Ploshad Mira 15", "region": "Kraiot", "email": "test@gmail.com"}, ` +
+			`"payment": {"transaction": "` + uid + `", "currency": "USD", "provider": "wbpay", "amount": 1817}, ` +
+			`"items": [{"chrt_id": 9934930, "track_number": "WBILMTESTTRACK", "price": 453, "name": "Mascaras", "nm_id": 2389212, "brand": "Vivienne Sabo"}], ` +
+			`"locale": "en", "customer_id": "test", "delivery_service": "meest", "shardkey": "9", "sm_id": 99, "date_created": "2021-11-26T06:22:19Z", "oof_shard": "1"}`
+	}
+	batchOf := func(uids ...string) any {
+		return mock.MatchedBy(func(orders []*entity.Order) bool {
+			if len(orders) != len(uids) {
+				return false
+			}
+			for i := range orders {
+				if orders[i].UID != uids[i] {
+					return false
+				}
+			}
+			return true
+		})
+	}
+
+	tests := []struct {
+		name      string
+		query     string
+		body      string
+		mockSetup func(mockCache *mocks.Cache[string, *entity.Order], mockOrder *mocks.Order)
+		status    int
+		expected  usecase.ImportReport
+		problems  bool
+	}{
+		{
+			name:  "Test mixed lines",
+			query: "?batch=1",
+			body:  strings.Join([]string{line("order1"), `Invalid message`, `{"order_uid": "order3"}`, "", line("order2")}, "\n"),
+			mockSetup: func(mockCache *mocks.Cache[string, *entity.Order], mockOrder *mocks.Order) {
+				mockOrder.On("SaveOrders", mock.Anything, batchOf("order1")).Return([]error{nil}, nil).Once()
+				mockOrder.On("SaveOrders", mock.Anything, batchOf("order2")).Return([]error{pgdb.ErrAlreadyExists}, nil).Once()
+				mockCache.On("Put", "order1", mock.AnythingOfType("*entity.Order")).Return().Once()
+			},
+			status:   http.StatusOK,
+			expected: usecase.ImportReport{Accepted: 1, Duplicate: 1, Invalid: 2},
+		},
+		{
+			name:  "Test batch param sets the insert size",
+			query: "?batch=2",
+			body:  strings.Join([]string{line("order1"), line("order2"), line("order3")}, "\n"),
+			mockSetup: func(mockCache *mocks.Cache[string, *entity.Order], mockOrder *mocks.Order) {
+				mockOrder.On("SaveOrders", mock.Anything, batchOf("order1", "order2")).Return([]error{nil, nil}, nil).Once()
+				mockOrder.On("SaveOrders", mock.Anything, batchOf("order3")).Return([]error{nil}, nil).Once()
+				mockCache.On("Put", mock.Anything, mock.AnythingOfType("*entity.Order")).Return().Times(3)
+			},
+			status:   http.StatusOK,
+			expected: usecase.ImportReport{Accepted: 3},
+		},
+		{
+			name:      "Test invalid batch param",
+			query:     "?batch=0",
+			body:      line("order1"),
+			mockSetup: func(mockCache *mocks.Cache[string, *entity.Order], mockOrder *mocks.Order) {},
+			status:    http.StatusBadRequest,
+			problems:  true,
+		},
+		{
+			name: "Test store error",
+			body: line("order1"),
+			mockSetup: func(mockCache *mocks.Cache[string, *entity.Order], mockOrder *mocks.Order) {
+				mockOrder.On("SaveOrders", mock.Anything, batchOf("order1")).Return(nil, errors.New("connection refused"))
+			},
+			status: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockCache := mocks.NewCache[string, *entity.Order](t)
+			mockOrder := mocks.NewOrder(t)
+			tt.mockSetup(mockCache, mockOrder)
+			orders := usecase.NewOrderUseCase(mockOrder, pgdb.WriteStrict, mockCache, nil, mockLogger)
+			router := newOrderRouter(cache.NewReadThrough(mockCache, cache.OrderLoader(mockOrder)), mockOrder, orders, nil, mockLogger)
+
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/orders:bulk"+tt.query, strings.NewReader(tt.body)))
+
+			if rec.Code != tt.status {
+				t.Errorf("Expected status=%v, received=%v", tt.status, rec.Code)
+			}
+			var body struct {
+				errorResponse
+				usecase.ImportReport
+			}
+			err := json.NewDecoder(rec.Body).Decode(&body)
+			if err != nil {
+				t.Fatalf("decode body: %v", err)
+			}
+			if (len(body.Problems) > 0) != tt.problems {
+				t.Errorf("Expected problems=%v, received=%v", tt.problems, body.Problems)
+			}
+			received := body.ImportReport
+			if received.Accepted != tt.expected.Accepted || received.Duplicate != tt.expected.Duplicate || received.Invalid != tt.expected.Invalid || received.Stale != tt.expected.Stale {
+				t.Errorf("Expected report=%+v, received=%+v", tt.expected, received)
+			}
+		})
+	}
+}
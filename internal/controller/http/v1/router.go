@@ -4,16 +4,19 @@ import (
 	"log/slog"
 	"net/http"
 
+	natsjs "github.com/v7ktory/wb_task_one/internal/controller/nats_js"
 	"github.com/v7ktory/wb_task_one/internal/entity"
 	"github.com/v7ktory/wb_task_one/internal/repo/cache"
 	"github.com/v7ktory/wb_task_one/internal/repo/pgdb"
+	"github.com/v7ktory/wb_task_one/internal/usecase"
 )
 
-func AddRoutes(mux *http.ServeMux, cache cache.Cache[string, *entity.Order], pgRepo *pgdb.PgRepo, logger *slog.Logger) {
+func AddRoutes(mux *http.ServeMux, cache *cache.ReadThrough[string, *entity.Order], pgRepo *pgdb.PgRepo, orders *usecase.OrderUseCase, accesses *usecase.AccessTracker, deadLetters *natsjs.DeadLetterQueue, logger *slog.Logger) {
 	// Handle Css files
 	fs := http.FileServer(http.Dir("./ui/static"))
 	mux.Handle("/static/", http.StripPrefix("/static/", fs))
 
 	// Handle API routes
-	mux.Handle("/api/v1/", http.StripPrefix("/api/v1", newOrderRouter(cache, pgRepo, logger)))
+	mux.Handle("/api/v1/", http.StripPrefix("/api/v1", newOrderRouter(cache, pgRepo, orders, accesses, logger)))
+	mux.Handle("/api/v1/admin/", http.StripPrefix("/api/v1/admin", newDLQRouter(deadLetters, logger)))
 }
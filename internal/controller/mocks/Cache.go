@@ -2,13 +2,41 @@
 
 package mocks
 
-import mock "github.com/stretchr/testify/mock"
+import (
+	mock "github.com/stretchr/testify/mock"
+	cache "github.com/v7ktory/wb_task_one/internal/repo/cache"
+
+	time "time"
+)
 
 // Cache is an autogenerated mock type for the Cache type
 type Cache[KeyT comparable, ValueT interface{}] struct {
 	mock.Mock
 }
 
+// Close provides a mock function with given fields:
+func (_m *Cache[KeyT, ValueT]) Close() {
+	_m.Called()
+}
+
+// Delete provides a mock function with given fields: key
+func (_m *Cache[KeyT, ValueT]) Delete(key KeyT) bool {
+	ret := _m.Called(key)
+
+	if len(ret) == 0 {
+		panic("no return value specified for Delete")
+	}
+
+	var r0 bool
+	if rf, ok := ret.Get(0).(func(KeyT) bool); ok {
+		r0 = rf(key)
+	} else {
+		r0 = ret.Get(0).(bool)
+	}
+
+	return r0
+}
+
 // Get provides a mock function with given fields: key
 func (_m *Cache[KeyT, ValueT]) Get(key KeyT) (ValueT, bool) {
 	ret := _m.Called(key)
@@ -37,11 +65,128 @@ func (_m *Cache[KeyT, ValueT]) Get(key KeyT) (ValueT, bool) {
 	return r0, r1
 }
 
+// Keys provides a mock function with given fields:
+func (_m *Cache[KeyT, ValueT]) Keys() []KeyT {
+	ret := _m.Called()
+
+	if len(ret) == 0 {
+		panic("no return value specified for Keys")
+	}
+
+	var r0 []KeyT
+	if rf, ok := ret.Get(0).(func() []KeyT); ok {
+		r0 = rf()
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]KeyT)
+		}
+	}
+
+	return r0
+}
+
+// Len provides a mock function with given fields:
+func (_m *Cache[KeyT, ValueT]) Len() int {
+	ret := _m.Called()
+
+	if len(ret) == 0 {
+		panic("no return value specified for Len")
+	}
+
+	var r0 int
+	if rf, ok := ret.Get(0).(func() int); ok {
+		r0 = rf()
+	} else {
+		r0 = ret.Get(0).(int)
+	}
+
+	return r0
+}
+
+// Peek provides a mock function with given fields: key
+func (_m *Cache[KeyT, ValueT]) Peek(key KeyT) (ValueT, bool) {
+	ret := _m.Called(key)
+
+	if len(ret) == 0 {
+		panic("no return value specified for Peek")
+	}
+
+	var r0 ValueT
+	var r1 bool
+	if rf, ok := ret.Get(0).(func(KeyT) (ValueT, bool)); ok {
+		return rf(key)
+	}
+	if rf, ok := ret.Get(0).(func(KeyT) ValueT); ok {
+		r0 = rf(key)
+	} else {
+		r0 = ret.Get(0).(ValueT)
+	}
+
+	if rf, ok := ret.Get(1).(func(KeyT) bool); ok {
+		r1 = rf(key)
+	} else {
+		r1 = ret.Get(1).(bool)
+	}
+
+	return r0, r1
+}
+
+// Purge provides a mock function with given fields:
+func (_m *Cache[KeyT, ValueT]) Purge() {
+	_m.Called()
+}
+
 // Put provides a mock function with given fields: key, value
 func (_m *Cache[KeyT, ValueT]) Put(key KeyT, value ValueT) {
 	_m.Called(key, value)
 }
 
+// PutIfAbsent provides a mock function with given fields: key, value
+func (_m *Cache[KeyT, ValueT]) PutIfAbsent(key KeyT, value ValueT) bool {
+	ret := _m.Called(key, value)
+
+	if len(ret) == 0 {
+		panic("no return value specified for PutIfAbsent")
+	}
+
+	var r0 bool
+	if rf, ok := ret.Get(0).(func(KeyT, ValueT) bool); ok {
+		r0 = rf(key, value)
+	} else {
+		r0 = ret.Get(0).(bool)
+	}
+
+	return r0
+}
+
+// PutWithTTL provides a mock function with given fields: key, value, ttl
+func (_m *Cache[KeyT, ValueT]) PutWithTTL(key KeyT, value ValueT, ttl time.Duration) {
+	_m.Called(key, value, ttl)
+}
+
+// Range provides a mock function with given fields: f
+func (_m *Cache[KeyT, ValueT]) Range(f func(KeyT, ValueT) bool) {
+	_m.Called(f)
+}
+
+// Stats provides a mock function with given fields:
+func (_m *Cache[KeyT, ValueT]) Stats() cache.Stats {
+	ret := _m.Called()
+
+	if len(ret) == 0 {
+		panic("no return value specified for Stats")
+	}
+
+	var r0 cache.Stats
+	if rf, ok := ret.Get(0).(func() cache.Stats); ok {
+		r0 = rf()
+	} else {
+		r0 = ret.Get(0).(cache.Stats)
+	}
+
+	return r0
+}
+
 // NewCache creates a new instance of Cache. It also registers a testing interface on the mock and a cleanup function to assert the mocks expectations.
 // The first argument is typically a *testing.T value.
 func NewCache[KeyT comparable, ValueT interface{}](t interface {
@@ -7,6 +7,10 @@ import (
 
 	mock "github.com/stretchr/testify/mock"
 	entity "github.com/v7ktory/wb_task_one/internal/entity"
+
+	pgdb "github.com/v7ktory/wb_task_one/internal/repo/pgdb"
+
+	time "time"
 )
 
 // Order is an autogenerated mock type for the Order type
@@ -14,29 +18,125 @@ type Order struct {
 	mock.Mock
 }
 
-// GetLRUOrders provides a mock function with given fields: ctx
-func (_m *Order) GetLRUOrders(ctx context.Context) ([]*entity.Order, error) {
-	ret := _m.Called(ctx)
+// DeleteOrders provides a mock function with given fields: ctx, uids
+func (_m *Order) DeleteOrders(ctx context.Context, uids []string) error {
+	ret := _m.Called(ctx, uids)
+
+	if len(ret) == 0 {
+		panic("no return value specified for DeleteOrders")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, []string) error); ok {
+		r0 = rf(ctx, uids)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// GetIdleOrders provides a mock function with given fields: ctx, before, after, limit
+func (_m *Order) GetIdleOrders(ctx context.Context, before time.Time, after *pgdb.LRUCursor, limit int) ([]*entity.Order, *pgdb.LRUCursor, error) {
+	ret := _m.Called(ctx, before, after, limit)
+
+	if len(ret) == 0 {
+		panic("no return value specified for GetIdleOrders")
+	}
+
+	var r0 []*entity.Order
+	var r1 *pgdb.LRUCursor
+	var r2 error
+	if rf, ok := ret.Get(0).(func(context.Context, time.Time, *pgdb.LRUCursor, int) ([]*entity.Order, *pgdb.LRUCursor, error)); ok {
+		return rf(ctx, before, after, limit)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, time.Time, *pgdb.LRUCursor, int) []*entity.Order); ok {
+		r0 = rf(ctx, before, after, limit)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]*entity.Order)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, time.Time, *pgdb.LRUCursor, int) *pgdb.LRUCursor); ok {
+		r1 = rf(ctx, before, after, limit)
+	} else {
+		if ret.Get(1) != nil {
+			r1 = ret.Get(1).(*pgdb.LRUCursor)
+		}
+	}
+
+	if rf, ok := ret.Get(2).(func(context.Context, time.Time, *pgdb.LRUCursor, int) error); ok {
+		r2 = rf(ctx, before, after, limit)
+	} else {
+		r2 = ret.Error(2)
+	}
+
+	return r0, r1, r2
+}
+
+// GetLRUOrders provides a mock function with given fields: ctx, after, limit
+func (_m *Order) GetLRUOrders(ctx context.Context, after *pgdb.LRUCursor, limit int) ([]*entity.Order, *pgdb.LRUCursor, error) {
+	ret := _m.Called(ctx, after, limit)
 
 	if len(ret) == 0 {
 		panic("no return value specified for GetLRUOrders")
 	}
 
 	var r0 []*entity.Order
-	var r1 error
-	if rf, ok := ret.Get(0).(func(context.Context) ([]*entity.Order, error)); ok {
-		return rf(ctx)
+	var r1 *pgdb.LRUCursor
+	var r2 error
+	if rf, ok := ret.Get(0).(func(context.Context, *pgdb.LRUCursor, int) ([]*entity.Order, *pgdb.LRUCursor, error)); ok {
+		return rf(ctx, after, limit)
 	}
-	if rf, ok := ret.Get(0).(func(context.Context) []*entity.Order); ok {
-		r0 = rf(ctx)
+	if rf, ok := ret.Get(0).(func(context.Context, *pgdb.LRUCursor, int) []*entity.Order); ok {
+		r0 = rf(ctx, after, limit)
 	} else {
 		if ret.Get(0) != nil {
 			r0 = ret.Get(0).([]*entity.Order)
 		}
 	}
 
-	if rf, ok := ret.Get(1).(func(context.Context) error); ok {
-		r1 = rf(ctx)
+	if rf, ok := ret.Get(1).(func(context.Context, *pgdb.LRUCursor, int) *pgdb.LRUCursor); ok {
+		r1 = rf(ctx, after, limit)
+	} else {
+		if ret.Get(1) != nil {
+			r1 = ret.Get(1).(*pgdb.LRUCursor)
+		}
+	}
+
+	if rf, ok := ret.Get(2).(func(context.Context, *pgdb.LRUCursor, int) error); ok {
+		r2 = rf(ctx, after, limit)
+	} else {
+		r2 = ret.Error(2)
+	}
+
+	return r0, r1, r2
+}
+
+// GetOrder provides a mock function with given fields: ctx, uid
+func (_m *Order) GetOrder(ctx context.Context, uid string) (*entity.Order, error) {
+	ret := _m.Called(ctx, uid)
+
+	if len(ret) == 0 {
+		panic("no return value specified for GetOrder")
+	}
+
+	var r0 *entity.Order
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) (*entity.Order, error)); ok {
+		return rf(ctx, uid)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string) *entity.Order); ok {
+		r0 = rf(ctx, uid)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*entity.Order)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, uid)
 	} else {
 		r1 = ret.Error(1)
 	}
@@ -44,6 +144,84 @@ func (_m *Order) GetLRUOrders(ctx context.Context) ([]*entity.Order, error) {
 	return r0, r1
 }
 
+// ListIdleOrders provides a mock function with given fields: ctx, before, after, limit
+func (_m *Order) ListIdleOrders(ctx context.Context, before time.Time, after *pgdb.LRUCursor, limit int) ([]*entity.Order, *pgdb.LRUCursor, error) {
+	ret := _m.Called(ctx, before, after, limit)
+
+	if len(ret) == 0 {
+		panic("no return value specified for ListIdleOrders")
+	}
+
+	var r0 []*entity.Order
+	var r1 *pgdb.LRUCursor
+	var r2 error
+	if rf, ok := ret.Get(0).(func(context.Context, time.Time, *pgdb.LRUCursor, int) ([]*entity.Order, *pgdb.LRUCursor, error)); ok {
+		return rf(ctx, before, after, limit)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, time.Time, *pgdb.LRUCursor, int) []*entity.Order); ok {
+		r0 = rf(ctx, before, after, limit)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]*entity.Order)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, time.Time, *pgdb.LRUCursor, int) *pgdb.LRUCursor); ok {
+		r1 = rf(ctx, before, after, limit)
+	} else {
+		if ret.Get(1) != nil {
+			r1 = ret.Get(1).(*pgdb.LRUCursor)
+		}
+	}
+
+	if rf, ok := ret.Get(2).(func(context.Context, time.Time, *pgdb.LRUCursor, int) error); ok {
+		r2 = rf(ctx, before, after, limit)
+	} else {
+		r2 = ret.Error(2)
+	}
+
+	return r0, r1, r2
+}
+
+// ListOrders provides a mock function with given fields: ctx, filter, sort, after, limit
+func (_m *Order) ListOrders(ctx context.Context, filter pgdb.OrderFilter, sort pgdb.OrderSort, after *pgdb.ListCursor, limit int) ([]*entity.Order, *pgdb.ListCursor, error) {
+	ret := _m.Called(ctx, filter, sort, after, limit)
+
+	if len(ret) == 0 {
+		panic("no return value specified for ListOrders")
+	}
+
+	var r0 []*entity.Order
+	var r1 *pgdb.ListCursor
+	var r2 error
+	if rf, ok := ret.Get(0).(func(context.Context, pgdb.OrderFilter, pgdb.OrderSort, *pgdb.ListCursor, int) ([]*entity.Order, *pgdb.ListCursor, error)); ok {
+		return rf(ctx, filter, sort, after, limit)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, pgdb.OrderFilter, pgdb.OrderSort, *pgdb.ListCursor, int) []*entity.Order); ok {
+		r0 = rf(ctx, filter, sort, after, limit)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]*entity.Order)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, pgdb.OrderFilter, pgdb.OrderSort, *pgdb.ListCursor, int) *pgdb.ListCursor); ok {
+		r1 = rf(ctx, filter, sort, after, limit)
+	} else {
+		if ret.Get(1) != nil {
+			r1 = ret.Get(1).(*pgdb.ListCursor)
+		}
+	}
+
+	if rf, ok := ret.Get(2).(func(context.Context, pgdb.OrderFilter, pgdb.OrderSort, *pgdb.ListCursor, int) error); ok {
+		r2 = rf(ctx, filter, sort, after, limit)
+	} else {
+		r2 = ret.Error(2)
+	}
+
+	return r0, r1, r2
+}
+
 // SaveOrder provides a mock function with given fields: ctx, order
 func (_m *Order) SaveOrder(ctx context.Context, order *entity.Order) (string, error) {
 	ret := _m.Called(ctx, order)
@@ -72,17 +250,47 @@ func (_m *Order) SaveOrder(ctx context.Context, order *entity.Order) (string, er
 	return r0, r1
 }
 
-// UpdateOrderTime provides a mock function with given fields: ctx, uid
-func (_m *Order) UpdateOrderTime(ctx context.Context, uid string) error {
-	ret := _m.Called(ctx, uid)
+// SaveOrders provides a mock function with given fields: ctx, orders
+func (_m *Order) SaveOrders(ctx context.Context, orders []*entity.Order) ([]error, error) {
+	ret := _m.Called(ctx, orders)
+
+	if len(ret) == 0 {
+		panic("no return value specified for SaveOrders")
+	}
+
+	var r0 []error
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, []*entity.Order) ([]error, error)); ok {
+		return rf(ctx, orders)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, []*entity.Order) []error); ok {
+		r0 = rf(ctx, orders)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]error)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, []*entity.Order) error); ok {
+		r1 = rf(ctx, orders)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// TouchOrders provides a mock function with given fields: ctx, accesses
+func (_m *Order) TouchOrders(ctx context.Context, accesses map[string]time.Time) error {
+	ret := _m.Called(ctx, accesses)
 
 	if len(ret) == 0 {
-		panic("no return value specified for UpdateOrderTime")
+		panic("no return value specified for TouchOrders")
 	}
 
 	var r0 error
-	if rf, ok := ret.Get(0).(func(context.Context, string) error); ok {
-		r0 = rf(ctx, uid)
+	if rf, ok := ret.Get(0).(func(context.Context, map[string]time.Time) error); ok {
+		r0 = rf(ctx, accesses)
 	} else {
 		r0 = ret.Error(0)
 	}
@@ -90,6 +298,34 @@ func (_m *Order) UpdateOrderTime(ctx context.Context, uid string) error {
 	return r0
 }
 
+// UpsertOrder provides a mock function with given fields: ctx, order, mode
+func (_m *Order) UpsertOrder(ctx context.Context, order *entity.Order, mode pgdb.WriteMode) (pgdb.WriteResult, error) {
+	ret := _m.Called(ctx, order, mode)
+
+	if len(ret) == 0 {
+		panic("no return value specified for UpsertOrder")
+	}
+
+	var r0 pgdb.WriteResult
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, *entity.Order, pgdb.WriteMode) (pgdb.WriteResult, error)); ok {
+		return rf(ctx, order, mode)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, *entity.Order, pgdb.WriteMode) pgdb.WriteResult); ok {
+		r0 = rf(ctx, order, mode)
+	} else {
+		r0 = ret.Get(0).(pgdb.WriteResult)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, *entity.Order, pgdb.WriteMode) error); ok {
+		r1 = rf(ctx, order, mode)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // NewOrder creates a new instance of Order. It also registers a testing interface on the mock and a cleanup function to assert the mocks expectations.
 // The first argument is typically a *testing.T value.
 func NewOrder(t interface {
@@ -0,0 +1,248 @@
+package natsjs
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/v7ktory/wb_task_one/internal/usecase"
+)
+
+// ErrInvalidMessage marks messages which can never be processed, however
+// often they are redelivered, e.g. malformed JSON or invalid orders.
+var ErrInvalidMessage = errors.New("invalid message")
+
+// ErrDeadLetterNotFound is returned for sequences not in the DLQ stream.
+var ErrDeadLetterNotFound = errors.New("dead letter not found")
+
+// ErrReplayDuplicate is returned when JetStream drops a replayed message as
+// a duplicate of one published shortly before. The dead letter is kept.
+var ErrReplayDuplicate = errors.New("replay dropped as duplicate")
+
+// Headers of a dead letter describing the original message
+const (
+	HeaderSubject   = "Dlq-Subject"
+	HeaderStreamSeq = "Dlq-Stream-Seq"
+	HeaderTimestamp = "Dlq-Timestamp"
+	HeaderReason    = "Dlq-Reason"
+	// JSON object of the validation problems, if any
+	HeaderProblems = "Dlq-Problems"
+)
+
+// DeadLetter is a message moved to the DLQ stream.
+type DeadLetter struct {
+	Sequence       uint64            `json:"seq"`
+	DeadAt         time.Time         `json:"dead_at"`
+	Subject        string            `json:"subject"`
+	StreamSequence uint64            `json:"stream_seq"`
+	Timestamp      time.Time         `json:"timestamp"`
+	Reason         string            `json:"reason"`
+	Problems       map[string]string `json:"problems,omitempty"`
+	Data           string            `json:"data"`
+}
+
+// DeadLetterQueue keeps the messages the subscriber gave up on in a separate
+// stream, so they can be inspected and, once the cause is fixed, replayed
+// into their original subject.
+type DeadLetterQueue struct {
+	jetStr     jetstream.JetStream
+	streamName string
+	subject    string
+	logger     *slog.Logger
+}
+
+func NewDeadLetterQueue(jetStr jetstream.JetStream, streamName, subject string, logger *slog.Logger) *DeadLetterQueue {
+	return &DeadLetterQueue{
+		jetStr:     jetStr,
+		streamName: streamName,
+		subject:    subject,
+		logger:     logger,
+	}
+}
+
+func (q *DeadLetterQueue) CreateStream(ctx context.Context) (jetstream.Stream, error) {
+	const op = "dlq.go - CreateStream"
+	stream, err := q.jetStr.CreateOrUpdateStream(ctx, jetstream.StreamConfig{
+		Name:       q.streamName,
+		Subjects:   []string{q.subject},
+		Retention:  jetstream.LimitsPolicy, // keep dead letters until replayed or deleted
+		Discard:    jetstream.DiscardOld,   // when the stream is full, discard old messages
+		MaxAge:     30 * 24 * time.Hour,    // max age of dead letters is 30 days
+		Storage:    jetstream.FileStorage,  // type of message storage
+		MaxMsgSize: 4<<20 + 64<<10,         // max order size plus the headers
+		MaxBytes:   1 << 30,                // max total size is 1 GB
+		NoAck:      false,
+	})
+	if err != nil {
+		q.logger.Error("Failed to create DLQ stream", slog.Any("error", err.Error()), slog.Any("operation", op))
+		return nil, fmt.Errorf("%s - jetstream.CreateOrUpdateStream: %w", op, err)
+	}
+	return stream, nil
+}
+
+// Send stores the message with the reason it couldn't be processed. The
+// caller acks the original message only once Send succeeded.
+func (q *DeadLetterQueue) Send(ctx context.Context, msg jetstream.Msg, reason error) error {
+	const op = "dlq.go - Send"
+
+	dead, err := deadLetterMsg(q.subject, msg, reason)
+	if err != nil {
+		return fmt.Errorf("%s - deadLetterMsg: %w", op, err)
+	}
+	if _, err := q.jetStr.PublishMsg(ctx, dead); err != nil {
+		return fmt.Errorf("%s - jetstream.PublishMsg: %w", op, err)
+	}
+	q.logger.Warn("Message moved to DLQ", slog.Any("subject", msg.Subject()), slog.Any("reason", reason.Error()), slog.Any("operation", op))
+	return nil
+}
+
+// deadLetterMsg copies the message into one for the DLQ subject, with the
+// original headers kept and the DLQ headers added.
+func deadLetterMsg(subject string, msg jetstream.Msg, reason error) (*nats.Msg, error) {
+	meta, err := msg.Metadata()
+	if err != nil {
+		return nil, err
+	}
+
+	dead := nats.NewMsg(subject)
+	for key, values := range msg.Headers() {
+		dead.Header[key] = values
+	}
+	// A dead letter is never a duplicate of another one
+	dead.Header.Del(jetstream.MsgIDHeader)
+	dead.Header.Set(HeaderSubject, msg.Subject())
+	dead.Header.Set(HeaderStreamSeq, strconv.FormatUint(meta.Sequence.Stream, 10))
+	dead.Header.Set(HeaderTimestamp, meta.Timestamp.UTC().Format(time.RFC3339Nano))
+	dead.Header.Set(HeaderReason, reason.Error())
+	var validationErr *usecase.ValidationError
+	if errors.As(reason, &validationErr) {
+		problems, _ := json.Marshal(validationErr.Problems)
+		dead.Header.Set(HeaderProblems, string(problems))
+	}
+	dead.Data = msg.Data()
+	return dead, nil
+}
+
+// List returns up to limit dead letters with a sequence above after, oldest
+// first.
+func (q *DeadLetterQueue) List(ctx context.Context, after uint64, limit int) ([]DeadLetter, error) {
+	const op = "dlq.go - List"
+
+	stream, err := q.jetStr.Stream(ctx, q.streamName)
+	if err != nil {
+		return nil, fmt.Errorf("%s - jetstream.Stream: %w", op, err)
+	}
+
+	letters := make([]DeadLetter, 0, limit)
+	for seq := after + 1; len(letters) < limit; {
+		raw, err := stream.GetMsg(ctx, seq, jetstream.WithGetMsgSubject(q.subject))
+		if errors.Is(err, jetstream.ErrMsgNotFound) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s - stream.GetMsg: %w", op, err)
+		}
+		letters = append(letters, parseDeadLetter(raw))
+		seq = raw.Sequence + 1
+	}
+	return letters, nil
+}
+
+func (q *DeadLetterQueue) Get(ctx context.Context, seq uint64) (*DeadLetter, error) {
+	const op = "dlq.go - Get"
+
+	stream, err := q.jetStr.Stream(ctx, q.streamName)
+	if err != nil {
+		return nil, fmt.Errorf("%s - jetstream.Stream: %w", op, err)
+	}
+	raw, err := stream.GetMsg(ctx, seq)
+	if errors.Is(err, jetstream.ErrMsgNotFound) {
+		return nil, ErrDeadLetterNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s - stream.GetMsg: %w", op, err)
+	}
+	letter := parseDeadLetter(raw)
+	return &letter, nil
+}
+
+// Replay publishes the dead letter to its original subject again and
+// removes it from the DLQ. A non-nil data replaces the original payload,
+// e.g. with a fixed order. If JetStream drops the message as a duplicate,
+// nothing was published, so the dead letter stays and ErrReplayDuplicate
+// is returned.
+func (q *DeadLetterQueue) Replay(ctx context.Context, seq uint64, data []byte) error {
+	const op = "dlq.go - Replay"
+
+	letter, err := q.Get(ctx, seq)
+	if err != nil {
+		return err
+	}
+	if data == nil {
+		data = []byte(letter.Data)
+	}
+
+	// Replaying the same payload twice in a row stores it once
+	ack, err := q.jetStr.Publish(ctx, letter.Subject, data, jetstream.WithMsgID(replayMsgID(letter.Subject, data)))
+	if err != nil {
+		return fmt.Errorf("%s - jetstream.Publish: %w", op, err)
+	}
+	if ack.Duplicate {
+		return ErrReplayDuplicate
+	}
+	q.logger.Info("Dead letter replayed", slog.Any("seq", seq), slog.Any("subject", letter.Subject), slog.Any("operation", op))
+
+	return q.Delete(ctx, seq)
+}
+
+func (q *DeadLetterQueue) Delete(ctx context.Context, seq uint64) error {
+	const op = "dlq.go - Delete"
+
+	stream, err := q.jetStr.Stream(ctx, q.streamName)
+	if err != nil {
+		return fmt.Errorf("%s - jetstream.Stream: %w", op, err)
+	}
+	err = stream.DeleteMsg(ctx, seq)
+	if errors.Is(err, jetstream.ErrMsgNotFound) {
+		return ErrDeadLetterNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("%s - stream.DeleteMsg: %w", op, err)
+	}
+	return nil
+}
+
+// replayMsgID identifies a replay by what is published rather than by the
+// dead letter, so a replay with a fixed payload is never taken for an
+// earlier one.
+func replayMsgID(subject string, data []byte) string {
+	h := sha256.New()
+	h.Write([]byte(subject))
+	h.Write([]byte{0})
+	h.Write(data)
+	return "replay-" + hex.EncodeToString(h.Sum(nil))
+}
+
+func parseDeadLetter(raw *jetstream.RawStreamMsg) DeadLetter {
+	letter := DeadLetter{
+		Sequence: raw.Sequence,
+		DeadAt:   raw.Time,
+		Subject:  raw.Header.Get(HeaderSubject),
+		Reason:   raw.Header.Get(HeaderReason),
+		Data:     string(raw.Data),
+	}
+	letter.StreamSequence, _ = strconv.ParseUint(raw.Header.Get(HeaderStreamSeq), 10, 64)
+	letter.Timestamp, _ = time.Parse(time.RFC3339Nano, raw.Header.Get(HeaderTimestamp))
+	if problems := raw.Header.Get(HeaderProblems); problems != "" {
+		json.Unmarshal([]byte(problems), &letter.Problems)
+	}
+	return letter
+}
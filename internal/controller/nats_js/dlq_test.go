@@ -0,0 +1,104 @@
+package natsjs
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/v7ktory/wb_task_one/internal/usecase"
+)
+
+type fakeMsg struct {
+	jetstream.Msg
+	subject string
+	headers nats.Header
+	data    []byte
+	meta    *jetstream.MsgMetadata
+	settled string
+	delay   time.Duration
+}
+
+func (m *fakeMsg) Subject() string                           { return m.subject }
+func (m *fakeMsg) Headers() nats.Header                      { return m.headers }
+func (m *fakeMsg) Data() []byte                              { return m.data }
+func (m *fakeMsg) Metadata() (*jetstream.MsgMetadata, error) { return m.meta, nil }
+func (m *fakeMsg) InProgress() error                         { return nil }
+func (m *fakeMsg) Ack() error                                { m.settled = "ack"; return nil }
+func (m *fakeMsg) Nak() error                                { m.settled = "nak"; return nil }
+func (m *fakeMsg) Term() error                               { m.settled = "term"; return nil }
+
+func (m *fakeMsg) NakWithDelay(delay time.Duration) error {
+	m.settled, m.delay = "nak", delay
+	return nil
+}
+
+func TestDeadLetterRoundTrip(t *testing.T) {
+	timestamp := time.Date(2021, 11, 26, 6, 22, 19, 0, time.UTC)
+	msg := &fakeMsg{
+		subject: "example-subject",
+		headers: nats.Header{jetstream.MsgIDHeader: []string{"b563feb7b2b84b6test"}, "Trace-Id": []string{"42"}},
+		data:    []byte(`{"order_uid": "b563feb7b2b84b6test"}`),
+		meta:    &jetstream.MsgMetadata{Sequence: jetstream.SequencePair{Stream: 7}, Timestamp: timestamp},
+	}
+	reason := fmt.Errorf("%w: %w", ErrInvalidMessage, &usecase.ValidationError{Problems: map[string]string{"entry": "Entry is required"}})
+
+	dead, err := deadLetterMsg("dlq.example-subject", msg, reason)
+	if err != nil {
+		t.Fatalf("deadLetterMsg: %v", err)
+	}
+	if dead.Header.Get(jetstream.MsgIDHeader) != "" {
+		t.Errorf("Expected no message id, received=%v", dead.Header.Get(jetstream.MsgIDHeader))
+	}
+	if dead.Header.Get("Trace-Id") != "42" {
+		t.Errorf("Expected original header=%v, received=%v", "42", dead.Header.Get("Trace-Id"))
+	}
+
+	letter := parseDeadLetter(&jetstream.RawStreamMsg{Subject: dead.Subject, Sequence: 3, Header: dead.Header, Data: dead.Data})
+	if letter.Subject != "example-subject" || letter.StreamSequence != 7 || !letter.Timestamp.Equal(timestamp) {
+		t.Errorf("Expected subject=example-subject stream_seq=7 timestamp=%v, received=%+v", timestamp, letter)
+	}
+	if letter.Problems["entry"] != "Entry is required" {
+		t.Errorf("Expected problems=%v, received=%v", "Entry is required", letter.Problems)
+	}
+	if letter.Data != string(msg.data) {
+		t.Errorf("Expected data=%v, received=%v", string(msg.data), letter.Data)
+	}
+}
+
+func TestReplayMsgID(t *testing.T) {
+	original := replayMsgID("example-subject", []byte(`{"order_uid": "b563feb7b2b84b6test"}`))
+
+	tests := []struct {
+		name    string
+		subject string
+		data    []byte
+		same    bool
+	}{
+		{
+			name:    "Test same payload",
+			subject: "example-subject",
+			data:    []byte(`{"order_uid": "b563feb7b2b84b6test"}`),
+			same:    true,
+		},
+		{
+			name:    "Test fixed payload",
+			subject: "example-subject",
+			data:    []byte(`{"order_uid": "b563feb7b2b84b6test", "entry": "WBIL"}`),
+		},
+		{
+			name:    "Test other subject",
+			subject: "other-subject",
+			data:    []byte(`{"order_uid": "b563feb7b2b84b6test"}`),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if same := replayMsgID(tt.subject, tt.data) == original; same != tt.same {
+				t.Errorf("Expected same=%v, received=%v", tt.same, same)
+			}
+		})
+	}
+}
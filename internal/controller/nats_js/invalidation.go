@@ -0,0 +1,100 @@
+package natsjs
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+
+	"github.com/nats-io/nats.go"
+	"github.com/v7ktory/wb_task_one/internal/entity"
+	"github.com/v7ktory/wb_task_one/internal/repo/cache"
+)
+
+// InvalidationEvent tells other instances that their cached copy of an
+// order is stale.
+type InvalidationEvent struct {
+	UID    string `json:"order_uid"`
+	Op     string `json:"op"`
+	Origin string `json:"origin"`
+}
+
+// Invalidator keeps the caches of several instances consistent. Every
+// instance publishes an event on a plain NATS subject when it writes or
+// removes an order, and evicts the order when another instance does, so the
+// next lookup reloads it from postgres.
+//
+// Core NATS delivers at most once: an event missed while disconnected leaves
+// the order stale until the cache TTL expires it.
+type Invalidator struct {
+	conn       *nats.Conn
+	subject    string
+	instanceID string
+	cache      cache.Cache[string, *entity.Order]
+	logger     *slog.Logger
+}
+
+func NewInvalidator(conn *nats.Conn, subject, instanceID string, cache cache.Cache[string, *entity.Order], logger *slog.Logger) *Invalidator {
+	return &Invalidator{
+		conn:       conn,
+		subject:    subject,
+		instanceID: instanceID,
+		cache:      cache,
+		logger:     logger,
+	}
+}
+
+// Publish announces a change of the order to the other instances, change
+// being one of the usecase.Change kinds. It is a
+// no-op on a nil Invalidator, so invalidation can be left unconfigured.
+func (i *Invalidator) Publish(uid, change string) error {
+	const op = "invalidation.go - Publish"
+	if i == nil {
+		return nil
+	}
+
+	data, err := json.Marshal(InvalidationEvent{UID: uid, Op: change, Origin: i.instanceID})
+	if err != nil {
+		return fmt.Errorf("%s - json.Marshal: %w", op, err)
+	}
+	if err := i.conn.Publish(i.subject, data); err != nil {
+		return fmt.Errorf("%s - nats.Publish: %w", op, err)
+	}
+	return nil
+}
+
+// Subscribe evicts orders changed by other instances until ctx is done.
+func (i *Invalidator) Subscribe(ctx context.Context) error {
+	const op = "invalidation.go - Subscribe"
+
+	sub, err := i.conn.Subscribe(i.subject, func(msg *nats.Msg) {
+		if err := i.handleInvalidation(msg.Data); err != nil {
+			i.logger.Error("Invalidation handling error", slog.Any("error", err.Error()), slog.Any("operation", op))
+		}
+	})
+	if err != nil {
+		i.logger.Error("Failed to subscribe to invalidations", slog.Any("error", err.Error()), slog.Any("operation", op))
+		return fmt.Errorf("%s - nats.Subscribe: %w", op, err)
+	}
+	defer sub.Unsubscribe()
+
+	<-ctx.Done()
+	i.logger.Debug("Context canceled, stopping invalidator", slog.Any("operation", op))
+	return nil
+}
+
+func (i *Invalidator) handleInvalidation(data []byte) error {
+	const op = "invalidation.go - handleInvalidation"
+
+	var event InvalidationEvent
+	if err := json.Unmarshal(data, &event); err != nil {
+		return fmt.Errorf("%s - decode json: %w", op, err)
+	}
+	if event.Origin == i.instanceID {
+		return nil
+	}
+
+	i.cache.Delete(event.UID)
+	i.logger.Debug("Order invalidated", slog.Any("order_uid", event.UID), slog.Any("op", event.Op), slog.Any("origin", event.Origin), slog.Any("operation", op))
+	return nil
+}
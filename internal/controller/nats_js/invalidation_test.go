@@ -0,0 +1,65 @@
+package natsjs
+
+import (
+	"log/slog"
+	"os"
+	"testing"
+
+	"github.com/v7ktory/wb_task_one/internal/controller/mocks"
+	"github.com/v7ktory/wb_task_one/internal/entity"
+)
+
+func TestHandleInvalidation(t *testing.T) {
+	mockCache := mocks.NewCache[string, *entity.Order](t)
+	mockLogger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+
+	tests := []struct {
+		name      string
+		msg       []byte
+		mockSetup func()
+		wantErr   bool
+	}{
+		{
+			name: "Test event from another instance",
+			msg:  []byte(`{"order_uid": "b563feb7b2b84b6test", "op": "upsert", "origin": "other"}`),
+			mockSetup: func() {
+				mockCache.
+					On("Delete", "b563feb7b2b84b6test").
+					Return(true).
+					Once()
+			},
+			wantErr: false,
+		},
+		{
+			name: "Test own event",
+			msg:  []byte(`{"order_uid": "b563feb7b2b84b6test", "op": "upsert", "origin": "self"}`),
+			mockSetup: func() {
+				// The own write is already in the cache, nothing to evict
+			},
+			wantErr: false,
+		},
+		{
+			name: "Test invalid event",
+			msg:  []byte(`Invalid event`),
+			mockSetup: func() {
+				// No mock setup needed for invalid event
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		i := Invalidator{
+			instanceID: "self",
+			cache:      mockCache,
+			logger:     mockLogger,
+		}
+		tt.mockSetup()
+		err := i.handleInvalidation(tt.msg)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("handleInvalidation() error = %v, wantErr %v", err, tt.wantErr)
+			return
+		}
+	}
+	mockCache.AssertNumberOfCalls(t, "Delete", 1)
+}
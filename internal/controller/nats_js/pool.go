@@ -0,0 +1,199 @@
+package natsjs
+
+import (
+	"context"
+	"encoding/json"
+	"hash/fnv"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// Keys partitioning messages among the workers
+const (
+	PartitionNone       = ""
+	PartitionOrderUID   = "order_uid"
+	PartitionCustomerID = "customer_id"
+)
+
+const (
+	defaultWorkers       = 1
+	defaultMaxAckPending = 1000
+	defaultFetchExpiry   = 5 * time.Second
+	defaultFlushInterval = 50 * time.Millisecond
+	// keeps a batch insert well below the postgres limit of statement parameters
+	maxSaveBatch = 1000
+)
+
+// PoolConfig sets how many messages the subscriber handles at a time.
+//
+// Workers handle messages concurrently. With a PartitionBy key, messages
+// with the same key always go to the same worker, so they are handled in
+// the order of the stream; otherwise any idle worker takes the next one.
+//
+// MaxAckPending bounds the messages delivered but not yet acked, which is
+// also the most the subscriber holds in memory.
+//
+// A positive FetchBatch pulls batches of that size, waiting at most
+// FetchExpiry for each to fill, instead of consuming continuously.
+//
+// A SaveBatch above one lets every worker collect up to that many messages
+// and save their orders in one transaction, waiting at most FlushInterval
+// for a batch to fill. The messages are acked once the batch committed.
+type PoolConfig struct {
+	Workers       int
+	PartitionBy   string
+	MaxAckPending int
+	FetchBatch    int
+	FetchExpiry   time.Duration
+	SaveBatch     int
+	FlushInterval time.Duration
+}
+
+func (c PoolConfig) withDefaults() PoolConfig {
+	if c.Workers <= 0 {
+		c.Workers = defaultWorkers
+	}
+	if c.MaxAckPending <= 0 {
+		c.MaxAckPending = defaultMaxAckPending
+	}
+	c.MaxAckPending = max(c.MaxAckPending, c.Workers)
+	c.FetchBatch = min(c.FetchBatch, c.MaxAckPending)
+	if c.FetchExpiry <= 0 {
+		c.FetchExpiry = defaultFetchExpiry
+	}
+	c.SaveBatch = min(max(c.SaveBatch, 1), maxSaveBatch)
+	if c.FlushInterval <= 0 {
+		c.FlushInterval = defaultFlushInterval
+	}
+	return c
+}
+
+// workerPool hands messages to the workers, which pass them on in batches
+// of up to SaveBatch. dispatch blocks while the worker's queue is full,
+// which holds back the consumer.
+type workerPool struct {
+	partitionBy string
+	queues      []chan jetstream.Msg
+	wg          sync.WaitGroup
+
+	// mu guards closing the queues against the dispatches sending on them
+	mu     sync.RWMutex
+	closed bool
+}
+
+func startWorkerPool(ctx context.Context, config PoolConfig, handle func([]jetstream.Msg)) *workerPool {
+	p := &workerPool{partitionBy: config.PartitionBy}
+
+	// Without partitioning all workers share one queue
+	queues := 1
+	if config.PartitionBy != PartitionNone {
+		queues = config.Workers
+	}
+	// Queued messages count against MaxAckPending along with the handled ones
+	size := max((config.MaxAckPending-config.Workers*config.SaveBatch)/queues, 0)
+	p.queues = make([]chan jetstream.Msg, queues)
+	for i := range p.queues {
+		p.queues[i] = make(chan jetstream.Msg, size)
+	}
+
+	for i := 0; i < config.Workers; i++ {
+		queue := p.queues[i%queues]
+		p.wg.Add(1)
+		go func() {
+			defer p.wg.Done()
+			work(ctx, queue, config.SaveBatch, config.FlushInterval, handle)
+		}()
+	}
+	return p
+}
+
+// work collects the messages of the queue into batches, handled when full
+// or flushInterval after their first message arrived.
+func work(ctx context.Context, queue <-chan jetstream.Msg, batchSize int, flushInterval time.Duration, handle func([]jetstream.Msg)) {
+	batch := make([]jetstream.Msg, 0, batchSize)
+	timer := time.NewTimer(flushInterval)
+	timer.Stop()
+	flush := func() {
+		timer.Stop()
+		if len(batch) > 0 && ctx.Err() == nil {
+			handle(batch)
+		}
+		// Left unacked on shutdown, the messages are redelivered after the ack wait
+		batch = make([]jetstream.Msg, 0, batchSize)
+	}
+
+	for {
+		select {
+		case msg, ok := <-queue:
+			if !ok {
+				flush()
+				return
+			}
+			batch = append(batch, msg)
+			if len(batch) == 1 {
+				timer.Reset(flushInterval)
+			}
+			if len(batch) >= batchSize {
+				flush()
+			}
+		case <-timer.C:
+			flush()
+		}
+	}
+}
+
+// dispatch queues the message for its worker. Messages dispatched once ctx
+// is done or the pool stopped are dropped, and redelivered after the ack wait.
+func (p *workerPool) dispatch(ctx context.Context, msg jetstream.Msg) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.closed {
+		return
+	}
+
+	queue := p.queues[0]
+	if len(p.queues) > 1 {
+		queue = p.queues[partition(msg.Data(), p.partitionBy, len(p.queues))]
+	}
+	select {
+	case queue <- msg:
+	case <-ctx.Done():
+	}
+}
+
+// stop waits for the running dispatches and then for the workers to finish
+// the queued messages. Dispatches blocked on a full queue only return once
+// their ctx is done, so stop must follow the cancellation of that ctx.
+func (p *workerPool) stop() {
+	p.mu.Lock()
+	if !p.closed {
+		p.closed = true
+		for _, queue := range p.queues {
+			close(queue)
+		}
+	}
+	p.mu.Unlock()
+	p.wg.Wait()
+}
+
+// partition returns the queue of a message. Messages without the key, e.g.
+// malformed ones, all go to the first queue.
+func partition(data []byte, by string, queues int) int {
+	var keys struct {
+		UID        string `json:"order_uid"`
+		CustomerID string `json:"customer_id"`
+	}
+	if err := json.Unmarshal(data, &keys); err != nil {
+		return 0
+	}
+
+	key := keys.UID
+	if by == PartitionCustomerID {
+		key = keys.CustomerID
+	}
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return int(h.Sum32() % uint32(queues))
+}
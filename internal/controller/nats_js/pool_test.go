@@ -0,0 +1,72 @@
+package natsjs
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+func TestWorkerPoolKeepsKeyOrder(t *testing.T) {
+	var mu sync.Mutex
+	handled := make(map[string][]int)
+
+	config := PoolConfig{Workers: 4, PartitionBy: PartitionCustomerID, MaxAckPending: 64, SaveBatch: 8}.withDefaults()
+	pool := startWorkerPool(context.Background(), config, func(msgs []jetstream.Msg) {
+		for _, msg := range msgs {
+			var order struct {
+				Seq        int    `json:"sm_id"`
+				CustomerID string `json:"customer_id"`
+			}
+			json.Unmarshal(msg.Data(), &order)
+			mu.Lock()
+			handled[order.CustomerID] = append(handled[order.CustomerID], order.Seq)
+			mu.Unlock()
+		}
+	})
+
+	const messages = 1000
+	for i := 0; i < messages; i++ {
+		data := fmt.Sprintf(`{"order_uid": "order%d", "customer_id": "customer%d", "sm_id": %d}`, i, i%7, i)
+		pool.dispatch(context.Background(), &fakeMsg{data: []byte(data)})
+	}
+	pool.stop()
+
+	total := 0
+	for customer, seqs := range handled {
+		total += len(seqs)
+		for i := 1; i < len(seqs); i++ {
+			if seqs[i] < seqs[i-1] {
+				t.Errorf("Expected %s handled in order, received %v after %v", customer, seqs[i], seqs[i-1])
+			}
+		}
+	}
+	if total != messages {
+		t.Errorf("Expected handled=%v, received=%v", messages, total)
+	}
+}
+
+func TestWorkerPoolStopsWhileDispatching(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	config := PoolConfig{Workers: 2, MaxAckPending: 4}.withDefaults()
+	pool := startWorkerPool(ctx, config, func(msgs []jetstream.Msg) {})
+
+	// Dispatch the way consume callbacks do, still running after Stop
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				pool.dispatch(ctx, &fakeMsg{data: []byte(`{"order_uid": "order"}`)})
+			}
+		}()
+	}
+
+	cancel()
+	pool.stop()
+	wg.Wait()
+}
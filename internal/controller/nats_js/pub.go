@@ -2,26 +2,58 @@ package natsjs
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
 	"time"
 
+	"github.com/nats-io/nats.go"
 	"github.com/nats-io/nats.go/jetstream"
+	"github.com/v7ktory/wb_task_one/internal/model"
 )
 
+var (
+	// ErrDuplicateOrder means the stream already has a message with the same
+	// message ID published within the duplicate window, so it dropped this one.
+	ErrDuplicateOrder = errors.New("order already published")
+	ErrNoStream       = errors.New("no stream for the subject")
+	ErrPublishTimeout = errors.New("no publish ack in time")
+)
+
+// PublishError is returned by Publish and PublishFuture.Wait. It wraps one
+// of the errors above or the underlying NATS error.
+type PublishError struct {
+	UID string
+	Err error
+}
+
+func (e *PublishError) Error() string {
+	return fmt.Sprintf("publish order %s: %s", e.UID, e.Err)
+}
+
+func (e *PublishError) Unwrap() error {
+	return e.Err
+}
+
 type Publisher struct {
-	jetStr jetstream.JetStream
-	logger *slog.Logger
+	jetStr          jetstream.JetStream
+	subject         string
+	duplicateWindow time.Duration
+	logger          *slog.Logger
 }
 
-func NewPublisher(jetStr jetstream.JetStream, logger *slog.Logger) *Publisher {
+// NewPublisher returns a publisher of orders to the subject. Orders with the
+// same message ID, see msgID, published within duplicateWindow are stored once.
+func NewPublisher(jetStr jetstream.JetStream, subject string, duplicateWindow time.Duration, logger *slog.Logger) *Publisher {
 	return &Publisher{
-		jetStr: jetStr,
-		logger: logger,
+		jetStr:          jetStr,
+		subject:         subject,
+		duplicateWindow: duplicateWindow,
+		logger:          logger,
 	}
 }
 
-// TODO we can add a publish method to produce messages into NATS stream
 func (p *Publisher) CreateStream(ctx context.Context, streamName, subject string) (jetstream.Stream, error) {
 	const op = "subscriber.subscriber.go - createStream"
 	stream, err := p.jetStr.CreateStream(ctx, jetstream.StreamConfig{
@@ -33,6 +65,7 @@ func (p *Publisher) CreateStream(ctx context.Context, streamName, subject string
 		Storage:           jetstream.FileStorage,    // type of message storage
 		MaxMsgsPerSubject: 100_000_000,              // max stored messages per subject
 		MaxMsgSize:        4 << 20,                  // max single message size is 4 MB
+		Duplicates:        p.duplicateWindow,        // drop messages with a Nats-Msg-Id seen within the window
 		NoAck:             false,
 	})
 	if err != nil {
@@ -42,3 +75,88 @@ func (p *Publisher) CreateStream(ctx context.Context, streamName, subject string
 
 	return stream, nil
 }
+
+// Publish sends the order to the stream and waits until the stream stored
+// it. Retries of a publish which timed out have the same message ID, so they
+// can't store the order twice.
+func (p *Publisher) Publish(ctx context.Context, order *model.Order) (*jetstream.PubAck, error) {
+	data, err := json.Marshal(order)
+	if err != nil {
+		return nil, &PublishError{UID: order.UID, Err: fmt.Errorf("encode json: %w", err)}
+	}
+
+	ack, err := p.jetStr.Publish(ctx, p.subject, data, jetstream.WithMsgID(msgID(order)))
+	if err != nil {
+		return nil, publishError(order.UID, err)
+	}
+	if ack.Duplicate {
+		return ack, &PublishError{UID: order.UID, Err: ErrDuplicateOrder}
+	}
+	return ack, nil
+}
+
+// PublishFuture is the pending outcome of PublishAsync.
+type PublishFuture struct {
+	uid    string
+	future jetstream.PubAckFuture
+}
+
+// Wait returns the outcome of the publish, with the same errors as Publish.
+func (f *PublishFuture) Wait(ctx context.Context) (*jetstream.PubAck, error) {
+	select {
+	case ack := <-f.future.Ok():
+		if ack.Duplicate {
+			return ack, &PublishError{UID: f.uid, Err: ErrDuplicateOrder}
+		}
+		return ack, nil
+	case err := <-f.future.Err():
+		return nil, publishError(f.uid, err)
+	case <-ctx.Done():
+		return nil, publishError(f.uid, ctx.Err())
+	}
+}
+
+// PublishAsync sends the order without waiting for the stream. It blocks
+// only when too many publishes are pending. Use the future, or Flush for
+// all of them, to learn whether the order was stored.
+func (p *Publisher) PublishAsync(order *model.Order) (*PublishFuture, error) {
+	data, err := json.Marshal(order)
+	if err != nil {
+		return nil, &PublishError{UID: order.UID, Err: fmt.Errorf("encode json: %w", err)}
+	}
+
+	future, err := p.jetStr.PublishAsync(p.subject, data, jetstream.WithMsgID(msgID(order)))
+	if err != nil {
+		return nil, publishError(order.UID, err)
+	}
+	return &PublishFuture{uid: order.UID, future: future}, nil
+}
+
+// Flush waits until all pending async publishes got their outcome.
+func (p *Publisher) Flush(ctx context.Context) error {
+	select {
+	case <-p.jetStr.PublishAsyncComplete():
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// msgID identifies a version of the order, so corrections with a new version
+// or date_created reach the upsert write modes within the duplicate window.
+// An order republished with other changes only is dropped as a duplicate
+// within the window. Strict and idempotent mode refuse such a change anyway,
+// but the publisher gets ErrDuplicateOrder rather than the conflict.
+func msgID(order *model.Order) string {
+	return fmt.Sprintf("%s:%d:%d", order.UID, order.Version, order.DateCreated.UnixNano())
+}
+
+func publishError(uid string, err error) error {
+	switch {
+	case errors.Is(err, jetstream.ErrNoStreamResponse), errors.Is(err, nats.ErrNoResponders):
+		err = fmt.Errorf("%w: %w", ErrNoStream, err)
+	case errors.Is(err, context.DeadlineExceeded), errors.Is(err, nats.ErrTimeout):
+		err = fmt.Errorf("%w: %w", ErrPublishTimeout, err)
+	}
+	return &PublishError{UID: uid, Err: err}
+}
@@ -0,0 +1,87 @@
+package natsjs
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/v7ktory/wb_task_one/internal/model"
+)
+
+func TestPublishError(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		expected error
+	}{
+		{
+			name:     "Test no stream",
+			err:      jetstream.ErrNoStreamResponse,
+			expected: ErrNoStream,
+		},
+		{
+			name:     "Test ack timeout",
+			err:      context.DeadlineExceeded,
+			expected: ErrPublishTimeout,
+		},
+		{
+			name:     "Test other error",
+			err:      nats.ErrConnectionClosed,
+			expected: nats.ErrConnectionClosed,
+		},
+	}
+
+	for _, tt := range tests {
+		err := publishError("b563feb7b2b84b6test", tt.err)
+		var publishErr *PublishError
+		if !errors.As(err, &publishErr) || publishErr.UID != "b563feb7b2b84b6test" {
+			t.Errorf("%s: Expected *PublishError, received=%v", tt.name, err)
+		}
+		if !errors.Is(err, tt.expected) || !errors.Is(err, tt.err) {
+			t.Errorf("%s: Expected err=%v, received=%v", tt.name, tt.expected, err)
+		}
+	}
+}
+
+func TestMsgID(t *testing.T) {
+	dateCreated := time.Date(2021, 11, 26, 6, 22, 19, 0, time.UTC)
+	order := model.Order{UID: "b563feb7b2b84b6test", Version: 1, DateCreated: dateCreated}
+
+	tests := []struct {
+		name     string
+		change   func(order *model.Order)
+		expected bool
+	}{
+		{
+			name:     "Test same order",
+			change:   func(order *model.Order) {},
+			expected: true,
+		},
+		{
+			name:     "Test other content",
+			change:   func(order *model.Order) { order.TrackNumber = "WBILMTESTTRACK" },
+			expected: true,
+		},
+		{
+			name:     "Test new version",
+			change:   func(order *model.Order) { order.Version++ },
+			expected: false,
+		},
+		{
+			name:     "Test new date",
+			change:   func(order *model.Order) { order.DateCreated = order.DateCreated.Add(time.Second) },
+			expected: false,
+		},
+	}
+
+	for _, tt := range tests {
+		changed := order
+		tt.change(&changed)
+		if received := msgID(&order) == msgID(&changed); received != tt.expected {
+			t.Errorf("%s: Expected same id=%v, received=%v", tt.name, tt.expected, received)
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package natsjs
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrMaxDeliveries is the reason of dead letters which kept failing with
+// transient errors until the delivery limit.
+var ErrMaxDeliveries = errors.New("max deliveries exceeded")
+
+const (
+	defaultMaxDeliver     = 10
+	defaultRetryBaseDelay = time.Second
+	defaultRetryMaxDelay  = 5 * time.Minute
+)
+
+// RetryPolicy decides when a message which failed with a transient error,
+// e.g. while postgres is down, is delivered again. The n-th redelivery waits
+// BaseDelay * 2^(n-1), up to MaxDelay. The MaxDeliver-th failed delivery
+// moves the message to the DLQ.
+type RetryPolicy struct {
+	MaxDeliver int
+	BaseDelay  time.Duration
+	MaxDelay   time.Duration
+}
+
+func (p RetryPolicy) withDefaults() RetryPolicy {
+	if p.MaxDeliver <= 0 {
+		p.MaxDeliver = defaultMaxDeliver
+	}
+	if p.BaseDelay <= 0 {
+		p.BaseDelay = defaultRetryBaseDelay
+	}
+	if p.MaxDelay <= 0 {
+		p.MaxDelay = defaultRetryMaxDelay
+	}
+	return p
+}
+
+// delay returns how long to wait before the next delivery of a message
+// delivered numDelivered times so far.
+func (p RetryPolicy) delay(numDelivered uint64) time.Duration {
+	delay := p.BaseDelay
+	for i := uint64(1); i < numDelivered && delay < p.MaxDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, p.MaxDelay)
+}
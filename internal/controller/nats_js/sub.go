@@ -2,30 +2,39 @@ package natsjs
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
 	"time"
 
+	"github.com/nats-io/nats.go"
 	"github.com/nats-io/nats.go/jetstream"
-	"github.com/v7ktory/wb_task_one/internal/entity"
 	"github.com/v7ktory/wb_task_one/internal/model"
-	"github.com/v7ktory/wb_task_one/internal/repo/cache"
 	"github.com/v7ktory/wb_task_one/internal/repo/pgdb"
+	"github.com/v7ktory/wb_task_one/internal/usecase"
 )
 
+// wait for ack before redelivering, handlers taking longer report progress.
+// It runs from the delivery on, so it covers the time queued in the pool.
+const ackWait = 30 * time.Second
+
 type Subscriber struct {
-	jetStr    jetstream.JetStream
-	orderRepo pgdb.Order
-	cache     cache.Cache[string, *entity.Order]
-	logger    *slog.Logger
+	jetStr      jetstream.JetStream
+	orders      *usecase.OrderUseCase
+	deadLetters *DeadLetterQueue
+	retry       RetryPolicy
+	pool        PoolConfig
+	logger      *slog.Logger
 }
 
-func NewSubscriber(jetStr jetstream.JetStream, orderRepo pgdb.Order, cache cache.Cache[string, *entity.Order], logger *slog.Logger) *Subscriber {
+func NewSubscriber(jetStr jetstream.JetStream, orders *usecase.OrderUseCase, deadLetters *DeadLetterQueue, retry RetryPolicy, pool PoolConfig, logger *slog.Logger) *Subscriber {
 	return &Subscriber{
-		jetStr:    jetStr,
-		orderRepo: orderRepo,
-		cache:     cache,
-		logger:    logger,
+		jetStr:      jetStr,
+		orders:      orders,
+		deadLetters: deadLetters,
+		retry:       retry.withDefaults(),
+		pool:        pool.withDefaults(),
+		logger:      logger,
 	}
 }
 
@@ -33,56 +42,208 @@ func NewSubscriber(jetStr jetstream.JetStream, orderRepo pgdb.Order, cache cache
 func (s *Subscriber) Subscribe(ctx context.Context, c jetstream.Consumer) error {
 	const op = "subscriber.subscriber.go - Subscribe"
 
-	cons, err := c.Consume(func(msg jetstream.Msg) {
-		defer msg.Ack()
-
-		if err := s.handleMessage(ctx, msg.Data()); err != nil {
-			s.logger.Error("Message handling error", slog.Any("error", err.Error()), slog.Any("operation", op))
+	pool := startWorkerPool(ctx, s.pool, func(msgs []jetstream.Msg) {
+		if len(msgs) == 1 {
+			s.processMessage(ctx, msgs[0])
+			return
 		}
+		s.processBatch(ctx, msgs)
 	})
+	defer pool.stop()
+
+	if s.pool.FetchBatch > 0 {
+		s.fetch(ctx, c, pool)
+		s.logger.Debug("Context canceled, stopping subscriber", slog.Any("operation", op))
+		return nil
+	}
+
+	cons, err := c.Consume(func(msg jetstream.Msg) {
+		pool.dispatch(ctx, msg)
+	}, jetstream.PullMaxMessages(s.pool.MaxAckPending))
 	if err != nil {
 		s.logger.Error("Failed to consume messages", slog.Any("error", err.Error()), slog.Any("operation", op))
 		return fmt.Errorf("%s - jetstream.Consume: %w", op, err)
 	}
-	defer cons.Stop()
 
 	<-ctx.Done()
 	s.logger.Debug("Context canceled, stopping subscriber", slog.Any("operation", op))
+	// Stop doesn't wait for the callbacks already running, Closed does
+	cons.Stop()
+	<-cons.Closed()
 	return nil
 }
 
-func (s *Subscriber) handleMessage(ctx context.Context, data []byte) error {
-	const op = "subscriber.subscriber.go - handleMessage"
+// fetch pulls batches of messages until ctx is done.
+func (s *Subscriber) fetch(ctx context.Context, c jetstream.Consumer, pool *workerPool) {
+	const op = "subscriber.subscriber.go - fetch"
 
-	orderRequest, problems, err := decodeNATSReq[model.Order](data)
-	if err != nil {
-		if len(problems) > 0 {
-			for _, problem := range problems {
-				s.logger.Error("Validation error", slog.Any("problem", problem), slog.Any("operation", op))
+	for ctx.Err() == nil {
+		batch, err := c.Fetch(s.pool.FetchBatch, jetstream.FetchMaxWait(s.pool.FetchExpiry))
+		if err != nil {
+			s.logger.Error("Failed to fetch messages", slog.Any("error", err.Error()), slog.Any("operation", op))
+			select {
+			case <-time.After(s.pool.FetchExpiry):
+			case <-ctx.Done():
 			}
-			return nil
+			continue
+		}
+		for msg := range batch.Messages() {
+			pool.dispatch(ctx, msg)
+		}
+		if err := batch.Error(); err != nil && !errors.Is(err, nats.ErrTimeout) {
+			s.logger.Error("Fetch batch error", slog.Any("error", err.Error()), slog.Any("operation", op))
 		}
-		return fmt.Errorf("%s - decodeNATSReq: %w", op, err)
 	}
+}
+
+// processMessage handles the message and settles it.
+func (s *Subscriber) processMessage(ctx context.Context, msg jetstream.Msg) {
+	err := withProgress([]jetstream.Msg{msg}, func() error {
+		return s.handleMessage(ctx, msg.Data())
+	})
+	s.settle(ctx, msg, err)
+}
 
-	order := convertNATSReq(orderRequest)
-	uid, err := s.orderRepo.SaveOrder(ctx, order)
+// processBatch saves the orders of the messages in one transaction and
+// settles every message once the transaction committed.
+func (s *Subscriber) processBatch(ctx context.Context, msgs []jetstream.Msg) {
+	const op = "subscriber.subscriber.go - processBatch"
+
+	orderRequests := make([]model.Order, 0, len(msgs))
+	decoded := make([]jetstream.Msg, 0, len(msgs))
+	for _, msg := range msgs {
+		orderRequest, err := decodeNATSReq[model.Order](msg.Data())
+		if err != nil {
+			s.settle(ctx, msg, fmt.Errorf("%s - decodeNATSReq: %w: %w", op, ErrInvalidMessage, err))
+			continue
+		}
+		orderRequests = append(orderRequests, orderRequest)
+		decoded = append(decoded, msg)
+	}
+
+	var results []error
+	err := withProgress(decoded, func() error {
+		var err error
+		results, err = s.orders.IngestBatch(ctx, orderRequests)
+		return err
+	})
+	for i, msg := range decoded {
+		switch {
+		case err != nil:
+			// The whole batch failed, so every message is retried
+			s.settle(ctx, msg, fmt.Errorf("%s - orders.IngestBatch: %w", op, err))
+		case results[i] != nil:
+			if invalidOrder(results[i]) {
+				s.settle(ctx, msg, fmt.Errorf("%s - orders.IngestBatch: %w: %w", op, ErrInvalidMessage, results[i]))
+				continue
+			}
+			s.settle(ctx, msg, fmt.Errorf("%s - orders.IngestBatch: %w", op, results[i]))
+		default:
+			s.settle(ctx, msg, nil)
+		}
+	}
+}
+
+// settle acks the message when handled or when retrying can't help,
+// redelivers it with backoff after transient failures, and moves it to the
+// DLQ when invalid or out of deliveries.
+func (s *Subscriber) settle(ctx context.Context, msg jetstream.Msg, err error) {
+	const op = "subscriber.subscriber.go - settle"
+
+	switch {
+	case err == nil:
+		msg.Ack()
+	case errors.Is(err, pgdb.ErrAlreadyExists):
+		s.logger.Warn("Order already saved", slog.Any("error", err.Error()), slog.Any("operation", op))
+		msg.Ack()
+	case errors.Is(err, ErrInvalidMessage):
+		s.deadLetter(ctx, msg, err)
+	default:
+		meta, metaErr := msg.Metadata()
+		if metaErr != nil {
+			s.logger.Error("Message handling error", slog.Any("error", err.Error()), slog.Any("operation", op))
+			msg.Nak()
+			return
+		}
+		if meta.NumDelivered >= uint64(s.retry.MaxDeliver) {
+			s.deadLetter(ctx, msg, fmt.Errorf("%w after %d deliveries: %w", ErrMaxDeliveries, meta.NumDelivered, err))
+			return
+		}
+		delay := s.retry.delay(meta.NumDelivered)
+		s.logger.Error("Message handling error, retrying", slog.Any("error", err.Error()), slog.Any("delivered", meta.NumDelivered), slog.Any("delay", delay), slog.Any("operation", op))
+		msg.NakWithDelay(delay)
+	}
+}
+
+// withProgress runs handle, telling the server the messages are still
+// being worked on if that takes a good part of the ack wait.
+func withProgress(msgs []jetstream.Msg, handle func() error) error {
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		ticker := time.NewTicker(ackWait / 2)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				for _, msg := range msgs {
+					msg.InProgress()
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return handle()
+}
+
+// deadLetter moves the message to the DLQ and terminates it, so it isn't
+// delivered again. It is redelivered instead if the DLQ can't take it.
+func (s *Subscriber) deadLetter(ctx context.Context, msg jetstream.Msg, reason error) {
+	const op = "subscriber.subscriber.go - deadLetter"
+
+	if err := s.deadLetters.Send(ctx, msg, reason); err != nil {
+		s.logger.Error("Failed to move message to DLQ", slog.Any("error", err.Error()), slog.Any("operation", op))
+		msg.NakWithDelay(s.retry.MaxDelay)
+		return
+	}
+	msg.Term()
+}
+
+func (s *Subscriber) handleMessage(ctx context.Context, data []byte) error {
+	const op = "subscriber.subscriber.go - handleMessage"
+
+	orderRequest, err := decodeNATSReq[model.Order](data)
 	if err != nil {
-		return fmt.Errorf("%s - orderRepo.SaveOrder: %w", op, err)
+		return fmt.Errorf("%s - decodeNATSReq: %w: %w", op, ErrInvalidMessage, err)
 	}
 
-	s.cache.Put(uid, order)
-	s.logger.Debug("Order saved successfully", slog.Any("order_uid", uid), slog.Any("operation", op))
+	_, err = s.orders.Ingest(ctx, orderRequest)
+	if err != nil {
+		if invalidOrder(err) {
+			return fmt.Errorf("%s - orders.Ingest: %w: %w", op, ErrInvalidMessage, err)
+		}
+		return fmt.Errorf("%s - orders.Ingest: %w", op, err)
+	}
 	return nil
 }
+
+// invalidOrder reports whether redelivering the order can't help: it fails
+// validation or conflicts with the saved one.
+func invalidOrder(err error) bool {
+	var validationErr *usecase.ValidationError
+	return errors.As(err, &validationErr) || errors.Is(err, pgdb.ErrConflict)
+}
 func (s *Subscriber) CreateConsumer(ctx context.Context, streamName, consumerName string) (jetstream.Consumer, error) {
 	const op = "subscriber.subscriber.go - createConsumer"
 	consumer, err := s.jetStr.CreateOrUpdateConsumer(ctx, streamName, jetstream.ConsumerConfig{
 		Durable:       consumerName,                // durable name is the same as consumer group name
 		DeliverPolicy: jetstream.DeliverAllPolicy,  // deliver all messages, even if they were sent before the consumer was created
 		AckPolicy:     jetstream.AckExplicitPolicy, // ack messages manually
-		AckWait:       5 * time.Second,             // wait for ack for 5 seconds
-		MaxAckPending: -1,
+		AckWait:       ackWait,                     // wait for ack, redeliver after
+		MaxDeliver:    -1,                          // processMessage enforces the retry policy, so the DLQ can be retried too
+		MaxAckPending: s.pool.MaxAckPending,        // bounds the messages held by the worker pool
 	})
 	if err != nil {
 		s.logger.Error("Failed to create consumer", slog.Any("error", err.Error()), slog.Any("operation", op))
@@ -2,13 +2,18 @@ package natsjs
 
 import (
 	"context"
+	"errors"
 	"log/slog"
 	"os"
 	"testing"
+	"time"
 
+	"github.com/nats-io/nats.go/jetstream"
 	"github.com/stretchr/testify/mock"
 	"github.com/v7ktory/wb_task_one/internal/controller/mocks"
 	"github.com/v7ktory/wb_task_one/internal/entity"
+	"github.com/v7ktory/wb_task_one/internal/repo/pgdb"
+	"github.com/v7ktory/wb_task_one/internal/usecase"
 )
 
 func TestHandleMessage(t *testing.T) {
@@ -108,10 +113,9 @@ func TestHandleMessage(t *testing.T) {
 
 	for _, tt := range tests {
 		s := Subscriber{
-			jetStr:    nil,
-			orderRepo: mockOrder,
-			cache:     mockCache,
-			logger:    mockLogger,
+			jetStr: nil,
+			orders: usecase.NewOrderUseCase(mockOrder, pgdb.WriteStrict, mockCache, nil, mockLogger),
+			logger: mockLogger,
 		}
 		tt.mockSetup()
 		err := s.handleMessage(tt.args.ctx, tt.args.msg)
@@ -121,3 +125,106 @@ func TestHandleMessage(t *testing.T) {
 		}
 	}
 }
+
+func TestProcessMessage(t *testing.T) {
+	mockLogger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	validJSON, _ := os.ReadFile("../../../order.json")
+
+	tests := []struct {
+		name         string
+		saveErr      error
+		numDelivered uint64
+		settled      string
+		delay        time.Duration
+	}{
+		{
+			name:         "Test saved order is acked",
+			numDelivered: 1,
+			settled:      "ack",
+		},
+		{
+			name:         "Test existing order is acked",
+			saveErr:      pgdb.ErrAlreadyExists,
+			numDelivered: 1,
+			settled:      "ack",
+		},
+		{
+			name:         "Test transient error is retried",
+			saveErr:      errors.New("connection refused"),
+			numDelivered: 1,
+			settled:      "nak",
+			delay:        time.Second,
+		},
+		{
+			name:         "Test retry backs off",
+			saveErr:      errors.New("connection refused"),
+			numDelivered: 4,
+			settled:      "nak",
+			delay:        8 * time.Second,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockOrder := mocks.NewOrder(t)
+			mockCache := mocks.NewCache[string, *entity.Order](t)
+			mockOrder.On("SaveOrder", mock.Anything, mock.AnythingOfType("*entity.Order")).Return("b563feb7b2b84b6test", tt.saveErr)
+			if tt.saveErr == nil {
+				mockCache.On("Put", "b563feb7b2b84b6test", mock.AnythingOfType("*entity.Order")).Return()
+			}
+			s := NewSubscriber(nil, usecase.NewOrderUseCase(mockOrder, pgdb.WriteStrict, mockCache, nil, mockLogger), nil, RetryPolicy{}, PoolConfig{}, mockLogger)
+
+			msg := &fakeMsg{data: validJSON, meta: &jetstream.MsgMetadata{NumDelivered: tt.numDelivered}}
+			s.processMessage(context.Background(), msg)
+			if msg.settled != tt.settled || msg.delay != tt.delay {
+				t.Errorf("Expected settled=%v delay=%v, received settled=%v delay=%v", tt.settled, tt.delay, msg.settled, msg.delay)
+			}
+		})
+	}
+}
+
+func TestProcessBatch(t *testing.T) {
+	mockLogger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	validJSON, _ := os.ReadFile("../../../order.json")
+
+	tests := []struct {
+		name    string
+		results []error
+		saveErr error
+		settled []string
+	}{
+		{
+			name:    "Test saved and duplicate orders are acked",
+			results: []error{nil, pgdb.ErrAlreadyExists},
+			settled: []string{"ack", "ack"},
+		},
+		{
+			name:    "Test failed batch is retried",
+			saveErr: errors.New("connection refused"),
+			settled: []string{"nak", "nak"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockOrder := mocks.NewOrder(t)
+			mockCache := mocks.NewCache[string, *entity.Order](t)
+			mockOrder.On("SaveOrders", mock.Anything, mock.AnythingOfType("[]*entity.Order")).Return(tt.results, tt.saveErr)
+			if tt.saveErr == nil {
+				mockCache.On("Put", "b563feb7b2b84b6test", mock.AnythingOfType("*entity.Order")).Return().Once()
+			}
+			s := NewSubscriber(nil, usecase.NewOrderUseCase(mockOrder, pgdb.WriteStrict, mockCache, nil, mockLogger), nil, RetryPolicy{}, PoolConfig{}, mockLogger)
+
+			msgs := []*fakeMsg{
+				{data: validJSON, meta: &jetstream.MsgMetadata{NumDelivered: 1}},
+				{data: validJSON, meta: &jetstream.MsgMetadata{NumDelivered: 1}},
+			}
+			s.processBatch(context.Background(), []jetstream.Msg{msgs[0], msgs[1]})
+			for i, msg := range msgs {
+				if msg.settled != tt.settled[i] {
+					t.Errorf("Expected message %d settled=%v, received=%v", i, tt.settled[i], msg.settled)
+				}
+			}
+		})
+	}
+}
@@ -20,6 +20,9 @@ type (
 		SmID              int
 		DateCreated       time.Time
 		OffShard          string
+		// Version orders the revisions of an order, zero if the producer
+		// doesn't keep track
+		Version int64
 	}
 
 	DeliveryAttrs struct {
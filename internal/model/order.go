@@ -20,6 +20,7 @@ type (
 		SmID              int           `json:"sm_id"`
 		DateCreated       time.Time     `json:"date_created"`
 		OffShard          string        `json:"off_shard"`
+		Version           int64         `json:"version,omitempty"`
 	}
 
 	DeliveryAttrs struct {
@@ -0,0 +1,305 @@
+package archive
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/v7ktory/wb_task_one/internal/entity"
+	"github.com/v7ktory/wb_task_one/internal/repo/pgdb"
+)
+
+const (
+	filePattern = "orders-*.jsonl.gz"
+	// staged files are published by renaming them to the name without it
+	pendingSuffix = ".pending"
+	// staged files left this long by a crash are published on the next scan
+	pendingMaxAge = time.Hour
+	// a found order is also looked up in files published since a scan this old
+	rescanInterval = time.Minute
+)
+
+// FileArchive keeps archived orders in gzip-compressed JSONL files, one file
+// per archived batch. Lookups go through an index of the file holding each
+// order. The directory is scanned for files published by other processes on
+// a missing order, and at most rescanInterval after the last scan otherwise.
+//
+// Every instance and the retention command archive into the directory, so
+// it must be shared by all of them: orders archived to another directory
+// can't be read. The index holds every archived uid, about a hundred bytes
+// each, so archives of tens of millions of orders belong in the table.
+//
+// Files can't take part in the transaction deleting the orders, so they are
+// staged as pending files first and published once it committed.
+type FileArchive struct {
+	dir string
+
+	mu sync.Mutex
+	// files are the names of the indexed files, index maps uids to the
+	// position of the newest file holding them
+	files    []string
+	fileIDs  map[string]int32
+	index    map[string]int32
+	scanned  bool
+	lastScan time.Time
+}
+
+func NewFileArchive(dir string) (*FileArchive, error) {
+	const op = "archive.file.go - NewFileArchive"
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("%s - os.MkdirAll: %w", op, err)
+	}
+	return &FileArchive{
+		dir:     dir,
+		fileIDs: make(map[string]int32),
+		index:   make(map[string]int32),
+	}, nil
+}
+
+// ArchiveOrders writes the orders to a new file and publishes it.
+func (a *FileArchive) ArchiveOrders(ctx context.Context, orders []*entity.Order) error {
+	const op = "archive.file.go - ArchiveOrders"
+
+	staged, err := a.StageOrders(ctx, orders)
+	if err != nil {
+		return fmt.Errorf("%s - %w", op, err)
+	}
+	if err := staged.Publish(); err != nil {
+		return fmt.Errorf("%s - %w", op, err)
+	}
+	return nil
+}
+
+// StageOrders writes the orders to a new pending file. The file appears
+// complete or not at all, and is synced before StageOrders returns, so the
+// orders can be deleted from postgres afterwards.
+func (a *FileArchive) StageOrders(ctx context.Context, orders []*entity.Order) (pgdb.StagedOrders, error) {
+	const op = "archive.file.go - StageOrders"
+
+	// The names sort by creation, so later copies of an order win
+	name := "orders-" + strconv.FormatInt(time.Now().UnixNano(), 10) + ".jsonl.gz"
+	staged := &stagedFile{archive: a, name: name, uids: make([]string, 0, len(orders))}
+	if len(orders) == 0 {
+		return staged, nil
+	}
+
+	tmp, err := os.CreateTemp(a.dir, name+".tmp*")
+	if err != nil {
+		return nil, fmt.Errorf("%s - os.CreateTemp: %w", op, err)
+	}
+	// Both are no-ops once the file is renamed
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	zw := gzip.NewWriter(tmp)
+	enc := json.NewEncoder(zw)
+	for _, order := range orders {
+		if err := enc.Encode(order); err != nil {
+			return nil, fmt.Errorf("%s - enc.Encode: %w", op, err)
+		}
+		staged.uids = append(staged.uids, order.UID)
+	}
+	if err := zw.Close(); err != nil {
+		return nil, fmt.Errorf("%s - zw.Close: %w", op, err)
+	}
+	if err := tmp.Sync(); err != nil {
+		return nil, fmt.Errorf("%s - tmp.Sync: %w", op, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return nil, fmt.Errorf("%s - tmp.Close: %w", op, err)
+	}
+	if err := os.Rename(tmp.Name(), filepath.Join(a.dir, name+pendingSuffix)); err != nil {
+		return nil, fmt.Errorf("%s - os.Rename: %w", op, err)
+	}
+	return staged, nil
+}
+
+// stagedFile is a pending file written by StageOrders.
+type stagedFile struct {
+	archive *FileArchive
+	name    string
+	uids    []string
+}
+
+// Publish renames the pending file, so lookups find its orders.
+func (f *stagedFile) Publish() error {
+	if len(f.uids) == 0 {
+		return nil
+	}
+	path := filepath.Join(f.archive.dir, f.name)
+	if err := os.Rename(path+pendingSuffix, path); err != nil {
+		return fmt.Errorf("os.Rename: %w", err)
+	}
+
+	a := f.archive
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.add(f.name, f.uids)
+	return nil
+}
+
+// Discard removes the pending file.
+func (f *stagedFile) Discard() error {
+	if len(f.uids) == 0 {
+		return nil
+	}
+	if err := os.Remove(filepath.Join(f.archive.dir, f.name+pendingSuffix)); err != nil {
+		return fmt.Errorf("os.Remove: %w", err)
+	}
+	return nil
+}
+
+// GetArchivedOrder reads the order from the newest file holding it.
+func (a *FileArchive) GetArchivedOrder(ctx context.Context, uid string) (*entity.Order, error) {
+	const op = "archive.file.go - GetArchivedOrder"
+
+	name, err := a.lookup(uid)
+	if err != nil {
+		return nil, fmt.Errorf("%s - %w", op, err)
+	}
+	if name == "" {
+		return nil, pgdb.ErrNotFound
+	}
+
+	var found *entity.Order
+	err = readFile(filepath.Join(a.dir, name), func(order *entity.Order) bool {
+		if order.UID == uid {
+			found = order
+			return false
+		}
+		return true
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%s - %w", op, err)
+	}
+	if found == nil {
+		return nil, pgdb.ErrNotFound
+	}
+	return found, nil
+}
+
+// lookup returns the newest file holding the order, or "" if no file does.
+func (a *FileArchive) lookup(uid string) (string, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	id, found := a.index[uid]
+	if found && a.scanned && time.Since(a.lastScan) < rescanInterval {
+		return a.files[id], nil
+	}
+	// Other processes may have archived the order since the last scan
+	if err := a.scan(); err != nil {
+		return "", err
+	}
+	if id, found = a.index[uid]; !found {
+		return "", nil
+	}
+	return a.files[id], nil
+}
+
+// scan indexes the files published since the last scan.
+func (a *FileArchive) scan() error {
+	if err := a.publishAbandoned(); err != nil {
+		return err
+	}
+
+	paths, err := filepath.Glob(filepath.Join(a.dir, filePattern))
+	if err != nil {
+		return fmt.Errorf("filepath.Glob: %w", err)
+	}
+	for _, path := range paths {
+		name := filepath.Base(path)
+		if _, found := a.fileIDs[name]; found {
+			continue
+		}
+		var uids []string
+		err := readFile(path, func(order *entity.Order) bool {
+			uids = append(uids, order.UID)
+			return true
+		})
+		if err != nil {
+			return err
+		}
+		a.add(name, uids)
+	}
+	a.scanned = true
+	a.lastScan = time.Now()
+	return nil
+}
+
+// add indexes the orders of a file, unless a newer file holds them.
+func (a *FileArchive) add(name string, uids []string) {
+	if _, found := a.fileIDs[name]; found {
+		return
+	}
+	id := int32(len(a.files))
+	a.files = append(a.files, name)
+	a.fileIDs[name] = id
+	for _, uid := range uids {
+		// The names sort by creation, files of other processes may show up late
+		if current, found := a.index[uid]; found && a.files[current] > name {
+			continue
+		}
+		a.index[uid] = id
+	}
+}
+
+// publishAbandoned publishes the pending files a crash left between the
+// commit and Publish. Their orders may be gone from postgres. Had the
+// transaction rolled back instead, postgres still has the orders and serves
+// them first, and a later archive of them sorts after the file.
+func (a *FileArchive) publishAbandoned() error {
+	paths, err := filepath.Glob(filepath.Join(a.dir, filePattern+pendingSuffix))
+	if err != nil {
+		return fmt.Errorf("filepath.Glob: %w", err)
+	}
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil || time.Since(info.ModTime()) < pendingMaxAge {
+			// Gone or still owned by a running transaction
+			continue
+		}
+		if err := os.Rename(path, strings.TrimSuffix(path, pendingSuffix)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("os.Rename: %w", err)
+		}
+	}
+	return nil
+}
+
+// readFile calls f for every order of the file until f returns false.
+func readFile(path string, f func(order *entity.Order) bool) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("os.Open: %w", err)
+	}
+	defer file.Close()
+
+	zr, err := gzip.NewReader(bufio.NewReader(file))
+	if err != nil {
+		return fmt.Errorf("%s: gzip.NewReader: %w", path, err)
+	}
+	defer zr.Close()
+
+	dec := json.NewDecoder(zr)
+	for dec.More() {
+		order := new(entity.Order)
+		if err := dec.Decode(order); err != nil {
+			return fmt.Errorf("%s: dec.Decode: %w", path, err)
+		}
+		if !f(order) {
+			return nil
+		}
+	}
+	return nil
+}
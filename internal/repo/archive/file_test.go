@@ -0,0 +1,151 @@
+package archive
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/v7ktory/wb_task_one/internal/entity"
+	"github.com/v7ktory/wb_task_one/internal/repo/pgdb"
+)
+
+func TestFileArchive(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	a, err := NewFileArchive(dir)
+	if err != nil {
+		t.Fatalf("Expected err=%v, received=%v", nil, err)
+	}
+	orders := []*entity.Order{
+		{UID: "a", TrackNumber: "WBILMTESTTRACK", Items: []entity.ItemAttrs{{ChrtID: 9934930}}},
+		{UID: "b", Version: 1},
+	}
+	if err := a.ArchiveOrders(ctx, orders); err != nil {
+		t.Fatalf("Expected err=%v, received=%v", nil, err)
+	}
+	if err := a.ArchiveOrders(ctx, []*entity.Order{{UID: "b", Version: 2}}); err != nil {
+		t.Fatalf("Expected err=%v, received=%v", nil, err)
+	}
+
+	// A new archive builds its index from the files
+	reopened, err := NewFileArchive(dir)
+	if err != nil {
+		t.Fatalf("Expected err=%v, received=%v", nil, err)
+	}
+	for _, archive := range []*FileArchive{a, reopened} {
+		order, err := archive.GetArchivedOrder(ctx, "a")
+		if err != nil {
+			t.Fatalf("Expected err=%v, received=%v", nil, err)
+		}
+		if order.TrackNumber != "WBILMTESTTRACK" || len(order.Items) != 1 || order.Items[0].ChrtID != 9934930 {
+			t.Errorf("Expected order=%+v, received=%+v", orders[0], order)
+		}
+
+		order, err = archive.GetArchivedOrder(ctx, "b")
+		if err != nil {
+			t.Fatalf("Expected err=%v, received=%v", nil, err)
+		}
+		if order.Version != 2 {
+			t.Errorf("Expected version=%v, received=%v", 2, order.Version)
+		}
+
+		if _, err := archive.GetArchivedOrder(ctx, "bogus"); !errors.Is(err, pgdb.ErrNotFound) {
+			t.Errorf("Expected err=%v, received=%v", pgdb.ErrNotFound, err)
+		}
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("Expected err=%v, received=%v", nil, err)
+	}
+	if len(entries) != 2 {
+		t.Errorf("Expected files=%v, received=%v", 2, len(entries))
+	}
+}
+
+func TestFileArchiveStaging(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	a, err := NewFileArchive(dir)
+	if err != nil {
+		t.Fatalf("Expected err=%v, received=%v", nil, err)
+	}
+
+	discarded, err := a.StageOrders(ctx, []*entity.Order{{UID: "a"}})
+	if err != nil {
+		t.Fatalf("Expected err=%v, received=%v", nil, err)
+	}
+	if _, err := a.GetArchivedOrder(ctx, "a"); !errors.Is(err, pgdb.ErrNotFound) {
+		t.Errorf("Expected staged err=%v, received=%v", pgdb.ErrNotFound, err)
+	}
+	if err := discarded.Discard(); err != nil {
+		t.Fatalf("Expected err=%v, received=%v", nil, err)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("Expected files=%v, received=%v", 0, len(entries))
+	}
+
+	published, err := a.StageOrders(ctx, []*entity.Order{{UID: "b"}})
+	if err != nil {
+		t.Fatalf("Expected err=%v, received=%v", nil, err)
+	}
+	if err := published.Publish(); err != nil {
+		t.Fatalf("Expected err=%v, received=%v", nil, err)
+	}
+	if _, err := a.GetArchivedOrder(ctx, "b"); err != nil {
+		t.Errorf("Expected published err=%v, received=%v", nil, err)
+	}
+
+	// A stage abandoned by a crash is published once it is old enough
+	if _, err := a.StageOrders(ctx, []*entity.Order{{UID: "c"}}); err != nil {
+		t.Fatalf("Expected err=%v, received=%v", nil, err)
+	}
+	pending, _ := filepath.Glob(filepath.Join(dir, filePattern+pendingSuffix))
+	if len(pending) != 1 {
+		t.Fatalf("Expected pending files=%v, received=%v", 1, len(pending))
+	}
+	old := time.Now().Add(-2 * pendingMaxAge)
+	if err := os.Chtimes(pending[0], old, old); err != nil {
+		t.Fatalf("Expected err=%v, received=%v", nil, err)
+	}
+	reopened, err := NewFileArchive(dir)
+	if err != nil {
+		t.Fatalf("Expected err=%v, received=%v", nil, err)
+	}
+	if _, err := reopened.GetArchivedOrder(ctx, "c"); err != nil {
+		t.Errorf("Expected abandoned err=%v, received=%v", nil, err)
+	}
+}
+
+func TestFileArchiveSharedDir(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	reader, _ := NewFileArchive(dir)
+	writer, _ := NewFileArchive(dir)
+
+	if err := writer.ArchiveOrders(ctx, []*entity.Order{{UID: "a", Version: 1}}); err != nil {
+		t.Fatalf("Expected err=%v, received=%v", nil, err)
+	}
+	if _, err := reader.GetArchivedOrder(ctx, "a"); err != nil {
+		t.Errorf("Expected err=%v, received=%v", nil, err)
+	}
+
+	// Orders archived by another process after the first lookup
+	if err := writer.ArchiveOrders(ctx, []*entity.Order{{UID: "a", Version: 2}, {UID: "b"}}); err != nil {
+		t.Fatalf("Expected err=%v, received=%v", nil, err)
+	}
+	if _, err := reader.GetArchivedOrder(ctx, "b"); err != nil {
+		t.Errorf("Expected new order err=%v, received=%v", nil, err)
+	}
+	order, err := reader.GetArchivedOrder(ctx, "a")
+	if err != nil {
+		t.Fatalf("Expected err=%v, received=%v", nil, err)
+	}
+	if order.Version != 2 {
+		t.Errorf("Expected version=%v, received=%v", 2, order.Version)
+	}
+}
@@ -0,0 +1,125 @@
+package cache
+
+const (
+	arcT1 segment = iota // seen once recently
+	arcT2                // seen at least twice recently
+	arcB1                // ghosts of entries evicted from T1
+	arcB2                // ghosts of entries evicted from T2
+)
+
+// arcPolicy implements Adaptive Replacement Cache (Megiddo & Modha). The
+// cache is split into T1 for keys seen once and T2 for keys seen again,
+// and ghost lists B1 and B2 remember keys recently evicted from each. A hit
+// in a ghost list shifts the target size p of T1 towards the list that
+// would have kept the key.
+//
+// The cache limits may be in bytes rather than entries, so the number of
+// resident entries stands in for the fixed size c of the paper.
+type arcPolicy[KeyT comparable, ValueT any] struct {
+	t1, t2, b1, b2 *list[KeyT, ValueT]
+	ghosts         map[KeyT]*node[KeyT, ValueT]
+	p              int
+}
+
+func newARCPolicy[KeyT comparable, ValueT any]() *arcPolicy[KeyT, ValueT] {
+	p := &arcPolicy[KeyT, ValueT]{}
+	p.reset()
+	return p
+}
+
+func (p *arcPolicy[KeyT, ValueT]) add(node *node[KeyT, ValueT]) {
+	ghost, found := p.ghosts[node.key]
+	if !found {
+		node.segment = arcT1
+		p.t1.pushToFront(node)
+		return
+	}
+
+	// The key was evicted too early, grow the list it was evicted from
+	switch ghost.segment {
+	case arcB1:
+		p.p = min(p.p+max(p.b2.len/p.b1.len, 1), p.resident())
+		p.b1.remove(ghost)
+	case arcB2:
+		p.p = max(p.p-max(p.b1.len/p.b2.len, 1), 0)
+		p.b2.remove(ghost)
+	}
+	delete(p.ghosts, node.key)
+
+	node.segment = arcT2
+	p.t2.pushToFront(node)
+}
+
+func (p *arcPolicy[KeyT, ValueT]) touch(node *node[KeyT, ValueT]) {
+	if node.segment == arcT1 {
+		p.t1.remove(node)
+		node.segment = arcT2
+		p.t2.pushToFront(node)
+		return
+	}
+	p.t2.moveToFront(node)
+}
+
+func (p *arcPolicy[KeyT, ValueT]) miss(key KeyT) {}
+
+func (p *arcPolicy[KeyT, ValueT]) remove(n *node[KeyT, ValueT], reason EvictionReason) {
+	from := p.t1
+	ghosts := p.b1
+	segment := arcB1
+	if n.segment == arcT2 {
+		from = p.t2
+		ghosts = p.b2
+		segment = arcB2
+	}
+	from.remove(n)
+
+	// Only entries pushed out by the policy are worth remembering
+	if reason != EvictedCapacity {
+		return
+	}
+	ghost := &node[KeyT, ValueT]{key: n.key, segment: segment}
+	ghosts.pushToFront(ghost)
+	p.ghosts[n.key] = ghost
+	p.trimGhosts()
+}
+
+func (p *arcPolicy[KeyT, ValueT]) victim() *node[KeyT, ValueT] {
+	if p.t1.len > 0 && (p.t1.len > p.p || p.t2.len == 0) {
+		return p.t1.back()
+	}
+	return p.t2.back()
+}
+
+func (p *arcPolicy[KeyT, ValueT]) walk(f func(*node[KeyT, ValueT]) bool) {
+	if p.t2.walk(f) {
+		p.t1.walk(f)
+	}
+}
+
+func (p *arcPolicy[KeyT, ValueT]) reset() {
+	p.t1 = newList[KeyT, ValueT]()
+	p.t2 = newList[KeyT, ValueT]()
+	p.b1 = newList[KeyT, ValueT]()
+	p.b2 = newList[KeyT, ValueT]()
+	p.ghosts = make(map[KeyT]*node[KeyT, ValueT])
+	p.p = 0
+}
+
+func (p *arcPolicy[KeyT, ValueT]) resident() int {
+	return p.t1.len + p.t2.len
+}
+
+// trimGhosts keeps the history no larger than the cache itself, dropping
+// the oldest ghosts of the longer list first.
+func (p *arcPolicy[KeyT, ValueT]) trimGhosts() {
+	limit := max(p.resident(), 1)
+	for p.b1.len+p.b2.len > limit {
+		ghosts := p.b2
+		if p.b1.len > p.b2.len {
+			ghosts = p.b1
+		}
+		ghost := ghosts.back()
+		ghosts.remove(ghost)
+		delete(p.ghosts, ghost.key)
+	}
+}
@@ -1,66 +1,347 @@
 package cache
 
 import (
-	"context"
-	"fmt"
-
-	"github.com/v7ktory/wb_task_one/internal/entity"
-	"github.com/v7ktory/wb_task_one/internal/repo/pgdb"
+	"sync"
+	"time"
 )
 
 type Cache[KeyT comparable, ValueT any] interface {
 	Get(key KeyT) (ValueT, bool)
 	Put(key KeyT, value ValueT)
+	PutWithTTL(key KeyT, value ValueT, ttl time.Duration)
+	// PutIfAbsent stores the value with the default TTL unless the key holds
+	// an unexpired value, and reports whether it stored it
+	PutIfAbsent(key KeyT, value ValueT) bool
+	// Peek returns the value without counting it as an access
+	Peek(key KeyT) (ValueT, bool)
+	Delete(key KeyT) bool
+	Len() int
+	// Keys returns the keys ordered from the one the eviction policy values
+	// most to the next victim. For LRU that is most to least recently used.
+	Keys() []KeyT
+	// Range calls f for every entry in the order of Keys until f returns false
+	Range(f func(key KeyT, value ValueT) bool)
+	Purge()
+	Stats() Stats
+	Close()
 }
-type LRUCache[KeyT comparable, ValueT any] struct {
-	capacity int
-	cache    map[KeyT]*node[KeyT, ValueT]
-	list     *list[KeyT, ValueT]
+
+// Stats describes the current occupancy of a cache, its limits and how well
+// it has served lookups so far. A zero limit means the cache is not bounded
+// by that dimension. Evictions count entries dropped for capacity or TTL,
+// but not explicit deletes.
+type Stats struct {
+	Policy     Policy `json:"policy"`
+	Hits       uint64 `json:"hits"`
+	Misses     uint64 `json:"misses"`
+	Evictions  uint64 `json:"evictions"`
+	Entries    int    `json:"entries"`
+	Bytes      int64  `json:"bytes"`
+	MaxEntries int    `json:"max_entries"`
+	MaxBytes   int64  `json:"max_bytes"`
 }
 
-func NewLRUCache[KeyT comparable, ValueT any](capacity int) Cache[KeyT, ValueT] {
-	return &LRUCache[KeyT, ValueT]{
-		capacity: capacity,
-		cache:    make(map[KeyT]*node[KeyT, ValueT]),
-		list:     newList[KeyT, ValueT](),
+// HitRatio returns the share of Get calls that found a value.
+func (s Stats) HitRatio() float64 {
+	if s.Hits+s.Misses == 0 {
+		return 0
 	}
+	return float64(s.Hits) / float64(s.Hits+s.Misses)
+}
+
+// BoundedCache is safe for concurrent use. Every Get updates the eviction
+// policy, so reads take the same exclusive lock as writes.
+//
+// The cache is bounded by the number of entries (capacity) and, when
+// MaxBytes is set, by the estimated size of the entries. A non-positive
+// limit disables the corresponding bound. Which entry goes first when a
+// bound is exceeded is decided by the eviction policy, LRU by default.
+//
+// Entries may carry a time to live. Expired entries are dropped lazily on
+// Get and by a janitor goroutine, which is stopped by Close.
+type BoundedCache[KeyT comparable, ValueT any] struct {
+	mu              sync.Mutex
+	capacity        int
+	maxBytes        int64
+	bytes           int64
+	sizeOf          func(KeyT, ValueT) int64
+	ttl             time.Duration
+	cleanupInterval time.Duration
+	janitor         *janitor
+	onEvict         func(KeyT, ValueT, EvictionReason)
+	now             func() time.Time
+	pending         []eviction[KeyT, ValueT]
+	hits            uint64
+	misses          uint64
+	evictions       uint64
+	policyName      Policy
+	policy          policy[KeyT, ValueT]
+	cache           map[KeyT]*node[KeyT, ValueT]
+}
+
+func NewLRUCache[KeyT comparable, ValueT any](capacity int, opts ...Option[KeyT, ValueT]) Cache[KeyT, ValueT] {
+	c, _ := New(PolicyLRU, capacity, opts...)
+	return c
 }
-func Warmup(ctx context.Context, pgRepo *pgdb.PgRepo, lru Cache[string, *entity.Order]) error {
-	orders, err := pgRepo.GetLRUOrders(ctx)
+
+// New returns a cache evicting entries with the given policy.
+func New[KeyT comparable, ValueT any](policy Policy, capacity int, opts ...Option[KeyT, ValueT]) (Cache[KeyT, ValueT], error) {
+	c, err := newBoundedCache(policy, capacity, opts...)
 	if err != nil {
-		return fmt.Errorf("failed to warm up cache: %w", err)
+		return nil, err
+	}
+	if interval := cleanupInterval(c.cleanupInterval, c.ttl); interval > 0 {
+		c.janitor = startJanitor(interval, c.deleteExpired)
+	}
+	return c, nil
+}
+
+func newBoundedCache[KeyT comparable, ValueT any](policy Policy, capacity int, opts ...Option[KeyT, ValueT]) (*BoundedCache[KeyT, ValueT], error) {
+	c := &BoundedCache[KeyT, ValueT]{
+		capacity:   capacity,
+		policyName: policy,
+		now:        time.Now,
+		cache:      make(map[KeyT]*node[KeyT, ValueT]),
+	}
+
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	var err error
+	c.policy, err = newPolicy[KeyT, ValueT](c.policyName)
+	if err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+func (c *BoundedCache[KeyT, ValueT]) Get(key KeyT) (ValueT, bool) {
+	c.mu.Lock()
+	defer c.unlock()
+
+	if node, found := c.cache[key]; found {
+		if node.expired(c.now()) {
+			c.evict(node, EvictedExpired)
+		} else {
+			c.policy.touch(node)
+			c.hits++
+			return node.value, true
+		}
 	}
-	for _, order := range orders {
-		if order != nil {
-			lru.Put(order.UID, order)
+	c.policy.miss(key)
+	c.misses++
+	var value ValueT
+	return value, false
+}
+
+// Put stores the value with the default TTL of the cache, if any.
+func (c *BoundedCache[KeyT, ValueT]) Put(key KeyT, value ValueT) {
+	c.PutWithTTL(key, value, c.ttl)
+}
+
+// PutWithTTL stores the value for the given duration. A non-positive ttl
+// means the entry never expires.
+func (c *BoundedCache[KeyT, ValueT]) PutWithTTL(key KeyT, value ValueT, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.unlock()
+
+	c.put(key, value, ttl)
+}
+
+func (c *BoundedCache[KeyT, ValueT]) PutIfAbsent(key KeyT, value ValueT) bool {
+	c.mu.Lock()
+	defer c.unlock()
+
+	if node, found := c.cache[key]; found && !node.expired(c.now()) {
+		return false
+	}
+	c.put(key, value, c.ttl)
+	return true
+}
+
+func (c *BoundedCache[KeyT, ValueT]) put(key KeyT, value ValueT, ttl time.Duration) {
+	var expiresAt time.Time
+	if ttl > 0 {
+		expiresAt = c.now().Add(ttl)
+	}
+
+	size := c.size(key, value)
+	if c.maxBytes > 0 && size > c.maxBytes {
+		// The entry can never fit, so don't flush the whole cache for it
+		if node, found := c.cache[key]; found {
+			c.evict(node, EvictedCapacity)
 		}
+		return
 	}
 
-	return nil
+	if existing, found := c.cache[key]; found {
+		c.policy.touch(existing)
+		c.bytes += size - existing.size
+		existing.value = value
+		existing.size = size
+		existing.expiresAt = expiresAt
+		c.makeRoom(0, 0)
+		return
+	}
+
+	// Make room first, so the policy can't pick the new entry as the victim
+	c.makeRoom(1, size)
+	newNode := &node[KeyT, ValueT]{key: key, value: value, size: size, expiresAt: expiresAt}
+	c.policy.add(newNode)
+	c.cache[key] = newNode
+	c.bytes += size
+}
+
+func (c *BoundedCache[KeyT, ValueT]) Stats() Stats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return Stats{
+		Policy:     c.policyName,
+		Hits:       c.hits,
+		Misses:     c.misses,
+		Evictions:  c.evictions,
+		Entries:    len(c.cache),
+		Bytes:      c.bytes,
+		MaxEntries: c.capacity,
+		MaxBytes:   c.maxBytes,
+	}
 }
-func (lru *LRUCache[KeyT, ValueT]) Get(key KeyT) (ValueT, bool) {
-	if node, found := lru.cache[key]; found {
-		lru.list.moveToFront(node)
+
+func (c *BoundedCache[KeyT, ValueT]) Peek(key KeyT) (ValueT, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if node, found := c.cache[key]; found && !node.expired(c.now()) {
 		return node.value, true
 	}
 	var value ValueT
 	return value, false
 }
 
-func (lru *LRUCache[KeyT, ValueT]) Put(key KeyT, value ValueT) {
-	if node, found := lru.cache[key]; found {
-		lru.list.moveToFront(node)
-		node.value = value
-		return
+// Delete removes the key and reports whether it was present.
+func (c *BoundedCache[KeyT, ValueT]) Delete(key KeyT) bool {
+	c.mu.Lock()
+	defer c.unlock()
+
+	node, found := c.cache[key]
+	if !found {
+		return false
+	}
+	c.evict(node, EvictedDeleted)
+	return true
+}
+
+// Len returns the number of entries, including expired ones the janitor
+// hasn't swept yet.
+func (c *BoundedCache[KeyT, ValueT]) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return len(c.cache)
+}
+
+func (c *BoundedCache[KeyT, ValueT]) Keys() []KeyT {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	keys := make([]KeyT, 0, len(c.cache))
+	c.policy.walk(func(node *node[KeyT, ValueT]) bool {
+		if !node.expired(now) {
+			keys = append(keys, node.key)
+		}
+		return true
+	})
+	return keys
+}
+
+// Range works on a copy of the entries, so f may safely call back into the
+// cache, but won't see changes made after Range started.
+func (c *BoundedCache[KeyT, ValueT]) Range(f func(key KeyT, value ValueT) bool) {
+	for _, e := range c.entries() {
+		if !f(e.key, e.value) {
+			return
+		}
+	}
+}
+
+func (c *BoundedCache[KeyT, ValueT]) Purge() {
+	c.mu.Lock()
+	defer c.unlock()
+
+	if c.onEvict != nil {
+		c.policy.walk(func(node *node[KeyT, ValueT]) bool {
+			c.pending = append(c.pending, eviction[KeyT, ValueT]{node.key, node.value, EvictedDeleted})
+			return true
+		})
 	}
-	if len(lru.cache) == lru.capacity {
-		back := lru.list.back()
-		if back != nil {
-			lru.list.remove(back)
-			delete(lru.cache, back.key)
+	c.cache = make(map[KeyT]*node[KeyT, ValueT])
+	c.policy.reset()
+	c.bytes = 0
+}
+
+// Close stops the janitor. The cache stays usable, but expired entries are
+// then only dropped on access.
+func (c *BoundedCache[KeyT, ValueT]) Close() {
+	c.janitor.Stop()
+}
+
+func (c *BoundedCache[KeyT, ValueT]) deleteExpired() {
+	c.mu.Lock()
+	defer c.unlock()
+
+	now := c.now()
+	for _, node := range c.cache {
+		if node.expired(now) {
+			c.evict(node, EvictedExpired)
 		}
 	}
-	newNode := &node[KeyT, ValueT]{key, value, nil, nil}
-	lru.list.pushToFront(newNode)
-	lru.cache[key] = newNode
+}
+
+type entry[KeyT comparable, ValueT any] struct {
+	key   KeyT
+	value ValueT
+}
+
+func (c *BoundedCache[KeyT, ValueT]) entries() []entry[KeyT, ValueT] {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	entries := make([]entry[KeyT, ValueT], 0, len(c.cache))
+	c.policy.walk(func(node *node[KeyT, ValueT]) bool {
+		if !node.expired(now) {
+			entries = append(entries, entry[KeyT, ValueT]{node.key, node.value})
+		}
+		return true
+	})
+	return entries
+}
+
+// makeRoom evicts entries until the given number of entries and bytes can
+// be added without exceeding the limits.
+func (c *BoundedCache[KeyT, ValueT]) makeRoom(entries int, bytes int64) {
+	for c.overflows(entries, bytes) {
+		victim := c.policy.victim()
+		if victim == nil {
+			return
+		}
+		c.evict(victim, EvictedCapacity)
+	}
+}
+
+func (c *BoundedCache[KeyT, ValueT]) overflows(entries int, bytes int64) bool {
+	if c.capacity > 0 && len(c.cache)+entries > c.capacity {
+		return true
+	}
+	return c.maxBytes > 0 && c.bytes+bytes > c.maxBytes
+}
+
+func (c *BoundedCache[KeyT, ValueT]) size(key KeyT, value ValueT) int64 {
+	if c.sizeOf == nil {
+		return 0
+	}
+	return c.sizeOf(key, value)
 }
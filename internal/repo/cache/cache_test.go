@@ -1,7 +1,9 @@
 package cache
 
 import (
+	"sync"
 	"testing"
+	"time"
 )
 
 func TestGet(t *testing.T) {
@@ -77,3 +79,523 @@ func TestGet(t *testing.T) {
 		})
 	}
 }
+
+func TestConcurrentAccess(t *testing.T) {
+	tests := []struct {
+		name  string
+		cache Cache[int, int]
+	}{
+		{
+			name:  "Test LRU cache",
+			cache: NewLRUCache[int, int](100),
+		},
+		{
+			name:  "Test sharded LRU cache",
+			cache: NewShardedLRUCache[int, int](8, 100),
+		},
+	}
+
+	const (
+		goroutines = 32
+		iterations = 1000
+	)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var wg sync.WaitGroup
+			for g := 0; g < goroutines; g++ {
+				wg.Add(1)
+				go func(g int) {
+					defer wg.Done()
+					for i := 0; i < iterations; i++ {
+						key := (g*iterations + i) % 200
+						if i%2 == 0 {
+							tt.cache.Put(key, key)
+							continue
+						}
+						if value, found := tt.cache.Get(key); found && value != key {
+							t.Errorf("Expected value=%v, received=%v", key, value)
+						}
+					}
+				}(g)
+			}
+			wg.Wait()
+		})
+	}
+}
+
+func TestShardedCapacity(t *testing.T) {
+	cache := NewShardedLRUCache[int, int](4, 40)
+	for i := 0; i < 1000; i++ {
+		cache.Put(i, i)
+	}
+
+	found := 0
+	for i := 0; i < 1000; i++ {
+		if _, ok := cache.Get(i); ok {
+			found++
+		}
+	}
+	if found > 40 {
+		t.Errorf("Expected at most %v entries, received=%v", 40, found)
+	}
+}
+
+func TestMaxBytes(t *testing.T) {
+	sizeOf := func(key string, value string) int64 { return int64(len(value)) }
+	cache := NewLRUCache(0, MaxBytes[string, string](10), SizeFunc(sizeOf))
+
+	tests := []struct {
+		name      string
+		operation func()
+		key       string
+		expected  string
+		found     bool
+		bytes     int64
+	}{
+		{
+			name: "Test key1 addition",
+			operation: func() {
+				cache.Put("key1", "12345")
+			},
+			key:      "key1",
+			expected: "12345",
+			found:    true,
+			bytes:    5,
+		},
+		{
+			name: "Test key2 addition within budget",
+			operation: func() {
+				cache.Put("key2", "1234")
+			},
+			key:      "key1",
+			expected: "12345",
+			found:    true,
+			bytes:    9,
+		},
+		{
+			name: "Test key3 addition evicts LRU tail",
+			operation: func() {
+				cache.Put("key3", "123")
+			},
+			key:      "key2",
+			expected: "",
+			found:    false,
+			bytes:    8,
+		},
+		{
+			name: "Test key1 growth evicts other keys",
+			operation: func() {
+				cache.Put("key1", "123456789")
+			},
+			key:      "key3",
+			expected: "",
+			found:    false,
+			bytes:    9,
+		},
+		{
+			name: "Test oversized value is not cached",
+			operation: func() {
+				cache.Put("key4", "12345678901")
+			},
+			key:      "key4",
+			expected: "",
+			found:    false,
+			bytes:    9,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.operation()
+			value, found := cache.Get(tt.key)
+			if found != tt.found {
+				t.Errorf("Expected found=%v, received=%v", tt.found, found)
+			}
+			if value != tt.expected {
+				t.Errorf("Expected value=%v, received=%v", tt.expected, value)
+			}
+			if bytes := cache.Stats().Bytes; bytes != tt.bytes {
+				t.Errorf("Expected bytes=%v, received=%v", tt.bytes, bytes)
+			}
+		})
+	}
+}
+
+// fakeClock is a clock for the Clock option that only moves when advanced.
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+func TestTTL(t *testing.T) {
+	clock := newFakeClock()
+	cache := NewLRUCache(10, TTL[string, string](time.Hour), Clock[string, string](clock.Now))
+	defer cache.Close()
+
+	cache.Put("default", "content")
+	cache.PutWithTTL("short", "content", 10*time.Millisecond)
+	cache.PutWithTTL("forever", "content", 0)
+	clock.Advance(20 * time.Millisecond)
+
+	tests := []struct {
+		name  string
+		key   string
+		found bool
+	}{
+		{
+			name:  "Test entry with default TTL",
+			key:   "default",
+			found: true,
+		},
+		{
+			name:  "Test expired entry",
+			key:   "short",
+			found: false,
+		},
+		{
+			name:  "Test entry without TTL",
+			key:   "forever",
+			found: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, found := cache.Get(tt.key); found != tt.found {
+				t.Errorf("Expected found=%v, received=%v", tt.found, found)
+			}
+		})
+	}
+
+	if entries := cache.Stats().Entries; entries != 2 {
+		t.Errorf("Expected entries=%v, received=%v", 2, entries)
+	}
+}
+
+func TestJanitor(t *testing.T) {
+	clock := newFakeClock()
+	opts := []Option[string, string]{
+		TTL[string, string](time.Minute),
+		CleanupInterval[string, string](time.Millisecond),
+		Clock[string, string](clock.Now),
+	}
+
+	tests := []struct {
+		name  string
+		cache Cache[string, string]
+	}{
+		{
+			name:  "Test LRU cache",
+			cache: NewLRUCache(10, opts...),
+		},
+		{
+			name:  "Test sharded LRU cache",
+			cache: NewShardedLRUCache(4, 10, opts...),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer tt.cache.Close()
+
+			tt.cache.Put("key1", "content1")
+			tt.cache.Put("key2", "content2")
+			clock.Advance(2 * time.Minute)
+
+			// The janitor runs on a real ticker, so wait for its next sweeps
+			// with a deadline instead of for a fixed time
+			deadline := time.Now().Add(5 * time.Second)
+			for tt.cache.Stats().Entries != 0 && time.Now().Before(deadline) {
+				time.Sleep(time.Millisecond)
+			}
+			if entries := tt.cache.Stats().Entries; entries != 0 {
+				t.Errorf("Expected entries=%v, received=%v", 0, entries)
+			}
+		})
+	}
+}
+
+func TestOperations(t *testing.T) {
+	cache := NewLRUCache[string, string](3)
+	cache.Put("key1", "content1")
+	cache.Put("key2", "content2")
+	cache.Put("key3", "content3")
+
+	tests := []struct {
+		name      string
+		operation func(t *testing.T)
+		keys      []string
+	}{
+		{
+			name:      "Test keys are ordered by recency",
+			operation: func(t *testing.T) {},
+			keys:      []string{"key3", "key2", "key1"},
+		},
+		{
+			name: "Test peek doesn't promote",
+			operation: func(t *testing.T) {
+				if value, found := cache.Peek("key1"); !found || value != "content1" {
+					t.Errorf("Expected value=%v, received=%v", "content1", value)
+				}
+			},
+			keys: []string{"key3", "key2", "key1"},
+		},
+		{
+			name: "Test get promotes",
+			operation: func(t *testing.T) {
+				cache.Get("key1")
+			},
+			keys: []string{"key1", "key3", "key2"},
+		},
+		{
+			name: "Test peek of missing key",
+			operation: func(t *testing.T) {
+				if _, found := cache.Peek("key4"); found {
+					t.Errorf("Expected found=%v, received=%v", false, found)
+				}
+			},
+			keys: []string{"key1", "key3", "key2"},
+		},
+		{
+			name: "Test put if absent keeps present value",
+			operation: func(t *testing.T) {
+				if stored := cache.PutIfAbsent("key2", "other"); stored {
+					t.Errorf("Expected stored=%v, received=%v", false, stored)
+				}
+				if value, _ := cache.Peek("key2"); value != "content2" {
+					t.Errorf("Expected value=%v, received=%v", "content2", value)
+				}
+			},
+			keys: []string{"key1", "key3", "key2"},
+		},
+		{
+			name: "Test delete",
+			operation: func(t *testing.T) {
+				if deleted := cache.Delete("key3"); !deleted {
+					t.Errorf("Expected deleted=%v, received=%v", true, deleted)
+				}
+			},
+			keys: []string{"key1", "key2"},
+		},
+		{
+			name: "Test delete of missing key",
+			operation: func(t *testing.T) {
+				if deleted := cache.Delete("key3"); deleted {
+					t.Errorf("Expected deleted=%v, received=%v", false, deleted)
+				}
+			},
+			keys: []string{"key1", "key2"},
+		},
+		{
+			name: "Test range stops when f returns false",
+			operation: func(t *testing.T) {
+				var visited []string
+				cache.Range(func(key, value string) bool {
+					visited = append(visited, key)
+					return false
+				})
+				if len(visited) != 1 || visited[0] != "key1" {
+					t.Errorf("Expected visited=%v, received=%v", []string{"key1"}, visited)
+				}
+			},
+			keys: []string{"key1", "key2"},
+		},
+		{
+			name: "Test range may modify the cache",
+			operation: func(t *testing.T) {
+				cache.Range(func(key, value string) bool {
+					cache.Put(key+"-copy", value)
+					return true
+				})
+			},
+			keys: []string{"key2-copy", "key1-copy", "key1"},
+		},
+		{
+			name: "Test purge",
+			operation: func(t *testing.T) {
+				cache.Purge()
+			},
+			keys: []string{},
+		},
+		{
+			name: "Test cache is usable after purge",
+			operation: func(t *testing.T) {
+				cache.Put("key1", "content1")
+			},
+			keys: []string{"key1"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.operation(t)
+			keys := cache.Keys()
+			if len(keys) != len(tt.keys) {
+				t.Fatalf("Expected keys=%v, received=%v", tt.keys, keys)
+			}
+			for i := range keys {
+				if keys[i] != tt.keys[i] {
+					t.Errorf("Expected keys=%v, received=%v", tt.keys, keys)
+				}
+			}
+			if n := cache.Len(); n != len(tt.keys) {
+				t.Errorf("Expected len=%v, received=%v", len(tt.keys), n)
+			}
+		})
+	}
+}
+
+func TestShardedOperations(t *testing.T) {
+	cache := NewShardedLRUCache[int, int](4, 100)
+	for i := 0; i < 50; i++ {
+		cache.Put(i, i)
+	}
+
+	tests := []struct {
+		name      string
+		operation func()
+		len       int
+	}{
+		{
+			name:      "Test len sums shards",
+			operation: func() {},
+			len:       50,
+		},
+		{
+			name: "Test delete",
+			operation: func() {
+				cache.Delete(10)
+				cache.Delete(20)
+			},
+			len: 48,
+		},
+		{
+			name:      "Test purge",
+			operation: cache.Purge,
+			len:       0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.operation()
+			if n := cache.Len(); n != tt.len {
+				t.Errorf("Expected len=%v, received=%v", tt.len, n)
+			}
+			if n := len(cache.Keys()); n != tt.len {
+				t.Errorf("Expected keys=%v, received=%v", tt.len, n)
+			}
+			visited := 0
+			cache.Range(func(key, value int) bool {
+				visited++
+				return true
+			})
+			if visited != tt.len {
+				t.Errorf("Expected visited=%v, received=%v", tt.len, visited)
+			}
+		})
+	}
+}
+
+func TestEvictionsAndStats(t *testing.T) {
+	var evicted []string
+	onEvict := func(key, value string, reason EvictionReason) {
+		evicted = append(evicted, key+":"+reason.String())
+	}
+	clock := newFakeClock()
+	cache := NewLRUCache(2, OnEvict(onEvict), Clock[string, string](clock.Now))
+
+	tests := []struct {
+		name      string
+		operation func()
+		evicted   []string
+		stats     Stats
+	}{
+		{
+			name: "Test hit and miss",
+			operation: func() {
+				cache.Put("key1", "content1")
+				cache.Get("key1")
+				cache.Get("key2")
+			},
+			evicted: nil,
+			stats:   Stats{Policy: PolicyLRU, Hits: 1, Misses: 1, Entries: 1, MaxEntries: 2},
+		},
+		{
+			name: "Test capacity eviction",
+			operation: func() {
+				cache.Put("key2", "content2")
+				cache.Put("key3", "content3")
+			},
+			evicted: []string{"key1:capacity"},
+			stats:   Stats{Policy: PolicyLRU, Hits: 1, Misses: 1, Evictions: 1, Entries: 2, MaxEntries: 2},
+		},
+		{
+			name: "Test expiry",
+			operation: func() {
+				cache.PutWithTTL("key2", "content2", time.Nanosecond)
+				clock.Advance(time.Millisecond)
+				cache.Get("key2")
+			},
+			evicted: []string{"key1:capacity", "key2:expired"},
+			stats:   Stats{Policy: PolicyLRU, Hits: 1, Misses: 2, Evictions: 2, Entries: 1, MaxEntries: 2},
+		},
+		{
+			name: "Test explicit delete",
+			operation: func() {
+				cache.Delete("key3")
+			},
+			evicted: []string{"key1:capacity", "key2:expired", "key3:deleted"},
+			stats:   Stats{Policy: PolicyLRU, Hits: 1, Misses: 2, Evictions: 2, Entries: 0, MaxEntries: 2},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.operation()
+			if len(evicted) != len(tt.evicted) {
+				t.Fatalf("Expected evicted=%v, received=%v", tt.evicted, evicted)
+			}
+			for i := range evicted {
+				if evicted[i] != tt.evicted[i] {
+					t.Errorf("Expected evicted=%v, received=%v", tt.evicted, evicted)
+				}
+			}
+			if stats := cache.Stats(); stats != tt.stats {
+				t.Errorf("Expected stats=%+v, received=%+v", tt.stats, stats)
+			}
+		})
+	}
+}
+
+func TestOnEvictMayUseCache(t *testing.T) {
+	var cache Cache[string, string]
+	cache = NewLRUCache(1, OnEvict(func(key, value string, reason EvictionReason) {
+		// Would deadlock if called under the cache lock
+		cache.Peek(key)
+	}))
+
+	cache.Put("key1", "content1")
+	cache.Put("key2", "content2")
+
+	if n := cache.Len(); n != 1 {
+		t.Errorf("Expected len=%v, received=%v", 1, n)
+	}
+}
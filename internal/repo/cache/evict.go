@@ -0,0 +1,57 @@
+package cache
+
+// EvictionReason tells an OnEvict callback why an entry left the cache.
+type EvictionReason int
+
+const (
+	// EvictedCapacity means the entry was dropped to fit the entry or byte limit
+	EvictedCapacity EvictionReason = iota
+	// EvictedExpired means the entry outlived its TTL
+	EvictedExpired
+	// EvictedDeleted means the entry was removed by Delete or Purge
+	EvictedDeleted
+)
+
+func (r EvictionReason) String() string {
+	switch r {
+	case EvictedCapacity:
+		return "capacity"
+	case EvictedExpired:
+		return "expired"
+	case EvictedDeleted:
+		return "deleted"
+	}
+	return "unknown"
+}
+
+type eviction[KeyT comparable, ValueT any] struct {
+	key    KeyT
+	value  ValueT
+	reason EvictionReason
+}
+
+// evict removes the node and queues the OnEvict notification. Callers must
+// hold the lock and release it with unlock, which delivers the notifications.
+func (c *BoundedCache[KeyT, ValueT]) evict(node *node[KeyT, ValueT], reason EvictionReason) {
+	c.policy.remove(node, reason)
+	delete(c.cache, node.key)
+	c.bytes -= node.size
+	if reason != EvictedDeleted {
+		c.evictions++
+	}
+	if c.onEvict != nil {
+		c.pending = append(c.pending, eviction[KeyT, ValueT]{node.key, node.value, reason})
+	}
+}
+
+// unlock releases the lock and only then runs the OnEvict callback, so the
+// callback may call back into the cache.
+func (c *BoundedCache[KeyT, ValueT]) unlock() {
+	pending := c.pending
+	c.pending = nil
+	c.mu.Unlock()
+
+	for _, e := range pending {
+		c.onEvict(e.key, e.value, e.reason)
+	}
+}
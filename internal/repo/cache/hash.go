@@ -0,0 +1,17 @@
+package cache
+
+import (
+	"fmt"
+	"hash/maphash"
+)
+
+// hashKey hashes any comparable key. Order UIDs are strings, so that case
+// avoids formatting the key.
+func hashKey[KeyT comparable](seed maphash.Seed, key KeyT) uint64 {
+	switch k := any(key).(type) {
+	case string:
+		return maphash.String(seed, k)
+	default:
+		return maphash.String(seed, fmt.Sprint(k))
+	}
+}
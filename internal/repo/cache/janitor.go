@@ -0,0 +1,64 @@
+package cache
+
+import (
+	"sync"
+	"time"
+)
+
+const defaultCleanupInterval = time.Minute
+
+// janitor periodically removes expired entries in the background until
+// stopped.
+type janitor struct {
+	stop chan struct{}
+	done chan struct{}
+	once sync.Once
+}
+
+func startJanitor(interval time.Duration, cleanup func()) *janitor {
+	j := &janitor{
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+
+	go func() {
+		defer close(j.done)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				cleanup()
+			case <-j.stop:
+				return
+			}
+		}
+	}()
+
+	return j
+}
+
+// Stop is safe to call on a nil janitor and more than once.
+func (j *janitor) Stop() {
+	if j == nil {
+		return
+	}
+	j.once.Do(func() {
+		close(j.stop)
+	})
+	<-j.done
+}
+
+// cleanupInterval returns how often expired entries should be swept, or zero
+// if the cache doesn't need a janitor.
+func cleanupInterval(interval, ttl time.Duration) time.Duration {
+	if interval > 0 {
+		return interval
+	}
+	if ttl > 0 {
+		return min(ttl, defaultCleanupInterval)
+	}
+	return 0
+}
@@ -0,0 +1,94 @@
+package cache
+
+import (
+	"container/heap"
+	"sort"
+)
+
+// lfuPolicy keeps nodes in a min-heap ordered by access count and, among
+// equally frequent nodes, by the time of the last access.
+type lfuPolicy[KeyT comparable, ValueT any] struct {
+	heap lfuHeap[KeyT, ValueT]
+	tick uint64
+}
+
+func newLFUPolicy[KeyT comparable, ValueT any]() *lfuPolicy[KeyT, ValueT] {
+	return &lfuPolicy[KeyT, ValueT]{}
+}
+
+func (p *lfuPolicy[KeyT, ValueT]) add(node *node[KeyT, ValueT]) {
+	p.tick++
+	node.freq = 1
+	node.tick = p.tick
+	heap.Push(&p.heap, node)
+}
+
+func (p *lfuPolicy[KeyT, ValueT]) touch(node *node[KeyT, ValueT]) {
+	p.tick++
+	node.freq++
+	node.tick = p.tick
+	heap.Fix(&p.heap, node.index)
+}
+
+func (p *lfuPolicy[KeyT, ValueT]) miss(key KeyT) {}
+
+func (p *lfuPolicy[KeyT, ValueT]) remove(node *node[KeyT, ValueT], reason EvictionReason) {
+	heap.Remove(&p.heap, node.index)
+}
+
+func (p *lfuPolicy[KeyT, ValueT]) victim() *node[KeyT, ValueT] {
+	if len(p.heap) == 0 {
+		return nil
+	}
+	return p.heap[0]
+}
+
+// walk sorts a copy of the heap, it is meant for diagnostics only.
+func (p *lfuPolicy[KeyT, ValueT]) walk(f func(*node[KeyT, ValueT]) bool) {
+	nodes := make(lfuHeap[KeyT, ValueT], len(p.heap))
+	copy(nodes, p.heap)
+	sort.Slice(nodes, func(i, j int) bool {
+		return nodes.Less(j, i)
+	})
+	for _, node := range nodes {
+		if !f(node) {
+			return
+		}
+	}
+}
+
+func (p *lfuPolicy[KeyT, ValueT]) reset() {
+	p.heap = nil
+}
+
+type lfuHeap[KeyT comparable, ValueT any] []*node[KeyT, ValueT]
+
+func (h lfuHeap[KeyT, ValueT]) Len() int { return len(h) }
+
+func (h lfuHeap[KeyT, ValueT]) Less(i, j int) bool {
+	if h[i].freq != h[j].freq {
+		return h[i].freq < h[j].freq
+	}
+	return h[i].tick < h[j].tick
+}
+
+func (h lfuHeap[KeyT, ValueT]) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *lfuHeap[KeyT, ValueT]) Push(x any) {
+	node := x.(*node[KeyT, ValueT])
+	node.index = len(*h)
+	*h = append(*h, node)
+}
+
+func (h *lfuHeap[KeyT, ValueT]) Pop() any {
+	old := *h
+	n := len(old)
+	node := old[n-1]
+	old[n-1] = nil
+	*h = old[:n-1]
+	return node
+}
@@ -1,23 +1,38 @@
 package cache
 
+import "time"
+
 type node[KeyT comparable, ValueT any] struct {
-	key   KeyT
-	value ValueT
-	prev  *node[KeyT, ValueT]
-	next  *node[KeyT, ValueT]
+	key       KeyT
+	value     ValueT
+	size      int64
+	expiresAt time.Time
+	prev      *node[KeyT, ValueT]
+	next      *node[KeyT, ValueT]
+
+	// Bookkeeping of the eviction policy
+	segment segment
+	freq    uint64
+	tick    uint64
+	index   int
+}
+
+func (n *node[KeyT, ValueT]) expired(now time.Time) bool {
+	return !n.expiresAt.IsZero() && now.After(n.expiresAt)
 }
 
 type list[KeyT comparable, ValueT any] struct {
 	head *node[KeyT, ValueT]
 	tail *node[KeyT, ValueT]
+	len  int
 }
 
 func newList[KeyT comparable, ValueT any]() *list[KeyT, ValueT] {
 	var key KeyT
 	var value ValueT
 	list := &list[KeyT, ValueT]{
-		head: &node[KeyT, ValueT]{key, value, nil, nil},
-		tail: &node[KeyT, ValueT]{key, value, nil, nil},
+		head: &node[KeyT, ValueT]{key: key, value: value},
+		tail: &node[KeyT, ValueT]{key: key, value: value},
 	}
 	list.head.next = list.tail
 	list.tail.prev = list.head
@@ -29,16 +44,20 @@ func (l *list[KeyT, ValueT]) pushToFront(node *node[KeyT, ValueT]) {
 	node.next = l.head.next
 	l.head.next.prev = node
 	l.head.next = node
+	l.len++
 }
 
 func (l *list[KeyT, ValueT]) remove(node *node[KeyT, ValueT]) {
-	if node == nil {
+	if node == nil || node.prev == nil {
 		return
 	}
 	prev := node.prev
 	next := node.next
 	prev.next = next
 	next.prev = prev
+	node.prev = nil
+	node.next = nil
+	l.len--
 }
 
 func (l *list[KeyT, ValueT]) moveToFront(node *node[KeyT, ValueT]) {
@@ -50,8 +69,33 @@ func (l *list[KeyT, ValueT]) moveToFront(node *node[KeyT, ValueT]) {
 }
 
 func (l *list[KeyT, ValueT]) back() *node[KeyT, ValueT] {
-	if l.tail == l.head {
+	if l.tail.prev == l.head {
 		return nil
 	}
 	return l.tail.prev
 }
+
+func (l *list[KeyT, ValueT]) front() *node[KeyT, ValueT] {
+	if l.head.next == l.tail {
+		return nil
+	}
+	return l.head.next
+}
+
+func (l *list[KeyT, ValueT]) next(node *node[KeyT, ValueT]) *node[KeyT, ValueT] {
+	if node.next == l.tail {
+		return nil
+	}
+	return node.next
+}
+
+// walk calls f from the front to the back until f returns false, and
+// reports whether it got to the end.
+func (l *list[KeyT, ValueT]) walk(f func(*node[KeyT, ValueT]) bool) bool {
+	for node := l.front(); node != nil; node = l.next(node) {
+		if !f(node) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,191 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/v7ktory/wb_task_one/internal/entity"
+	"github.com/v7ktory/wb_task_one/internal/repo/pgdb"
+)
+
+const (
+	defaultNegativeTTL      = 30 * time.Second
+	defaultNegativeCapacity = 100_000
+	defaultLoadTimeout      = 5 * time.Second
+)
+
+// ErrNotFound is returned by a LoaderFunc when the key doesn't exist in the
+// underlying store.
+var ErrNotFound = errors.New("not found")
+
+type LoaderFunc[KeyT comparable, ValueT any] func(ctx context.Context, key KeyT) (ValueT, error)
+
+// ReadThrough wraps a cache and loads missing entries from the underlying
+// store. Concurrent misses for the same key share one load, and keys the
+// store doesn't know are remembered for a short time, so repeated lookups
+// of bogus keys don't reach the store at all.
+type ReadThrough[KeyT comparable, ValueT any] struct {
+	Cache[KeyT, ValueT]
+
+	load        LoaderFunc[KeyT, ValueT]
+	loadTimeout time.Duration
+	flights     group[KeyT, ValueT]
+
+	missing          *BoundedCache[KeyT, struct{}]
+	negativeTTL      time.Duration
+	negativeCapacity int
+}
+
+type ReadThroughOption[KeyT comparable, ValueT any] func(*ReadThrough[KeyT, ValueT])
+
+// NegativeTTL sets how long a key reported missing by the store is answered
+// with ErrNotFound without asking the store again. Zero disables negative
+// caching.
+func NegativeTTL[KeyT comparable, ValueT any](ttl time.Duration) ReadThroughOption[KeyT, ValueT] {
+	return func(r *ReadThrough[KeyT, ValueT]) {
+		r.negativeTTL = ttl
+	}
+}
+
+// NegativeCapacity bounds the number of remembered missing keys.
+func NegativeCapacity[KeyT comparable, ValueT any](capacity int) ReadThroughOption[KeyT, ValueT] {
+	return func(r *ReadThrough[KeyT, ValueT]) {
+		r.negativeCapacity = capacity
+	}
+}
+
+// LoadTimeout bounds a single load from the store.
+func LoadTimeout[KeyT comparable, ValueT any](timeout time.Duration) ReadThroughOption[KeyT, ValueT] {
+	return func(r *ReadThrough[KeyT, ValueT]) {
+		r.loadTimeout = timeout
+	}
+}
+
+func NewReadThrough[KeyT comparable, ValueT any](cache Cache[KeyT, ValueT], load LoaderFunc[KeyT, ValueT], opts ...ReadThroughOption[KeyT, ValueT]) *ReadThrough[KeyT, ValueT] {
+	r := &ReadThrough[KeyT, ValueT]{
+		Cache:            cache,
+		load:             load,
+		loadTimeout:      defaultLoadTimeout,
+		negativeTTL:      defaultNegativeTTL,
+		negativeCapacity: defaultNegativeCapacity,
+	}
+
+	for _, opt := range opts {
+		opt(r)
+	}
+
+	r.missing, _ = newBoundedCache(PolicyLRU, r.negativeCapacity, TTL[KeyT, struct{}](r.negativeTTL))
+
+	return r
+}
+
+// Fetch returns the cached value or loads it from the store and caches it.
+// It returns ErrNotFound if the store doesn't have the key.
+func (r *ReadThrough[KeyT, ValueT]) Fetch(ctx context.Context, key KeyT) (ValueT, error) {
+	if value, found := r.Cache.Get(key); found {
+		return value, nil
+	}
+
+	var zero ValueT
+	if r.negativeTTL > 0 {
+		if _, missing := r.missing.Get(key); missing {
+			return zero, ErrNotFound
+		}
+	}
+
+	// The load is shared with other callers, so it must not be aborted
+	// when the caller that happened to start it goes away
+	value, err := r.flights.do(key, func() (ValueT, error) {
+		loadCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), r.loadTimeout)
+		defer cancel()
+
+		value, err := r.load(loadCtx, key)
+		if err != nil {
+			if errors.Is(err, ErrNotFound) && r.negativeTTL > 0 {
+				r.missing.Put(key, struct{}{})
+			}
+			return zero, err
+		}
+		// A value Put while the load ran is newer than the loaded one
+		if !r.Cache.PutIfAbsent(key, value) {
+			if cached, found := r.Cache.Peek(key); found {
+				return cached, nil
+			}
+		}
+		return value, nil
+	})
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return zero, ErrNotFound
+		}
+		return zero, fmt.Errorf("load %v: %w", key, err)
+	}
+
+	return value, nil
+}
+
+// Put stores the value and forgets that the store reported the key missing,
+// so a freshly written key is served right away.
+func (r *ReadThrough[KeyT, ValueT]) Put(key KeyT, value ValueT) {
+	r.missing.Delete(key)
+	r.Cache.Put(key, value)
+}
+
+func (r *ReadThrough[KeyT, ValueT]) PutWithTTL(key KeyT, value ValueT, ttl time.Duration) {
+	r.missing.Delete(key)
+	r.Cache.PutWithTTL(key, value, ttl)
+}
+
+func (r *ReadThrough[KeyT, ValueT]) PutIfAbsent(key KeyT, value ValueT) bool {
+	r.missing.Delete(key)
+	return r.Cache.PutIfAbsent(key, value)
+}
+
+// Delete evicts the key and forgets that the store reported it missing, so
+// the next Fetch asks the store again.
+func (r *ReadThrough[KeyT, ValueT]) Delete(key KeyT) bool {
+	r.missing.Delete(key)
+	return r.Cache.Delete(key)
+}
+
+// Purge clears the cache together with the remembered missing keys.
+func (r *ReadThrough[KeyT, ValueT]) Purge() {
+	r.Cache.Purge()
+	r.missing.Purge()
+}
+
+// OrderLoader loads orders missing from the cache from postgres.
+func OrderLoader(orderRepo pgdb.Order) LoaderFunc[string, *entity.Order] {
+	return func(ctx context.Context, uid string) (*entity.Order, error) {
+		order, err := orderRepo.GetOrder(ctx, uid)
+		if err != nil {
+			if errors.Is(err, pgdb.ErrNotFound) {
+				return nil, ErrNotFound
+			}
+			return nil, err
+		}
+		return order, nil
+	}
+}
+
+// ArchivedOrderLoader loads orders like OrderLoader and falls back to the
+// archive for orders the retention job moved there.
+func ArchivedOrderLoader(orderRepo pgdb.Order, archive pgdb.Archive) LoaderFunc[string, *entity.Order] {
+	load := OrderLoader(orderRepo)
+	return func(ctx context.Context, uid string) (*entity.Order, error) {
+		order, err := load(ctx, uid)
+		if !errors.Is(err, ErrNotFound) {
+			return order, err
+		}
+		order, err = archive.GetArchivedOrder(ctx, uid)
+		if err != nil {
+			if errors.Is(err, pgdb.ErrNotFound) {
+				return nil, ErrNotFound
+			}
+			return nil, err
+		}
+		return order, nil
+	}
+}
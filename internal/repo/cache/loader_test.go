@@ -0,0 +1,181 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestFetch(t *testing.T) {
+	var loads atomic.Int32
+	load := func(ctx context.Context, key string) (string, error) {
+		loads.Add(1)
+		switch key {
+		case "key1":
+			return "content1", nil
+		case "broken":
+			return "", errors.New("connection refused")
+		}
+		return "", ErrNotFound
+	}
+	cache := NewReadThrough(NewLRUCache[string, string](10), load)
+
+	tests := []struct {
+		name     string
+		key      string
+		expected string
+		err      error
+		loads    int32
+	}{
+		{
+			name:     "Test miss loads from store",
+			key:      "key1",
+			expected: "content1",
+			loads:    1,
+		},
+		{
+			name:     "Test hit doesn't load",
+			key:      "key1",
+			expected: "content1",
+			loads:    1,
+		},
+		{
+			name:  "Test unknown key",
+			key:   "bogus",
+			err:   ErrNotFound,
+			loads: 2,
+		},
+		{
+			name:  "Test unknown key is cached negatively",
+			key:   "bogus",
+			err:   ErrNotFound,
+			loads: 2,
+		},
+		{
+			name:  "Test store error isn't cached",
+			key:   "broken",
+			err:   errors.New("load broken: connection refused"),
+			loads: 3,
+		},
+		{
+			name:  "Test store error is retried",
+			key:   "broken",
+			err:   errors.New("load broken: connection refused"),
+			loads: 4,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			value, err := cache.Fetch(context.Background(), tt.key)
+			if (err == nil) != (tt.err == nil) || (err != nil && err.Error() != tt.err.Error()) {
+				t.Errorf("Expected err=%v, received=%v", tt.err, err)
+			}
+			if value != tt.expected {
+				t.Errorf("Expected value=%v, received=%v", tt.expected, value)
+			}
+			if n := loads.Load(); n != tt.loads {
+				t.Errorf("Expected loads=%v, received=%v", tt.loads, n)
+			}
+		})
+	}
+}
+
+func TestFetchSingleFlight(t *testing.T) {
+	var loads atomic.Int32
+	release := make(chan struct{})
+	load := func(ctx context.Context, key string) (string, error) {
+		loads.Add(1)
+		<-release
+		return "content", nil
+	}
+	cache := NewReadThrough(NewLRUCache[string, string](10), load)
+
+	const callers = 50
+	var wg sync.WaitGroup
+	for i := 0; i < callers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			value, err := cache.Fetch(context.Background(), "key")
+			if err != nil || value != "content" {
+				t.Errorf("Expected value=%v, received=%v, err=%v", "content", value, err)
+			}
+		}()
+	}
+
+	// Release the load only when every other caller waits for it
+	deadline := time.Now().Add(5 * time.Second)
+	for waiting(&cache.flights, "key") != callers-1 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	close(release)
+	wg.Wait()
+
+	if n := loads.Load(); n != 1 {
+		t.Errorf("Expected loads=%v, received=%v", 1, n)
+	}
+}
+
+// waiting returns the number of callers waiting for the load of key.
+func waiting[KeyT comparable, ValueT any](g *group[KeyT, ValueT], key KeyT) int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if c, found := g.calls[key]; found {
+		return c.dups
+	}
+	return 0
+}
+
+func TestDeleteForgetsMissingKey(t *testing.T) {
+	var loads atomic.Int32
+	load := func(ctx context.Context, key string) (string, error) {
+		loads.Add(1)
+		return "", ErrNotFound
+	}
+	cache := NewReadThrough(NewLRUCache[string, string](10), load)
+
+	cache.Fetch(context.Background(), "key")
+	cache.Delete("key")
+	cache.Fetch(context.Background(), "key")
+	if n := loads.Load(); n != 2 {
+		t.Errorf("Expected loads=%v, received=%v", 2, n)
+	}
+
+	cache.Put("key", "content")
+	value, err := cache.Fetch(context.Background(), "key")
+	if err != nil || value != "content" {
+		t.Errorf("Expected value=%v, received=%v, err=%v", "content", value, err)
+	}
+}
+
+func TestFetchKeepsValuePutDuringLoad(t *testing.T) {
+	loading := make(chan struct{})
+	release := make(chan struct{})
+	load := func(ctx context.Context, key string) (string, error) {
+		close(loading)
+		<-release
+		return "stale", nil
+	}
+	cache := NewReadThrough(NewLRUCache[string, string](10), load)
+
+	done := make(chan string)
+	go func() {
+		value, _ := cache.Fetch(context.Background(), "key")
+		done <- value
+	}()
+
+	<-loading
+	cache.Put("key", "fresh")
+	close(release)
+
+	if value := <-done; value != "fresh" {
+		t.Errorf("Expected value=%v, received=%v", "fresh", value)
+	}
+	if value, _ := cache.Get("key"); value != "fresh" {
+		t.Errorf("Expected cached=%v, received=%v", "fresh", value)
+	}
+}
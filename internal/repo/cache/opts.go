@@ -0,0 +1,52 @@
+package cache
+
+import "time"
+
+type Option[KeyT comparable, ValueT any] func(*BoundedCache[KeyT, ValueT])
+
+// MaxBytes bounds the cache by the estimated size of its entries. Victims of
+// the eviction policy are evicted until the total fits into the budget.
+func MaxBytes[KeyT comparable, ValueT any](maxBytes int64) Option[KeyT, ValueT] {
+	return func(c *BoundedCache[KeyT, ValueT]) {
+		c.maxBytes = maxBytes
+	}
+}
+
+// SizeFunc sets the function used to estimate the size of an entry in bytes.
+func SizeFunc[KeyT comparable, ValueT any](sizeOf func(KeyT, ValueT) int64) Option[KeyT, ValueT] {
+	return func(c *BoundedCache[KeyT, ValueT]) {
+		c.sizeOf = sizeOf
+	}
+}
+
+// TTL sets the default time to live of entries stored with Put. Expired
+// entries are never returned by Get and are swept by a background janitor.
+func TTL[KeyT comparable, ValueT any](ttl time.Duration) Option[KeyT, ValueT] {
+	return func(c *BoundedCache[KeyT, ValueT]) {
+		c.ttl = ttl
+	}
+}
+
+// CleanupInterval sets how often the janitor sweeps expired entries. Without
+// it the janitor only runs when a default TTL is set.
+func CleanupInterval[KeyT comparable, ValueT any](interval time.Duration) Option[KeyT, ValueT] {
+	return func(c *BoundedCache[KeyT, ValueT]) {
+		c.cleanupInterval = interval
+	}
+}
+
+// OnEvict registers a callback run whenever an entry leaves the cache. It is
+// called outside the cache lock, after the operation that caused it.
+func OnEvict[KeyT comparable, ValueT any](onEvict func(key KeyT, value ValueT, reason EvictionReason)) Option[KeyT, ValueT] {
+	return func(c *BoundedCache[KeyT, ValueT]) {
+		c.onEvict = onEvict
+	}
+}
+
+// Clock sets the function the cache reads the current time from to expire
+// entries. It defaults to time.Now.
+func Clock[KeyT comparable, ValueT any](now func() time.Time) Option[KeyT, ValueT] {
+	return func(c *BoundedCache[KeyT, ValueT]) {
+		c.now = now
+	}
+}
@@ -0,0 +1,102 @@
+package cache
+
+import "fmt"
+
+// Policy names the strategy that picks which entry to evict when the cache
+// is over its limits.
+type Policy string
+
+const (
+	// PolicyLRU evicts the least recently used entry
+	PolicyLRU Policy = "lru"
+	// PolicyLFU evicts the least frequently used entry, the least recently
+	// used one among equally frequent entries
+	PolicyLFU Policy = "lfu"
+	// PolicyARC balances recency and frequency and adapts the balance to the
+	// workload using the history of recently evicted keys
+	PolicyARC Policy = "arc"
+	// PolicyTinyLFU is W-TinyLFU: a small LRU window in front of a segmented
+	// LRU, where an entry leaving the window is only admitted to the main
+	// space if it has been requested more often than the entry it replaces.
+	// It resists pollution by one-off scans.
+	PolicyTinyLFU Policy = "tinylfu"
+)
+
+// ParsePolicy validates a policy name.
+func ParsePolicy(name string) (Policy, error) {
+	switch p := Policy(name); p {
+	case PolicyLRU, PolicyLFU, PolicyARC, PolicyTinyLFU:
+		return p, nil
+	}
+	return "", fmt.Errorf("unknown cache policy %q", name)
+}
+
+// segment tells which of its queues a policy keeps a node in.
+type segment uint8
+
+// policy orders the entries of a BoundedCache. The cache calls it under its
+// lock and owns the map of entries, the policy only tracks the nodes.
+type policy[KeyT comparable, ValueT any] interface {
+	// add starts tracking a node inserted into the cache
+	add(node *node[KeyT, ValueT])
+	// touch records an access to a tracked node
+	touch(node *node[KeyT, ValueT])
+	// miss records a lookup of a key the cache doesn't have
+	miss(key KeyT)
+	// remove stops tracking a node that leaves the cache
+	remove(node *node[KeyT, ValueT], reason EvictionReason)
+	// victim returns the node to evict next, or nil if there is none
+	victim() *node[KeyT, ValueT]
+	// walk calls f from the most valuable node to the next victim until f
+	// returns false
+	walk(f func(*node[KeyT, ValueT]) bool)
+	reset()
+}
+
+func newPolicy[KeyT comparable, ValueT any](name Policy) (policy[KeyT, ValueT], error) {
+	switch name {
+	case PolicyLRU, "":
+		return newLRUPolicy[KeyT, ValueT](), nil
+	case PolicyLFU:
+		return newLFUPolicy[KeyT, ValueT](), nil
+	case PolicyARC:
+		return newARCPolicy[KeyT, ValueT](), nil
+	case PolicyTinyLFU:
+		return newTinyLFUPolicy[KeyT, ValueT](), nil
+	}
+	return nil, fmt.Errorf("unknown cache policy %q", name)
+}
+
+type lruPolicy[KeyT comparable, ValueT any] struct {
+	list *list[KeyT, ValueT]
+}
+
+func newLRUPolicy[KeyT comparable, ValueT any]() *lruPolicy[KeyT, ValueT] {
+	return &lruPolicy[KeyT, ValueT]{list: newList[KeyT, ValueT]()}
+}
+
+func (p *lruPolicy[KeyT, ValueT]) add(node *node[KeyT, ValueT]) {
+	p.list.pushToFront(node)
+}
+
+func (p *lruPolicy[KeyT, ValueT]) touch(node *node[KeyT, ValueT]) {
+	p.list.moveToFront(node)
+}
+
+func (p *lruPolicy[KeyT, ValueT]) miss(key KeyT) {}
+
+func (p *lruPolicy[KeyT, ValueT]) remove(node *node[KeyT, ValueT], reason EvictionReason) {
+	p.list.remove(node)
+}
+
+func (p *lruPolicy[KeyT, ValueT]) victim() *node[KeyT, ValueT] {
+	return p.list.back()
+}
+
+func (p *lruPolicy[KeyT, ValueT]) walk(f func(*node[KeyT, ValueT]) bool) {
+	p.list.walk(f)
+}
+
+func (p *lruPolicy[KeyT, ValueT]) reset() {
+	p.list = newList[KeyT, ValueT]()
+}
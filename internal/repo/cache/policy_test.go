@@ -0,0 +1,191 @@
+package cache
+
+import (
+	"bufio"
+	"fmt"
+	"math/rand"
+	"os"
+	"testing"
+)
+
+var policies = []Policy{PolicyLRU, PolicyLFU, PolicyARC, PolicyTinyLFU}
+
+func TestPolicies(t *testing.T) {
+	const capacity = 50
+
+	for _, policy := range policies {
+		t.Run(string(policy), func(t *testing.T) {
+			cache, err := New[int, int](policy, capacity)
+			if err != nil {
+				t.Fatalf("New() error = %v", err)
+			}
+
+			rnd := rand.New(rand.NewSource(1))
+			for i := 0; i < 10_000; i++ {
+				key := rnd.Intn(200)
+				switch op := rnd.Intn(10); {
+				case op < 5:
+					if value, found := cache.Get(key); found && value != key {
+						t.Fatalf("Expected value=%v, received=%v", key, value)
+					}
+				case op < 9:
+					cache.Put(key, key)
+					if value, found := cache.Peek(key); !found || value != key {
+						t.Fatalf("Expected value=%v after put, received=%v, found=%v", key, value, found)
+					}
+				default:
+					cache.Delete(key)
+					if _, found := cache.Peek(key); found {
+						t.Fatalf("Expected key=%v to be deleted", key)
+					}
+				}
+
+				if n := cache.Len(); n > capacity {
+					t.Fatalf("Expected at most %v entries, received=%v", capacity, n)
+				}
+			}
+
+			keys := cache.Keys()
+			if len(keys) != cache.Len() {
+				t.Errorf("Expected keys=%v, received=%v", cache.Len(), len(keys))
+			}
+			for _, key := range keys {
+				if _, found := cache.Peek(key); !found {
+					t.Errorf("Expected key=%v from Keys to be cached", key)
+				}
+			}
+
+			cache.Purge()
+			if n := cache.Len(); n != 0 {
+				t.Errorf("Expected len=%v after purge, received=%v", 0, n)
+			}
+		})
+	}
+}
+
+func TestUnknownPolicy(t *testing.T) {
+	if _, err := New[int, int]("fifo", 10); err == nil {
+		t.Errorf("Expected error for unknown policy")
+	}
+	if _, err := ParsePolicy("fifo"); err == nil {
+		t.Errorf("Expected error for unknown policy")
+	}
+}
+
+func TestScanResistance(t *testing.T) {
+	trace := scanTrace(100_000)
+	lru := replay(t, PolicyLRU, 1000, trace)
+
+	for _, policy := range []Policy{PolicyARC, PolicyTinyLFU} {
+		if ratio := replay(t, policy, 1000, trace); ratio <= lru {
+			t.Errorf("Expected %v hit ratio=%.3f to beat LRU=%.3f on scans", policy, ratio, lru)
+		}
+	}
+}
+
+// BenchmarkPolicies replays access traces against every policy and reports
+// the hit ratio next to the usual timings. Set CACHE_TRACE to a file with
+// one key per line to replay a recorded production trace as well.
+func BenchmarkPolicies(b *testing.B) {
+	traces := map[string][]string{
+		"zipf": zipfTrace(100_000),
+		"scan": scanTrace(100_000),
+		"loop": loopTrace(100_000),
+	}
+	if path := os.Getenv("CACHE_TRACE"); path != "" {
+		trace, err := readTrace(path)
+		if err != nil {
+			b.Fatalf("readTrace() error = %v", err)
+		}
+		traces["file"] = trace
+	}
+
+	for _, name := range []string{"zipf", "scan", "loop", "file"} {
+		trace, ok := traces[name]
+		if !ok {
+			continue
+		}
+		for _, policy := range policies {
+			b.Run(fmt.Sprintf("%s/%s", name, policy), func(b *testing.B) {
+				cache, err := New[string, string](policy, 1000)
+				if err != nil {
+					b.Fatalf("New() error = %v", err)
+				}
+				b.ReportAllocs()
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					key := trace[i%len(trace)]
+					if _, found := cache.Get(key); !found {
+						cache.Put(key, key)
+					}
+				}
+				b.ReportMetric(100*cache.Stats().HitRatio(), "hit%")
+			})
+		}
+	}
+}
+
+func replay(t *testing.T, policy Policy, capacity int, trace []string) float64 {
+	t.Helper()
+
+	cache, err := New[string, string](policy, capacity)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	for _, key := range trace {
+		if _, found := cache.Get(key); !found {
+			cache.Put(key, key)
+		}
+	}
+	return cache.Stats().HitRatio()
+}
+
+// zipfTrace models skewed order lookups: a few hot orders and a long tail.
+func zipfTrace(n int) []string {
+	rnd := rand.New(rand.NewSource(1))
+	zipf := rand.NewZipf(rnd, 1.1, 1, 50_000)
+	trace := make([]string, n)
+	for i := range trace {
+		trace[i] = fmt.Sprintf("order-%d", zipf.Uint64())
+	}
+	return trace
+}
+
+// scanTrace is zipfTrace interrupted by scans over keys requested only once.
+func scanTrace(n int) []string {
+	trace := zipfTrace(n)
+	scanned := 0
+	for i := 0; i+2000 < len(trace); i += 10_000 {
+		for j := 0; j < 2000; j++ {
+			trace[i+j] = fmt.Sprintf("scan-%d", scanned)
+			scanned++
+		}
+	}
+	return trace
+}
+
+// loopTrace cycles over a working set slightly larger than the cache.
+func loopTrace(n int) []string {
+	trace := make([]string, n)
+	for i := range trace {
+		trace[i] = fmt.Sprintf("order-%d", i%1200)
+	}
+	return trace
+}
+
+func readTrace(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var trace []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if key := scanner.Text(); key != "" {
+			trace = append(trace, key)
+		}
+	}
+	return trace, scanner.Err()
+}
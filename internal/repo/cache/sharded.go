@@ -0,0 +1,145 @@
+package cache
+
+import (
+	"hash/maphash"
+	"time"
+)
+
+// ShardedCache splits keys across independently locked shards, so lookups
+// of different keys from many goroutines don't serialize on one mutex. The
+// eviction policy runs per shard, which makes eviction approximate.
+type ShardedCache[KeyT comparable, ValueT any] struct {
+	seed    maphash.Seed
+	shards  []*BoundedCache[KeyT, ValueT]
+	janitor *janitor
+}
+
+// NewShardedLRUCache returns an LRU cache of the given total capacity
+// divided evenly between shards. A MaxBytes budget is divided the same way.
+func NewShardedLRUCache[KeyT comparable, ValueT any](shards, capacity int, opts ...Option[KeyT, ValueT]) Cache[KeyT, ValueT] {
+	c, _ := NewSharded(PolicyLRU, shards, capacity, opts...)
+	return c
+}
+
+// NewSharded is like NewShardedLRUCache with the given eviction policy.
+func NewSharded[KeyT comparable, ValueT any](policy Policy, shards, capacity int, opts ...Option[KeyT, ValueT]) (Cache[KeyT, ValueT], error) {
+	if shards < 1 {
+		shards = 1
+	}
+
+	s := &ShardedCache[KeyT, ValueT]{
+		seed:   maphash.MakeSeed(),
+		shards: make([]*BoundedCache[KeyT, ValueT], shards),
+	}
+	for i := range s.shards {
+		shard, err := newBoundedCache(policy, divide(capacity, shards), opts...)
+		if err != nil {
+			return nil, err
+		}
+		shard.maxBytes = divide(shard.maxBytes, int64(shards))
+		s.shards[i] = shard
+	}
+
+	// One janitor sweeps the shards in turn instead of a goroutine per shard
+	if interval := cleanupInterval(s.shards[0].cleanupInterval, s.shards[0].ttl); interval > 0 {
+		s.janitor = startJanitor(interval, func() {
+			for _, shard := range s.shards {
+				shard.deleteExpired()
+			}
+		})
+	}
+	return s, nil
+}
+
+func (s *ShardedCache[KeyT, ValueT]) Get(key KeyT) (ValueT, bool) {
+	return s.shard(key).Get(key)
+}
+
+func (s *ShardedCache[KeyT, ValueT]) Put(key KeyT, value ValueT) {
+	s.shard(key).Put(key, value)
+}
+
+func (s *ShardedCache[KeyT, ValueT]) PutWithTTL(key KeyT, value ValueT, ttl time.Duration) {
+	s.shard(key).PutWithTTL(key, value, ttl)
+}
+
+func (s *ShardedCache[KeyT, ValueT]) PutIfAbsent(key KeyT, value ValueT) bool {
+	return s.shard(key).PutIfAbsent(key, value)
+}
+
+func (s *ShardedCache[KeyT, ValueT]) Peek(key KeyT) (ValueT, bool) {
+	return s.shard(key).Peek(key)
+}
+
+func (s *ShardedCache[KeyT, ValueT]) Delete(key KeyT) bool {
+	return s.shard(key).Delete(key)
+}
+
+func (s *ShardedCache[KeyT, ValueT]) Len() int {
+	n := 0
+	for _, shard := range s.shards {
+		n += shard.Len()
+	}
+	return n
+}
+
+// Keys returns the keys shard by shard, each shard from the most to the
+// least recently used. There is no recency order across shards.
+func (s *ShardedCache[KeyT, ValueT]) Keys() []KeyT {
+	var keys []KeyT
+	for _, shard := range s.shards {
+		keys = append(keys, shard.Keys()...)
+	}
+	return keys
+}
+
+func (s *ShardedCache[KeyT, ValueT]) Range(f func(key KeyT, value ValueT) bool) {
+	for _, shard := range s.shards {
+		for _, e := range shard.entries() {
+			if !f(e.key, e.value) {
+				return
+			}
+		}
+	}
+}
+
+func (s *ShardedCache[KeyT, ValueT]) Purge() {
+	for _, shard := range s.shards {
+		shard.Purge()
+	}
+}
+
+func (s *ShardedCache[KeyT, ValueT]) Close() {
+	s.janitor.Stop()
+}
+
+func (s *ShardedCache[KeyT, ValueT]) Stats() Stats {
+	stats := Stats{Policy: s.shards[0].policyName}
+	for _, shard := range s.shards {
+		st := shard.Stats()
+		stats.Hits += st.Hits
+		stats.Misses += st.Misses
+		stats.Evictions += st.Evictions
+		stats.Entries += st.Entries
+		stats.Bytes += st.Bytes
+		stats.MaxEntries += st.MaxEntries
+		stats.MaxBytes += st.MaxBytes
+	}
+	return stats
+}
+
+func (s *ShardedCache[KeyT, ValueT]) shard(key KeyT) *BoundedCache[KeyT, ValueT] {
+	if len(s.shards) == 1 {
+		return s.shards[0]
+	}
+	return s.shards[hashKey(s.seed, key)%uint64(len(s.shards))]
+}
+
+// divide splits a limit between n shards rounding up, so the sum of the
+// shard limits is never below the requested one.
+func divide[T int | int64](limit, n T) T {
+	if limit <= 0 {
+		return limit
+	}
+	return (limit + n - 1) / n
+}
@@ -0,0 +1,44 @@
+package cache
+
+import "sync"
+
+type call[ValueT any] struct {
+	wg    sync.WaitGroup
+	value ValueT
+	err   error
+	// dups counts the callers waiting for the result of another one
+	dups int
+}
+
+// group collapses concurrent calls for the same key into one execution
+// whose result is shared by every caller.
+type group[KeyT comparable, ValueT any] struct {
+	mu    sync.Mutex
+	calls map[KeyT]*call[ValueT]
+}
+
+func (g *group[KeyT, ValueT]) do(key KeyT, fn func() (ValueT, error)) (ValueT, error) {
+	g.mu.Lock()
+	if g.calls == nil {
+		g.calls = make(map[KeyT]*call[ValueT])
+	}
+	if c, found := g.calls[key]; found {
+		c.dups++
+		g.mu.Unlock()
+		c.wg.Wait()
+		return c.value, c.err
+	}
+	c := new(call[ValueT])
+	c.wg.Add(1)
+	g.calls[key] = c
+	g.mu.Unlock()
+
+	c.value, c.err = fn()
+	c.wg.Done()
+
+	g.mu.Lock()
+	delete(g.calls, key)
+	g.mu.Unlock()
+
+	return c.value, c.err
+}
@@ -0,0 +1,41 @@
+package cache
+
+import (
+	"unsafe"
+
+	"github.com/v7ktory/wb_task_one/internal/entity"
+)
+
+var (
+	// map bucket slot, list node and key header
+	entryOverhead = int64(unsafe.Sizeof(node[string, *entity.Order]{})) + 16
+	orderSize     = int64(unsafe.Sizeof(entity.Order{}))
+	itemSize      = int64(unsafe.Sizeof(entity.ItemAttrs{}))
+)
+
+// OrderSize approximates the memory held by a cached order: the structs
+// themselves plus the bytes of every string they reference.
+func OrderSize(uid string, order *entity.Order) int64 {
+	size := entryOverhead + int64(len(uid))
+	if order == nil {
+		return size
+	}
+
+	size += orderSize
+	size += int64(len(order.UID) + len(order.TrackNumber) + len(order.Entry) + len(order.Locale) +
+		len(order.InternalSignature) + len(order.CustomerID) + len(order.DeliveryService) +
+		len(order.ShardKey) + len(order.OffShard))
+
+	d := order.Delivery
+	size += int64(len(d.Name) + len(d.Phone) + len(d.Zip) + len(d.City) + len(d.Address) + len(d.Region) + len(d.Email))
+
+	p := order.Payment
+	size += int64(len(p.Transaction) + len(p.RequestID) + len(p.Currency) + len(p.Provider) + len(p.Bank))
+
+	size += int64(cap(order.Items)) * itemSize
+	for _, item := range order.Items {
+		size += int64(len(item.TrackNumber) + len(item.Rid) + len(item.Name) + len(item.Size) + len(item.Brand))
+	}
+
+	return size
+}
@@ -0,0 +1,84 @@
+package cache
+
+const (
+	sketchDepth    = 4
+	sketchMinWidth = 1 << 10
+	sketchMaxCount = 15
+	// counters are halved after this many increments per counter column
+	sketchSampleFactor = 10
+)
+
+// sketch is a count-min sketch of small saturating counters estimating how
+// often a key was requested. Counters are periodically halved, so the
+// estimate favours recent popularity over all-time popularity.
+type sketch struct {
+	rows      [sketchDepth][]uint8
+	mask      uint64
+	additions int
+	sample    int
+}
+
+func newSketch(width int) *sketch {
+	s := &sketch{}
+	s.resize(width)
+	return s
+}
+
+// resize reallocates the counters for at least width keys. The collected
+// history is dropped, so the sketch only grows when the cache does.
+func (s *sketch) resize(width int) {
+	size := sketchMinWidth
+	for size < width {
+		size <<= 1
+	}
+	for i := range s.rows {
+		s.rows[i] = make([]uint8, size)
+	}
+	s.mask = uint64(size - 1)
+	s.additions = 0
+	s.sample = size * sketchSampleFactor
+}
+
+func (s *sketch) width() int {
+	return len(s.rows[0])
+}
+
+func (s *sketch) increment(hash uint64) {
+	added := false
+	for i := range s.rows {
+		idx := s.index(hash, i)
+		if s.rows[i][idx] < sketchMaxCount {
+			s.rows[i][idx]++
+			added = true
+		}
+	}
+	if added {
+		s.additions++
+		if s.additions >= s.sample {
+			s.age()
+		}
+	}
+}
+
+func (s *sketch) estimate(hash uint64) uint8 {
+	estimate := uint8(sketchMaxCount)
+	for i := range s.rows {
+		estimate = min(estimate, s.rows[i][s.index(hash, i)])
+	}
+	return estimate
+}
+
+func (s *sketch) age() {
+	for i := range s.rows {
+		for j := range s.rows[i] {
+			s.rows[i][j] >>= 1
+		}
+	}
+	s.additions /= 2
+}
+
+// index derives the column of a row by double hashing.
+func (s *sketch) index(hash uint64, row int) uint64 {
+	h := hash + uint64(row)*(hash>>32|1)
+	return h & s.mask
+}
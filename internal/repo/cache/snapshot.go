@@ -0,0 +1,199 @@
+package cache
+
+import (
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/v7ktory/wb_task_one/internal/entity"
+)
+
+// Snapshot file layout, all integers big endian:
+//
+//	magic     [4]byte  "WBOC"
+//	version   uint32
+//	createdAt int64    unix nanoseconds
+//	bodyLen   uint64
+//	checksum  uint32   CRC-32C of the body
+//	body      gob stream: entry count, then the entries from the least to
+//	          the most valuable, so loading them in order restores the ranking
+const snapshotVersion = 1
+
+var snapshotMagic = [4]byte{'W', 'B', 'O', 'C'}
+
+var (
+	ErrSnapshotCorrupt = errors.New("snapshot is corrupt")
+	ErrSnapshotVersion = errors.New("snapshot format version is not supported")
+	ErrSnapshotStale   = errors.New("snapshot is too old")
+)
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+type snapshotHeader struct {
+	Magic     [4]byte
+	Version   uint32
+	CreatedAt int64
+	BodyLen   uint64
+	Checksum  uint32
+}
+
+type snapshotEntry struct {
+	Key   string
+	Order *entity.Order
+}
+
+// SaveSnapshot writes the cached orders to path. The file is written next
+// to the target and renamed over it, so a crash never leaves a half
+// written snapshot behind. It returns the number of saved orders.
+func SaveSnapshot(path string, c Cache[string, *entity.Order]) (int, error) {
+	var entries []snapshotEntry
+	c.Range(func(key string, order *entity.Order) bool {
+		if order != nil {
+			entries = append(entries, snapshotEntry{key, order})
+		}
+		return true
+	})
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return 0, fmt.Errorf("create snapshot dir: %w", err)
+	}
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return 0, fmt.Errorf("create snapshot: %w", err)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	// The header is rewritten once the body length and checksum are known
+	header := snapshotHeader{
+		Magic:     snapshotMagic,
+		Version:   snapshotVersion,
+		CreatedAt: time.Now().UnixNano(),
+	}
+	if err := binary.Write(f, binary.BigEndian, header); err != nil {
+		return 0, fmt.Errorf("write snapshot header: %w", err)
+	}
+
+	body := &countingWriter{w: f, crc: crc32.New(crcTable)}
+	enc := gob.NewEncoder(body)
+	if err := enc.Encode(len(entries)); err != nil {
+		return 0, fmt.Errorf("write snapshot: %w", err)
+	}
+	for i := len(entries) - 1; i >= 0; i-- {
+		if err := enc.Encode(entries[i]); err != nil {
+			return 0, fmt.Errorf("write snapshot: %w", err)
+		}
+	}
+
+	header.BodyLen = body.n
+	header.Checksum = body.crc.Sum32()
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return 0, fmt.Errorf("write snapshot header: %w", err)
+	}
+	if err := binary.Write(f, binary.BigEndian, header); err != nil {
+		return 0, fmt.Errorf("write snapshot header: %w", err)
+	}
+	if err := f.Sync(); err != nil {
+		return 0, fmt.Errorf("sync snapshot: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return 0, fmt.Errorf("close snapshot: %w", err)
+	}
+	if err := os.Rename(f.Name(), path); err != nil {
+		return 0, fmt.Errorf("rename snapshot: %w", err)
+	}
+
+	return len(entries), nil
+}
+
+// LoadSnapshot puts the orders saved by SaveSnapshot into the cache. The
+// whole file is verified before the cache is touched. A snapshot older than
+// maxAge is rejected with ErrSnapshotStale, a zero maxAge accepts any age.
+// It returns the number of loaded orders.
+func LoadSnapshot(path string, maxAge time.Duration, c Cache[string, *entity.Order]) (int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, fmt.Errorf("open snapshot: %w", err)
+	}
+	defer f.Close()
+
+	var header snapshotHeader
+	if err := binary.Read(f, binary.BigEndian, &header); err != nil {
+		return 0, fmt.Errorf("%w: read header: %v", ErrSnapshotCorrupt, err)
+	}
+	if header.Magic != snapshotMagic {
+		return 0, fmt.Errorf("%w: bad magic %q", ErrSnapshotCorrupt, header.Magic[:])
+	}
+	if header.Version != snapshotVersion {
+		return 0, fmt.Errorf("%w: %d", ErrSnapshotVersion, header.Version)
+	}
+	if age := time.Since(time.Unix(0, header.CreatedAt)); maxAge > 0 && age > maxAge {
+		return 0, fmt.Errorf("%w: created %s ago", ErrSnapshotStale, age.Round(time.Second))
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		return 0, fmt.Errorf("stat snapshot: %w", err)
+	}
+	if bodyLen := info.Size() - int64(binary.Size(header)); header.BodyLen != uint64(bodyLen) {
+		return 0, fmt.Errorf("%w: body of %d bytes, header says %d", ErrSnapshotCorrupt, bodyLen, header.BodyLen)
+	}
+
+	crc := crc32.New(crcTable)
+	body := io.TeeReader(io.LimitReader(f, int64(header.BodyLen)), crc)
+	dec := gob.NewDecoder(body)
+
+	var count int
+	if err := dec.Decode(&count); err != nil {
+		return 0, fmt.Errorf("%w: read entry count: %v", ErrSnapshotCorrupt, err)
+	}
+	if count < 0 || uint64(count) > header.BodyLen {
+		return 0, fmt.Errorf("%w: bad entry count %d", ErrSnapshotCorrupt, count)
+	}
+	// The count isn't verified yet, so it must not size an allocation
+	var entries []snapshotEntry
+	for i := 0; i < count; i++ {
+		var e snapshotEntry
+		if err := dec.Decode(&e); err != nil {
+			return 0, fmt.Errorf("%w: read entry %d: %v", ErrSnapshotCorrupt, i, err)
+		}
+		entries = append(entries, e)
+	}
+
+	// gob may stop short of the end of the body, the rest still counts
+	if _, err := io.Copy(io.Discard, body); err != nil {
+		return 0, fmt.Errorf("%w: %v", ErrSnapshotCorrupt, err)
+	}
+	if crc.Sum32() != header.Checksum {
+		return 0, fmt.Errorf("%w: checksum mismatch", ErrSnapshotCorrupt)
+	}
+
+	for _, e := range entries {
+		if e.Order != nil {
+			c.Put(e.Key, e.Order)
+		}
+	}
+
+	return len(entries), nil
+}
+
+// countingWriter passes writes through, counting and checksumming them.
+type countingWriter struct {
+	w   io.Writer
+	crc hash.Hash32
+	n   uint64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.crc.Write(p[:n])
+	cw.n += uint64(n)
+	return n, err
+}
@@ -0,0 +1,144 @@
+package cache
+
+import (
+	"encoding/binary"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/v7ktory/wb_task_one/internal/entity"
+)
+
+func TestSnapshot(t *testing.T) {
+	src := NewLRUCache[string, *entity.Order](10)
+	for _, uid := range []string{"uid1", "uid2", "uid3"} {
+		src.Put(uid, &entity.Order{
+			UID:         uid,
+			TrackNumber: "WBILMTESTTRACK",
+			Items:       []entity.ItemAttrs{{ChrtID: 9934930, Brand: "Vivienne Sabo"}},
+			DateCreated: time.Date(2021, 11, 26, 6, 22, 19, 0, time.UTC),
+		})
+	}
+	src.Get("uid1")
+
+	path := filepath.Join(t.TempDir(), "orders.snapshot")
+	saved, err := SaveSnapshot(path, src)
+	if err != nil {
+		t.Fatalf("SaveSnapshot() error = %v", err)
+	}
+	if saved != 3 {
+		t.Errorf("Expected saved=%v, received=%v", 3, saved)
+	}
+
+	tests := []struct {
+		name   string
+		tamper func(t *testing.T, path string)
+		maxAge time.Duration
+		err    error
+	}{
+		{
+			name:   "Test valid snapshot",
+			tamper: func(t *testing.T, path string) {},
+			maxAge: time.Hour,
+		},
+		{
+			name:   "Test stale snapshot",
+			tamper: func(t *testing.T, path string) {},
+			maxAge: time.Nanosecond,
+			err:    ErrSnapshotStale,
+		},
+		{
+			name: "Test flipped body byte",
+			tamper: func(t *testing.T, path string) {
+				data := readFile(t, path)
+				data[len(data)-1] ^= 0xff
+				writeFile(t, path, data)
+			},
+			err: ErrSnapshotCorrupt,
+		},
+		{
+			name: "Test truncated snapshot",
+			tamper: func(t *testing.T, path string) {
+				data := readFile(t, path)
+				writeFile(t, path, data[:len(data)/2])
+			},
+			err: ErrSnapshotCorrupt,
+		},
+		{
+			name: "Test trailing data",
+			tamper: func(t *testing.T, path string) {
+				writeFile(t, path, append(readFile(t, path), 0))
+			},
+			err: ErrSnapshotCorrupt,
+		},
+		{
+			name: "Test unknown version",
+			tamper: func(t *testing.T, path string) {
+				data := readFile(t, path)
+				binary.BigEndian.PutUint32(data[4:], snapshotVersion+1)
+				writeFile(t, path, data)
+			},
+			err: ErrSnapshotVersion,
+		},
+		{
+			name: "Test missing snapshot",
+			tamper: func(t *testing.T, path string) {
+				os.Remove(path)
+			},
+			err: os.ErrNotExist,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			copied := filepath.Join(t.TempDir(), "orders.snapshot")
+			writeFile(t, copied, readFile(t, path))
+			tt.tamper(t, copied)
+
+			dst := NewLRUCache[string, *entity.Order](10)
+			loaded, err := LoadSnapshot(copied, tt.maxAge, dst)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("Expected err=%v, received=%v", tt.err, err)
+			}
+			if tt.err != nil {
+				if n := dst.Len(); n != 0 {
+					t.Errorf("Expected untouched cache, received len=%v", n)
+				}
+				return
+			}
+
+			if loaded != 3 {
+				t.Errorf("Expected loaded=%v, received=%v", 3, loaded)
+			}
+			keys := dst.Keys()
+			expected := []string{"uid1", "uid3", "uid2"}
+			for i := range expected {
+				if i >= len(keys) || keys[i] != expected[i] {
+					t.Fatalf("Expected keys=%v, received=%v", expected, keys)
+				}
+			}
+			order, _ := dst.Get("uid1")
+			if order.Items[0].Brand != "Vivienne Sabo" || !order.DateCreated.Equal(time.Date(2021, 11, 26, 6, 22, 19, 0, time.UTC)) {
+				t.Errorf("Expected restored order, received=%+v", order)
+			}
+		})
+	}
+}
+
+func readFile(t *testing.T, path string) []byte {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile() error = %v", err)
+	}
+	return data
+}
+
+func writeFile(t *testing.T, path string, data []byte) {
+	t.Helper()
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+}
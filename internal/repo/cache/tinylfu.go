@@ -0,0 +1,157 @@
+package cache
+
+import "hash/maphash"
+
+const (
+	tinyWindow    segment = iota // admission window, plain LRU
+	tinyProbation                // main space, seen once since admission
+	tinyProtected                // main space, seen again since admission
+)
+
+const (
+	tinyWindowPercent    = 1
+	tinyProtectedPercent = 80
+)
+
+// tinyLFUPolicy implements W-TinyLFU (Einziger, Friedman & Manes). New
+// entries land in a small LRU window. An entry pushed out of the window
+// becomes a candidate for the main segmented LRU and is only kept if the
+// frequency sketch says it is requested more often than the main victim,
+// so a scan of one-off keys can't flush the frequently used ones.
+//
+// Segment sizes are a share of the resident entries, because the cache
+// limits may be in bytes rather than entries.
+type tinyLFUPolicy[KeyT comparable, ValueT any] struct {
+	window    *list[KeyT, ValueT]
+	probation *list[KeyT, ValueT]
+	protected *list[KeyT, ValueT]
+	candidate *node[KeyT, ValueT]
+	sketch    *sketch
+	seed      maphash.Seed
+}
+
+func newTinyLFUPolicy[KeyT comparable, ValueT any]() *tinyLFUPolicy[KeyT, ValueT] {
+	p := &tinyLFUPolicy[KeyT, ValueT]{
+		seed:   maphash.MakeSeed(),
+		sketch: newSketch(sketchMinWidth),
+	}
+	p.reset()
+	return p
+}
+
+func (p *tinyLFUPolicy[KeyT, ValueT]) add(node *node[KeyT, ValueT]) {
+	p.record(node.key)
+	if p.resident() >= p.sketch.width() {
+		p.sketch.resize(2 * p.sketch.width())
+	}
+
+	node.segment = tinyWindow
+	p.window.pushToFront(node)
+	if p.window.len <= p.windowLimit() {
+		return
+	}
+
+	// The oldest window entry moves to the main space and has to prove
+	// itself against the main victim on the next eviction
+	candidate := p.window.back()
+	p.window.remove(candidate)
+	candidate.segment = tinyProbation
+	p.probation.pushToFront(candidate)
+	p.candidate = candidate
+}
+
+func (p *tinyLFUPolicy[KeyT, ValueT]) touch(node *node[KeyT, ValueT]) {
+	p.record(node.key)
+
+	switch node.segment {
+	case tinyWindow:
+		p.window.moveToFront(node)
+	case tinyProbation:
+		p.probation.remove(node)
+		node.segment = tinyProtected
+		p.protected.pushToFront(node)
+		for p.protected.len > p.protectedLimit() {
+			demoted := p.protected.back()
+			p.protected.remove(demoted)
+			demoted.segment = tinyProbation
+			p.probation.pushToFront(demoted)
+		}
+	case tinyProtected:
+		p.protected.moveToFront(node)
+	}
+}
+
+func (p *tinyLFUPolicy[KeyT, ValueT]) miss(key KeyT) {
+	p.record(key)
+}
+
+func (p *tinyLFUPolicy[KeyT, ValueT]) remove(node *node[KeyT, ValueT], reason EvictionReason) {
+	if node == p.candidate {
+		p.candidate = nil
+	}
+	switch node.segment {
+	case tinyWindow:
+		p.window.remove(node)
+	case tinyProbation:
+		p.probation.remove(node)
+	case tinyProtected:
+		p.protected.remove(node)
+	}
+}
+
+func (p *tinyLFUPolicy[KeyT, ValueT]) victim() *node[KeyT, ValueT] {
+	if candidate := p.candidate; candidate != nil {
+		p.candidate = nil
+		victim := p.probation.back()
+		if victim == candidate {
+			victim = p.protected.back()
+		}
+		if victim != nil {
+			if p.frequency(candidate.key) > p.frequency(victim.key) {
+				return victim
+			}
+			return candidate
+		}
+	}
+
+	if victim := p.probation.back(); victim != nil {
+		return victim
+	}
+	if victim := p.protected.back(); victim != nil {
+		return victim
+	}
+	return p.window.back()
+}
+
+func (p *tinyLFUPolicy[KeyT, ValueT]) walk(f func(*node[KeyT, ValueT]) bool) {
+	if p.protected.walk(f) && p.window.walk(f) {
+		p.probation.walk(f)
+	}
+}
+
+func (p *tinyLFUPolicy[KeyT, ValueT]) reset() {
+	p.window = newList[KeyT, ValueT]()
+	p.probation = newList[KeyT, ValueT]()
+	p.protected = newList[KeyT, ValueT]()
+	p.candidate = nil
+}
+
+func (p *tinyLFUPolicy[KeyT, ValueT]) record(key KeyT) {
+	p.sketch.increment(hashKey(p.seed, key))
+}
+
+func (p *tinyLFUPolicy[KeyT, ValueT]) frequency(key KeyT) uint8 {
+	return p.sketch.estimate(hashKey(p.seed, key))
+}
+
+func (p *tinyLFUPolicy[KeyT, ValueT]) resident() int {
+	return p.window.len + p.probation.len + p.protected.len
+}
+
+func (p *tinyLFUPolicy[KeyT, ValueT]) windowLimit() int {
+	return max(1, p.resident()*tinyWindowPercent/100)
+}
+
+func (p *tinyLFUPolicy[KeyT, ValueT]) protectedLimit() int {
+	return max(1, (p.resident()-p.windowLimit())*tinyProtectedPercent/100)
+}
@@ -0,0 +1,82 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/v7ktory/wb_task_one/internal/entity"
+	"github.com/v7ktory/wb_task_one/internal/repo/pgdb"
+)
+
+const defaultWarmupPageSize = 10_000
+
+// Warmup fills the cache with the most recently used orders from postgres.
+//
+// Orders are read page by page from the most recent one and reading stops
+// as soon as the cache limits would be reached, so only orders that fit are
+// ever loaded. They are inserted from the least recent one, leaving the most
+// recent order at the front of the cache. sizeOf must be the function the
+// cache was configured with by SizeFunc, nil if it has none, or the byte
+// budget is misjudged. Warmup honors ctx cancellation between pages and
+// returns the number of cached orders.
+func Warmup(ctx context.Context, orderRepo pgdb.Order, c Cache[string, *entity.Order], sizeOf func(string, *entity.Order) int64, pageSize int, logger *slog.Logger) (int, error) {
+	const op = "cache.warmup.go - Warmup"
+
+	if pageSize <= 0 {
+		pageSize = defaultWarmupPageSize
+	}
+
+	stats := c.Stats()
+	maxEntries := stats.MaxEntries - stats.Entries
+	maxBytes := stats.MaxBytes - stats.Bytes
+	if stats.MaxEntries > 0 && maxEntries <= 0 || stats.MaxBytes > 0 && maxBytes <= 0 {
+		return 0, nil
+	}
+
+	// Only pointers are buffered, the orders end up in the cache anyway
+	var (
+		orders []*entity.Order
+		bytes  int64
+		cursor *pgdb.LRUCursor
+		full   bool
+	)
+	for !full {
+		if err := ctx.Err(); err != nil {
+			return 0, fmt.Errorf("%s - warmup aborted: %w", op, err)
+		}
+
+		page, next, err := orderRepo.GetLRUOrders(ctx, cursor, pageSize)
+		if err != nil {
+			return 0, fmt.Errorf("%s - orderRepo.GetLRUOrders: %w", op, err)
+		}
+
+		for _, order := range page {
+			if order == nil {
+				continue
+			}
+			var size int64
+			if sizeOf != nil {
+				size = sizeOf(order.UID, order)
+			}
+			if stats.MaxEntries > 0 && len(orders) >= maxEntries || stats.MaxBytes > 0 && bytes+size > maxBytes {
+				full = true
+				break
+			}
+			orders = append(orders, order)
+			bytes += size
+		}
+		logger.Info("Cache warmup progress", slog.Any("orders", len(orders)), slog.Any("bytes", bytes), slog.Any("operation", op))
+
+		if next == nil {
+			break
+		}
+		cursor = next
+	}
+
+	for i := len(orders) - 1; i >= 0; i-- {
+		c.Put(orders[i].UID, orders[i])
+	}
+
+	return len(orders), nil
+}
@@ -0,0 +1,129 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"testing"
+
+	"github.com/v7ktory/wb_task_one/internal/entity"
+	"github.com/v7ktory/wb_task_one/internal/repo/pgdb"
+)
+
+// pagedOrders serves GetLRUOrders from a slice sorted from the most
+// recently used order.
+type pagedOrders struct {
+	pgdb.Order
+	orders []*entity.Order
+	pages  int
+	cancel context.CancelFunc
+}
+
+func (p *pagedOrders) GetLRUOrders(ctx context.Context, after *pgdb.LRUCursor, limit int) ([]*entity.Order, *pgdb.LRUCursor, error) {
+	p.pages++
+	if p.cancel != nil {
+		p.cancel()
+	}
+
+	start := 0
+	if after != nil {
+		for i, order := range p.orders {
+			if order.UID == after.UID {
+				start = i + 1
+			}
+		}
+	}
+	end := min(start+limit, len(p.orders))
+	page := p.orders[start:end]
+	if end == len(p.orders) {
+		return page, nil, nil
+	}
+	return page, &pgdb.LRUCursor{UID: page[len(page)-1].UID}, nil
+}
+
+func TestWarmup(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	orders := make([]*entity.Order, 10)
+	for i := range orders {
+		orders[i] = &entity.Order{UID: fmt.Sprintf("uid%d", i)}
+	}
+
+	tests := []struct {
+		name     string
+		capacity int
+		maxBytes int64
+		pageSize int
+		warmed   int
+		pages    int
+		keys     []string
+	}{
+		{
+			name:     "Test cache larger than table",
+			capacity: 20,
+			pageSize: 4,
+			warmed:   10,
+			pages:    3,
+			keys:     []string{"uid0", "uid1", "uid2", "uid3", "uid4", "uid5", "uid6", "uid7", "uid8", "uid9"},
+		},
+		{
+			name:     "Test warmup stops at capacity",
+			capacity: 3,
+			pageSize: 2,
+			warmed:   3,
+			pages:    2,
+			keys:     []string{"uid0", "uid1", "uid2"},
+		},
+		{
+			name:     "Test warmup stops at byte budget",
+			capacity: 20,
+			maxBytes: 45,
+			pageSize: 2,
+			warmed:   4,
+			pages:    3,
+			keys:     []string{"uid0", "uid1", "uid2", "uid3"},
+		},
+	}
+	sizeOf := func(uid string, order *entity.Order) int64 { return 10 }
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &pagedOrders{orders: orders}
+			cache := NewLRUCache(tt.capacity, MaxBytes[string, *entity.Order](tt.maxBytes), SizeFunc(sizeOf))
+
+			warmed, err := Warmup(context.Background(), repo, cache, sizeOf, tt.pageSize, logger)
+			if err != nil {
+				t.Fatalf("Warmup() error = %v", err)
+			}
+			if warmed != tt.warmed {
+				t.Errorf("Expected warmed=%v, received=%v", tt.warmed, warmed)
+			}
+			if repo.pages != tt.pages {
+				t.Errorf("Expected pages=%v, received=%v", tt.pages, repo.pages)
+			}
+			keys := cache.Keys()
+			if fmt.Sprint(keys) != fmt.Sprint(tt.keys) {
+				t.Errorf("Expected keys=%v, received=%v", tt.keys, keys)
+			}
+		})
+	}
+}
+
+func TestWarmupCanceled(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	orders := []*entity.Order{{UID: "uid0"}, {UID: "uid1"}, {UID: "uid2"}}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	repo := &pagedOrders{orders: orders, cancel: cancel}
+	cache := NewLRUCache[string, *entity.Order](10)
+
+	if _, err := Warmup(ctx, repo, cache, nil, 1, logger); err == nil {
+		t.Errorf("Expected error for canceled warmup")
+	}
+	if repo.pages != 1 {
+		t.Errorf("Expected pages=%v, received=%v", 1, repo.pages)
+	}
+	if n := cache.Len(); n != 0 {
+		t.Errorf("Expected len=%v, received=%v", 0, n)
+	}
+}
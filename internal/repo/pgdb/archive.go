@@ -0,0 +1,76 @@
+package pgdb
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/v7ktory/wb_task_one/internal/entity"
+	"github.com/v7ktory/wb_task_one/pkg/postgres"
+)
+
+// ArchiveRepo keeps archived orders in the orders_archive table. Used in the
+// transaction deleting the orders, the move is atomic.
+type ArchiveRepo struct {
+	*postgres.Postgres
+}
+
+func NewArchiveRepo(pg *postgres.Postgres) *ArchiveRepo {
+	return &ArchiveRepo{
+		Postgres: pg,
+	}
+}
+
+// ArchiveOrders stores the orders, replacing earlier copies.
+func (a *ArchiveRepo) ArchiveOrders(ctx context.Context, orders []*entity.Order) error {
+	const op = "pgdb.archive.go - ArchiveOrders"
+
+	if len(orders) == 0 {
+		return nil
+	}
+
+	query := a.Builder.
+		Insert("orders_archive").
+		Columns("order_uid", "data", "customer_id", "date_created").
+		Suffix("ON CONFLICT (order_uid) DO UPDATE SET data = EXCLUDED.data, customer_id = EXCLUDED.customer_id, " +
+			"date_created = EXCLUDED.date_created, archived_at = now() AT TIME ZONE 'utc'")
+	for _, order := range orders {
+		data, err := json.Marshal(order)
+		if err != nil {
+			return fmt.Errorf("%s - json.Marshal: %w", op, err)
+		}
+		query = query.Values(order.UID, data, order.CustomerID, order.DateCreated)
+	}
+	sql, args, _ := query.ToSql()
+
+	if _, err := a.Querier(ctx).Exec(ctx, sql, args...); err != nil {
+		return fmt.Errorf("%s - Exec: %w", op, err)
+	}
+	return nil
+}
+
+func (a *ArchiveRepo) GetArchivedOrder(ctx context.Context, uid string) (*entity.Order, error) {
+	const op = "pgdb.archive.go - GetArchivedOrder"
+
+	sql, args, _ := a.Builder.
+		Select("data").
+		From("orders_archive").
+		Where("order_uid = ?", uid).
+		ToSql()
+
+	var data []byte
+	if err := a.Querier(ctx).QueryRow(ctx, sql, args...).Scan(&data); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("%s - QueryRow: %w", op, err)
+	}
+
+	order := new(entity.Order)
+	if err := json.Unmarshal(data, order); err != nil {
+		return nil, fmt.Errorf("%s - json.Unmarshal: %w", op, err)
+	}
+	return order, nil
+}
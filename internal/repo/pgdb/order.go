@@ -4,14 +4,39 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"time"
 
 	"github.com/Masterminds/squirrel"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/v7ktory/wb_task_one/internal/entity"
 	"github.com/v7ktory/wb_task_one/pkg/postgres"
 )
 
-var ErrAlreadyExists = errors.New("order already exists")
+var (
+	ErrAlreadyExists = errors.New("order already exists")
+	ErrNotFound      = errors.New("order not found")
+)
+
+// orderColumns are the columns of the orders table. The delivery, payment
+// and items of an order are stored in tables of their own.
+const orderColumns = "order_uid, track_number, entry, locale, internal_signature, customer_id, delivery_service, shardkey, sm_id, date_created, off_shard, version"
+
+// An order is read joined with its delivery and payment, the items are
+// loaded by loadItems.
+const (
+	orderSelect = "o.order_uid, o.track_number, o.entry, " +
+		"d.name, d.phone, d.zip, d.city, d.address, d.region, d.email, " +
+		"p.transaction, p.request_id, p.currency, p.provider, p.amount, p.payment_dt, p.bank, p.delivery_cost, p.goods_total, p.custom_fee, " +
+		"o.locale, o.internal_signature, o.customer_id, o.delivery_service, o.shardkey, o.sm_id, o.date_created, o.off_shard, o.version"
+	orderFrom = "orders o JOIN deliveries d ON d.order_uid = o.order_uid JOIN payments p ON p.order_uid = o.order_uid"
+)
+
+var (
+	deliveryColumns = []string{"order_uid", "name", "phone", "zip", "city", "address", "region", "email"}
+	paymentColumns  = []string{"order_uid", "transaction", "request_id", "currency", "provider", "amount", "payment_dt", "bank", "delivery_cost", "goods_total", "custom_fee"}
+	itemColumns     = []string{"order_uid", "position", "chrt_id", "track_number", "price", "rid", "name", "sale", "size", "total_price", "nm_id", "brand", "status"}
+)
 
 type OrderRepo struct {
 	*postgres.Postgres
@@ -23,87 +48,484 @@ func NewOrderRepo(pg *postgres.Postgres) *OrderRepo {
 	}
 }
 
+// SaveOrder inserts the order together with its delivery, payment and items
+// in one transaction.
 func (o *OrderRepo) SaveOrder(ctx context.Context, order *entity.Order) (string, error) {
 	const op = "pgdb.order.go - Save"
 
-	sql, args, _ := o.Builder.
+	err := o.WithTx(ctx, func(ctx context.Context, tx pgx.Tx) error {
+		sql, args, _ := o.Builder.
+			Insert("orders").
+			Columns(orderColumns).
+			Values(orderValues(order)...).
+			ToSql()
+		if _, err := tx.Exec(ctx, sql, args...); err != nil {
+			var pgErr *pgconn.PgError
+			if ok := errors.As(err, &pgErr); ok {
+				if pgErr.Code == "23505" {
+					return ErrAlreadyExists
+				}
+			}
+			return fmt.Errorf("tx.Exec: %w", err)
+		}
+		return insertDetails(ctx, tx, []*entity.Order{order})
+	})
+	if errors.Is(err, ErrAlreadyExists) {
+		return "", ErrAlreadyExists
+	}
+	if err != nil {
+		return "", fmt.Errorf("%s - %w", op, err)
+	}
+
+	return order.UID, nil
+}
+
+// SaveOrders inserts the orders in one transaction. The returned slice has an
+// entry per order, ErrAlreadyExists for the orders which were saved before or
+// repeat an earlier order of the batch, nil for the inserted ones.
+func (o *OrderRepo) SaveOrders(ctx context.Context, orders []*entity.Order) ([]error, error) {
+	const op = "pgdb.order.go - SaveOrders"
+
+	if len(orders) == 0 {
+		return nil, nil
+	}
+
+	query := o.Builder.
 		Insert("orders").
-		Columns("order_uid,track_number,entry,delivery,payment,items,locale,internal_signature,customer_id,delivery_service,shardkey,sm_id,date_created,off_shard").
-		Values(order.UID, order.TrackNumber, order.Entry, order.Delivery, order.Payment, order.Items, order.Locale, order.InternalSignature, order.CustomerID, order.DeliveryService, order.ShardKey, order.SmID, order.DateCreated, order.OffShard).
-		Suffix("RETURNING order_uid").
-		ToSql()
+		Columns(orderColumns).
+		Suffix("ON CONFLICT (order_uid) DO NOTHING RETURNING order_uid")
+	for _, order := range orders {
+		query = query.Values(orderValues(order)...)
+	}
+	sql, args, _ := query.ToSql()
 
-	var uid string
-	err := o.Pool.QueryRow(ctx, sql, args...).Scan(&uid)
-	if err != nil {
-		var pgErr *pgconn.PgError
-		if ok := errors.As(err, &pgErr); ok {
-			if pgErr.Code == "23505" {
-				return "", ErrAlreadyExists
+	results := make([]error, len(orders))
+	err := o.WithTx(ctx, func(ctx context.Context, tx pgx.Tx) error {
+		rows, err := tx.Query(ctx, sql, args...)
+		if err != nil {
+			return fmt.Errorf("tx.Query: %w", err)
+		}
+		uids, err := pgx.CollectRows(rows, pgx.RowTo[string])
+		if err != nil {
+			return fmt.Errorf("pgx.CollectRows: %w", err)
+		}
+		insertedUIDs := make(map[string]bool, len(uids))
+		for _, uid := range uids {
+			insertedUIDs[uid] = true
+		}
+
+		inserted := make([]*entity.Order, 0, len(uids))
+		for i, order := range orders {
+			if insertedUIDs[order.UID] {
+				// Only the first of repeated uids got inserted
+				delete(insertedUIDs, order.UID)
+				inserted = append(inserted, order)
+				continue
 			}
+			results[i] = ErrAlreadyExists
 		}
-		return "", fmt.Errorf("%s - Pool.QueryRow: %w", op, err)
+		return insertDetails(ctx, tx, inserted)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%s - %w", op, err)
 	}
-
-	return uid, nil
+	return results, nil
 }
 
-func (o *OrderRepo) GetLRUOrders(ctx context.Context) ([]*entity.Order, error) {
+// GetLRUOrders returns a page of orders from the most to the least recently
+// used, starting after the cursor, or from the most recent one if the cursor
+// is nil. The returned cursor points at the last order of the page and is
+// nil once there are no more orders.
+func (o *OrderRepo) GetLRUOrders(ctx context.Context, after *LRUCursor, limit int) ([]*entity.Order, *LRUCursor, error) {
 	const op = "pgdb.order.go - GetLRUOrders"
 
+	query := o.Builder.
+		Select(orderSelect+", o.last_accessed_at").
+		From(orderFrom).
+		OrderBy("o.last_accessed_at DESC", "o.order_uid DESC").
+		Limit(uint64(limit))
+	if after != nil {
+		query = query.Where("(o.last_accessed_at, o.order_uid) < (?, ?)", after.AccessedAt, after.UID)
+	}
+	sql, args, _ := query.ToSql()
+
+	orders := make([]*entity.Order, 0, limit)
+	rows, err := o.Querier(ctx).Query(ctx, sql, args...)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s - Query: %w", op, err)
+	}
+	defer rows.Close()
+
+	var next LRUCursor
+	for rows.Next() {
+		order, err := scanOrder(rows, &next.AccessedAt)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s - rows.Scan: %w", op, err)
+		}
+		next.UID = order.UID
+		orders = append(orders, order)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, fmt.Errorf("%s - rows.Err: %w", op, err)
+	}
+	if err := o.loadItems(ctx, o.Querier(ctx), orders); err != nil {
+		return nil, nil, fmt.Errorf("%s - %w", op, err)
+	}
+
+	if len(orders) < limit {
+		return orders, nil, nil
+	}
+	return orders, &next, nil
+}
+
+// GetIdleOrders returns a page of the orders not accessed since before, from
+// the least recently used on, starting after the cursor. The orders are
+// locked for update, skipping orders locked by another transaction, so in a
+// transaction concurrent callers get distinct orders. The returned cursor is
+// nil once there are no more orders.
+func (o *OrderRepo) GetIdleOrders(ctx context.Context, before time.Time, after *LRUCursor, limit int) ([]*entity.Order, *LRUCursor, error) {
+	const op = "pgdb.order.go - GetIdleOrders"
+
+	orders, next, err := o.idleOrders(ctx, before, after, limit, "FOR UPDATE OF o SKIP LOCKED")
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s - %w", op, err)
+	}
+	return orders, next, nil
+}
+
+// ListIdleOrders pages through the orders like GetIdleOrders without locking
+// them, so it includes the orders other transactions hold locked.
+func (o *OrderRepo) ListIdleOrders(ctx context.Context, before time.Time, after *LRUCursor, limit int) ([]*entity.Order, *LRUCursor, error) {
+	const op = "pgdb.order.go - ListIdleOrders"
+
+	orders, next, err := o.idleOrders(ctx, before, after, limit, "")
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s - %w", op, err)
+	}
+	return orders, next, nil
+}
+
+func (o *OrderRepo) idleOrders(ctx context.Context, before time.Time, after *LRUCursor, limit int, suffix string) ([]*entity.Order, *LRUCursor, error) {
+	query := o.Builder.
+		Select(orderSelect+", o.last_accessed_at").
+		From(orderFrom).
+		Where("o.last_accessed_at < ?", before).
+		OrderBy("o.last_accessed_at", "o.order_uid").
+		Limit(uint64(limit))
+	if suffix != "" {
+		query = query.Suffix(suffix)
+	}
+	if after != nil {
+		query = query.Where("(o.last_accessed_at, o.order_uid) > (?, ?)", after.AccessedAt, after.UID)
+	}
+	sql, args, _ := query.ToSql()
+
+	orders := make([]*entity.Order, 0, limit)
+	rows, err := o.Querier(ctx).Query(ctx, sql, args...)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Query: %w", err)
+	}
+	defer rows.Close()
+
+	var next LRUCursor
+	for rows.Next() {
+		order, err := scanOrder(rows, &next.AccessedAt)
+		if err != nil {
+			return nil, nil, fmt.Errorf("rows.Scan: %w", err)
+		}
+		next.UID = order.UID
+		orders = append(orders, order)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, fmt.Errorf("rows.Err: %w", err)
+	}
+	if err := o.loadItems(ctx, o.Querier(ctx), orders); err != nil {
+		return nil, nil, err
+	}
+
+	if len(orders) < limit {
+		return orders, nil, nil
+	}
+	return orders, &next, nil
+}
+
+// DeleteOrders deletes the orders, their delivery, payment and items go
+// along by the foreign keys.
+func (o *OrderRepo) DeleteOrders(ctx context.Context, uids []string) error {
+	const op = "pgdb.order.go - DeleteOrders"
+
+	if len(uids) == 0 {
+		return nil
+	}
+	sql, args, _ := o.Builder.
+		Delete("orders").
+		Where("order_uid = ANY(?)", uids).
+		ToSql()
+
+	if _, err := o.Querier(ctx).Exec(ctx, sql, args...); err != nil {
+		return fmt.Errorf("%s - Exec: %w", op, err)
+	}
+	return nil
+}
+
+// GetOrder reassembles the order from the orders table and the tables of
+// its delivery, payment and items.
+func (o *OrderRepo) GetOrder(ctx context.Context, uid string) (*entity.Order, error) {
+	const op = "pgdb.order.go - GetOrder"
+
+	order, err := o.getOrder(ctx, o.Querier(ctx), uid, "")
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("%s - %w", op, err)
+	}
+
+	return order, nil
+}
+
+// getOrder reads the order with the given suffix, e.g. a locking clause.
+func (o *OrderRepo) getOrder(ctx context.Context, q postgres.Querier, uid, suffix string) (*entity.Order, error) {
 	sql, args, _ := o.Builder.
-		Select("order_uid, track_number, entry, delivery, payment, items, locale, internal_signature, customer_id, delivery_service, shardkey, sm_id, date_created, off_shard").
-		From("orders").
-		OrderBy("created_at DESC").
-		Limit(1_073_741_824).
+		Select(orderSelect).
+		From(orderFrom).
+		Where("o.order_uid = ?", uid).
+		Suffix(suffix).
 		ToSql()
 
-	var orders []*entity.Order
-	rows, err := o.Pool.Query(ctx, sql, args...)
+	order, err := scanOrder(q.QueryRow(ctx, sql, args...))
 	if err != nil {
-		return nil, fmt.Errorf("%s - Pool.Query: %w", op, err)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("QueryRow: %w", err)
+	}
+	if err := o.loadItems(ctx, q, []*entity.Order{order}); err != nil {
+		return nil, err
+	}
+	return order, nil
+}
+
+// ListOrders returns a page of the orders matching the filter, starting after
+// the cursor, or from the first one if the cursor is nil. The returned cursor
+// points at the last order of the page and is nil once there are no more
+// orders.
+func (o *OrderRepo) ListOrders(ctx context.Context, filter OrderFilter, sort OrderSort, after *ListCursor, limit int) ([]*entity.Order, *ListCursor, error) {
+	const op = "pgdb.order.go - ListOrders"
+
+	direction, compare := "DESC", "<"
+	if sort == SortOldestFirst {
+		direction, compare = "ASC", ">"
+	}
+
+	// One extra row tells whether there is a next page
+	query := o.Builder.
+		Select(orderSelect).
+		From(orderFrom).
+		Where(filterOrders(filter)).
+		OrderBy("o.date_created "+direction, "o.order_uid "+direction).
+		Limit(uint64(limit) + 1)
+	if after != nil {
+		query = query.Where("(o.date_created, o.order_uid) "+compare+" (?, ?)", after.DateCreated, after.UID)
+	}
+	sql, args, _ := query.ToSql()
+
+	orders := make([]*entity.Order, 0, limit+1)
+	rows, err := o.Querier(ctx).Query(ctx, sql, args...)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s - Query: %w", op, err)
 	}
 	defer rows.Close()
 
 	for rows.Next() {
-		order := new(entity.Order)
-		err := rows.Scan(
-			&order.UID,
-			&order.TrackNumber,
-			&order.Entry,
-			&order.Delivery,
-			&order.Payment,
-			&order.Items,
-			&order.Locale,
-			&order.InternalSignature,
-			&order.CustomerID,
-			&order.DeliveryService,
-			&order.ShardKey,
-			&order.SmID,
-			&order.DateCreated,
-			&order.OffShard,
-		)
+		order, err := scanOrder(rows)
 		if err != nil {
-			return nil, fmt.Errorf("%s - rows.Scan: %w", op, err)
+			return nil, nil, fmt.Errorf("%s - rows.Scan: %w", op, err)
 		}
 		orders = append(orders, order)
 	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, fmt.Errorf("%s - rows.Err: %w", op, err)
+	}
 
-	return orders, nil
+	var next *ListCursor
+	if len(orders) > limit {
+		orders = orders[:limit]
+		last := orders[limit-1]
+		next = &ListCursor{DateCreated: last.DateCreated, UID: last.UID}
+	}
+	if err := o.loadItems(ctx, o.Querier(ctx), orders); err != nil {
+		return nil, nil, fmt.Errorf("%s - %w", op, err)
+	}
+	return orders, next, nil
+}
+
+// filterOrders translates the filter into conditions on orderFrom.
+func filterOrders(filter OrderFilter) squirrel.And {
+	conds := squirrel.And{}
+	if filter.CustomerID != "" {
+		conds = append(conds, squirrel.Eq{"o.customer_id": filter.CustomerID})
+	}
+	if filter.TrackNumber != "" {
+		conds = append(conds, squirrel.Eq{"o.track_number": filter.TrackNumber})
+	}
+	if filter.DeliveryService != "" {
+		conds = append(conds, squirrel.Eq{"o.delivery_service": filter.DeliveryService})
+	}
+	if filter.Locale != "" {
+		conds = append(conds, squirrel.Eq{"o.locale": filter.Locale})
+	}
+	if !filter.CreatedFrom.IsZero() {
+		conds = append(conds, squirrel.GtOrEq{"o.date_created": filter.CreatedFrom})
+	}
+	if !filter.CreatedTo.IsZero() {
+		conds = append(conds, squirrel.Lt{"o.date_created": filter.CreatedTo})
+	}
+	if filter.Currency != "" {
+		conds = append(conds, squirrel.Eq{"p.currency": filter.Currency})
+	}
+	if filter.Provider != "" {
+		conds = append(conds, squirrel.Eq{"p.provider": filter.Provider})
+	}
+	if filter.Brand != "" {
+		conds = append(conds, squirrel.Expr("EXISTS (SELECT 1 FROM order_items i WHERE i.order_uid = o.order_uid AND i.brand = ?)", filter.Brand))
+	}
+	if filter.NmID != 0 {
+		conds = append(conds, squirrel.Expr("EXISTS (SELECT 1 FROM order_items i WHERE i.order_uid = o.order_uid AND i.nm_id = ?)", filter.NmID))
+	}
+	return conds
 }
 
-func (o *OrderRepo) UpdateOrderTime(ctx context.Context, uid string) error {
-	const op = "pgdb.order.go - UpdateOrderTime"
+// TouchOrders sets the last access time of the orders in one statement. An
+// access time older than the stored one is ignored, so flushes arriving out
+// of order don't move it back.
+func (o *OrderRepo) TouchOrders(ctx context.Context, accesses map[string]time.Time) error {
+	const op = "pgdb.order.go - TouchOrders"
+
+	if len(accesses) == 0 {
+		return nil
+	}
+	uids := make([]string, 0, len(accesses))
+	times := make([]time.Time, 0, len(accesses))
+	for uid, accessedAt := range accesses {
+		uids = append(uids, uid)
+		times = append(times, accessedAt)
+	}
+
+	// squirrel can't bind arguments in the FROM of an UPDATE
+	const sql = "UPDATE orders o SET last_accessed_at = GREATEST(o.last_accessed_at, a.accessed_at) " +
+		"FROM unnest($1::text[], $2::timestamp[]) AS a(order_uid, accessed_at) " +
+		"WHERE o.order_uid = a.order_uid"
+
+	_, err := o.Querier(ctx).Exec(ctx, sql, uids, times)
+	if err != nil {
+		return fmt.Errorf("%s - Exec: %w", op, err)
+	}
+	return nil
+}
+
+// loadItems loads the items of the orders in one query.
+func (o *OrderRepo) loadItems(ctx context.Context, q postgres.Querier, orders []*entity.Order) error {
+	if len(orders) == 0 {
+		return nil
+	}
+
+	byUID := make(map[string]*entity.Order, len(orders))
+	uids := make([]string, 0, len(orders))
+	for _, order := range orders {
+		byUID[order.UID] = order
+		uids = append(uids, order.UID)
+	}
 
 	sql, args, _ := o.Builder.
-		Update("orders").
-		Set("created_at", squirrel.Expr("now() AT TIME ZONE 'utc'")).
-		Where("order_uid = ?", uid).
+		Select(itemColumns...).
+		From("order_items").
+		Where("order_uid = ANY(?)", uids).
+		OrderBy("order_uid", "position").
 		ToSql()
-
-	_, err := o.Pool.Exec(ctx, sql, args...)
+	rows, err := q.Query(ctx, sql, args...)
 	if err != nil {
-		return fmt.Errorf("%s - Pool.Query: %w", op, err)
+		return fmt.Errorf("load items: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var uid string
+		var position int
+		var item entity.ItemAttrs
+		err := rows.Scan(&uid, &position, &item.ChrtID, &item.TrackNumber, &item.Price, &item.Rid, &item.Name, &item.Sale, &item.Size, &item.TotalPrice, &item.NmID, &item.Brand, &item.Status)
+		if err != nil {
+			return fmt.Errorf("scan item: %w", err)
+		}
+		byUID[uid].Items = append(byUID[uid].Items, item)
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("load items: %w", err)
 	}
 	return nil
 }
+
+// insertDetails copies the delivery, payment and items of the orders into
+// their tables. COPY isn't bound by the parameter limit of a statement, but
+// must run in the transaction inserting the orders.
+func insertDetails(ctx context.Context, q postgres.Querier, orders []*entity.Order) error {
+	if len(orders) == 0 {
+		return nil
+	}
+
+	deliveries := make([][]any, 0, len(orders))
+	payments := make([][]any, 0, len(orders))
+	var items [][]any
+	for _, order := range orders {
+		d := order.Delivery
+		deliveries = append(deliveries, []any{order.UID, d.Name, d.Phone, d.Zip, d.City, d.Address, d.Region, d.Email})
+		p := order.Payment
+		payments = append(payments, []any{order.UID, p.Transaction, p.RequestID, p.Currency, p.Provider, p.Amount, p.PaymentDt, p.Bank, p.DeliveryCost, p.GoodsTotal, p.CustomFee})
+		for position, i := range order.Items {
+			items = append(items, []any{order.UID, position, i.ChrtID, i.TrackNumber, i.Price, i.Rid, i.Name, i.Sale, i.Size, i.TotalPrice, i.NmID, i.Brand, i.Status})
+		}
+	}
+
+	if _, err := q.CopyFrom(ctx, pgx.Identifier{"deliveries"}, deliveryColumns, pgx.CopyFromRows(deliveries)); err != nil {
+		return fmt.Errorf("copy deliveries: %w", err)
+	}
+	if _, err := q.CopyFrom(ctx, pgx.Identifier{"payments"}, paymentColumns, pgx.CopyFromRows(payments)); err != nil {
+		return fmt.Errorf("copy payments: %w", err)
+	}
+	if _, err := q.CopyFrom(ctx, pgx.Identifier{"order_items"}, itemColumns, pgx.CopyFromRows(items)); err != nil {
+		return fmt.Errorf("copy items: %w", err)
+	}
+	return nil
+}
+
+// orderValues returns the values of the orderColumns.
+func orderValues(order *entity.Order) []any {
+	return []any{order.UID, order.TrackNumber, order.Entry, order.Locale, order.InternalSignature, order.CustomerID, order.DeliveryService, order.ShardKey, order.SmID, order.DateCreated, order.OffShard, order.Version}
+}
+
+// scanOrder scans the orderSelect columns of a row followed by the extra
+// columns. The items are left to loadItems.
+func scanOrder(row pgx.Row, extra ...any) (*entity.Order, error) {
+	order := new(entity.Order)
+	d, p := &order.Delivery, &order.Payment
+	dest := []any{
+		&order.UID,
+		&order.TrackNumber,
+		&order.Entry,
+		&d.Name, &d.Phone, &d.Zip, &d.City, &d.Address, &d.Region, &d.Email,
+		&p.Transaction, &p.RequestID, &p.Currency, &p.Provider, &p.Amount, &p.PaymentDt, &p.Bank, &p.DeliveryCost, &p.GoodsTotal, &p.CustomFee,
+		&order.Locale,
+		&order.InternalSignature,
+		&order.CustomerID,
+		&order.DeliveryService,
+		&order.ShardKey,
+		&order.SmID,
+		&order.DateCreated,
+		&order.OffShard,
+		&order.Version,
+	}
+	if err := row.Scan(append(dest, extra...)...); err != nil {
+		return nil, err
+	}
+	return order, nil
+}
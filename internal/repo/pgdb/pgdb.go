@@ -2,6 +2,7 @@ package pgdb
 
 import (
 	"context"
+	"time"
 
 	"github.com/v7ktory/wb_task_one/internal/entity"
 	"github.com/v7ktory/wb_task_one/pkg/postgres"
@@ -9,9 +10,76 @@ import (
 
 type Order interface {
 	SaveOrder(ctx context.Context, order *entity.Order) (string, error)
-	GetLRUOrders(ctx context.Context) ([]*entity.Order, error)
-	UpdateOrderTime(ctx context.Context, uid string) error
+	SaveOrders(ctx context.Context, orders []*entity.Order) ([]error, error)
+	DeleteOrders(ctx context.Context, uids []string) error
+	GetIdleOrders(ctx context.Context, before time.Time, after *LRUCursor, limit int) ([]*entity.Order, *LRUCursor, error)
+	GetLRUOrders(ctx context.Context, after *LRUCursor, limit int) ([]*entity.Order, *LRUCursor, error)
+	GetOrder(ctx context.Context, uid string) (*entity.Order, error)
+	ListIdleOrders(ctx context.Context, before time.Time, after *LRUCursor, limit int) ([]*entity.Order, *LRUCursor, error)
+	ListOrders(ctx context.Context, filter OrderFilter, sort OrderSort, after *ListCursor, limit int) ([]*entity.Order, *ListCursor, error)
+	TouchOrders(ctx context.Context, accesses map[string]time.Time) error
+	UpsertOrder(ctx context.Context, order *entity.Order, mode WriteMode) (WriteResult, error)
 }
+
+// Archive keeps orders removed from the orders table by the retention job.
+type Archive interface {
+	ArchiveOrders(ctx context.Context, orders []*entity.Order) error
+	// GetArchivedOrder returns ErrNotFound for orders which aren't archived
+	GetArchivedOrder(ctx context.Context, uid string) (*entity.Order, error)
+}
+
+// StagedArchive is an archive which can't take part in a postgres
+// transaction. StageOrders stores the orders durably but hidden from lookups,
+// so the transaction deleting them decides whether they are published or
+// discarded.
+type StagedArchive interface {
+	Archive
+	StageOrders(ctx context.Context, orders []*entity.Order) (StagedOrders, error)
+}
+
+// StagedOrders are archived orders not yet visible to GetArchivedOrder.
+type StagedOrders interface {
+	Publish() error
+	Discard() error
+}
+
+// LRUCursor is the position of an order in the order of recent use.
+type LRUCursor struct {
+	AccessedAt time.Time
+	UID        string
+}
+
+// OrderFilter narrows ListOrders down. Zero fields don't filter, set fields
+// must all match. The date_created range includes From and excludes To.
+type OrderFilter struct {
+	CustomerID      string
+	TrackNumber     string
+	DeliveryService string
+	Locale          string
+	CreatedFrom     time.Time
+	CreatedTo       time.Time
+	Currency        string
+	Provider        string
+	// Brand and NmID match orders with at least one such item
+	Brand string
+	NmID  int
+}
+
+// OrderSort is the order of ListOrders results, always by date_created with
+// order_uid as the tie breaker.
+type OrderSort string
+
+const (
+	SortNewestFirst OrderSort = "-date_created"
+	SortOldestFirst OrderSort = "date_created"
+)
+
+// ListCursor is the position of an order in the ListOrders results.
+type ListCursor struct {
+	DateCreated time.Time
+	UID         string
+}
+
 type PgRepo struct {
 	Order
 }
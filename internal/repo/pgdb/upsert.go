@@ -0,0 +1,199 @@
+package pgdb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/v7ktory/wb_task_one/internal/entity"
+)
+
+// ErrConflict is returned by idempotent writes of an order which exists
+// with a different content.
+var ErrConflict = errors.New("order exists with a different content")
+
+// WriteMode decides what writing an order which already exists does.
+type WriteMode string
+
+const (
+	// WriteStrict fails with ErrAlreadyExists.
+	WriteStrict WriteMode = "strict"
+	// WriteIdempotent succeeds if the content is the same, fails with
+	// ErrConflict otherwise.
+	WriteIdempotent WriteMode = "idempotent"
+	// WriteUpsertByDate replaces the order if date_created is later.
+	WriteUpsertByDate WriteMode = "upsert_by_date"
+	// WriteUpsertByVersion replaces the order if the version is higher.
+	WriteUpsertByVersion WriteMode = "upsert_by_version"
+)
+
+// ParseWriteMode checks the name of a write mode, e.g. from the config.
+func ParseWriteMode(s string) (WriteMode, error) {
+	switch mode := WriteMode(s); mode {
+	case WriteStrict, WriteIdempotent, WriteUpsertByDate, WriteUpsertByVersion:
+		return mode, nil
+	}
+	return "", fmt.Errorf("unknown write mode %q", s)
+}
+
+// Outcomes of a write
+const (
+	OutcomeInserted  = "inserted"
+	OutcomeUpdated   = "updated"
+	OutcomeUnchanged = "unchanged"
+	// OutcomeStale means the stored order is newer and was kept
+	OutcomeStale = "stale"
+)
+
+type WriteResult struct {
+	Outcome string
+	// Changed lists the json names of the fields an update changed
+	Changed []string
+}
+
+// UpsertOrder writes the order according to the mode and records inserts
+// and updates in order_changes, all in one transaction.
+func (o *OrderRepo) UpsertOrder(ctx context.Context, order *entity.Order, mode WriteMode) (WriteResult, error) {
+	const op = "pgdb.upsert.go - UpsertOrder"
+
+	if mode == WriteStrict {
+		if _, err := o.SaveOrder(ctx, order); err != nil {
+			return WriteResult{}, err
+		}
+		return WriteResult{Outcome: OutcomeInserted}, nil
+	}
+
+	var result WriteResult
+	err := o.WithTx(ctx, func(ctx context.Context, tx pgx.Tx) error {
+		var err error
+		result, err = o.upsert(ctx, tx, order, mode)
+		return err
+	})
+	if err != nil {
+		return WriteResult{}, fmt.Errorf("%s - %w", op, err)
+	}
+	return result, nil
+}
+
+func (o *OrderRepo) upsert(ctx context.Context, tx pgx.Tx, order *entity.Order, mode WriteMode) (WriteResult, error) {
+	// Insert unless the order exists, which also settles concurrent inserts
+	sql, args, _ := o.Builder.
+		Insert("orders").
+		Columns(orderColumns).
+		Values(orderValues(order)...).
+		Suffix("ON CONFLICT (order_uid) DO NOTHING").
+		ToSql()
+	tag, err := tx.Exec(ctx, sql, args...)
+	if err != nil {
+		return WriteResult{}, fmt.Errorf("insert: %w", err)
+	}
+	if tag.RowsAffected() == 1 {
+		if err := insertDetails(ctx, tx, []*entity.Order{order}); err != nil {
+			return WriteResult{}, err
+		}
+		err := o.recordChange(ctx, tx, order.UID, OutcomeInserted, nil, nil)
+		return WriteResult{Outcome: OutcomeInserted}, err
+	}
+
+	stored, err := o.getOrder(ctx, tx, order.UID, "FOR UPDATE OF o")
+	if err != nil {
+		return WriteResult{}, fmt.Errorf("select: %w", err)
+	}
+
+	changed, previous := diffOrders(stored, order)
+	if len(changed) == 0 {
+		return WriteResult{Outcome: OutcomeUnchanged}, nil
+	}
+	switch mode {
+	case WriteIdempotent:
+		return WriteResult{}, ErrConflict
+	case WriteUpsertByDate:
+		if !order.DateCreated.After(stored.DateCreated) {
+			return WriteResult{Outcome: OutcomeStale}, nil
+		}
+	case WriteUpsertByVersion:
+		if order.Version <= stored.Version {
+			return WriteResult{Outcome: OutcomeStale}, nil
+		}
+	}
+
+	sql, args, _ = o.Builder.
+		Update("orders").
+		SetMap(map[string]any{
+			"track_number":       order.TrackNumber,
+			"entry":              order.Entry,
+			"locale":             order.Locale,
+			"internal_signature": order.InternalSignature,
+			"customer_id":        order.CustomerID,
+			"delivery_service":   order.DeliveryService,
+			"shardkey":           order.ShardKey,
+			"sm_id":              order.SmID,
+			"date_created":       order.DateCreated,
+			"off_shard":          order.OffShard,
+			"version":            order.Version,
+		}).
+		Where("order_uid = ?", order.UID).
+		ToSql()
+	if _, err := tx.Exec(ctx, sql, args...); err != nil {
+		return WriteResult{}, fmt.Errorf("update: %w", err)
+	}
+	// The delivery, payment and items are replaced as a whole
+	for _, table := range []string{"deliveries", "payments", "order_items"} {
+		sql, args, _ := o.Builder.Delete(table).Where("order_uid = ?", order.UID).ToSql()
+		if _, err := tx.Exec(ctx, sql, args...); err != nil {
+			return WriteResult{}, fmt.Errorf("delete %s: %w", table, err)
+		}
+	}
+	if err := insertDetails(ctx, tx, []*entity.Order{order}); err != nil {
+		return WriteResult{}, err
+	}
+
+	err = o.recordChange(ctx, tx, order.UID, OutcomeUpdated, changed, previous)
+	return WriteResult{Outcome: OutcomeUpdated, Changed: changed}, err
+}
+
+func (o *OrderRepo) recordChange(ctx context.Context, tx pgx.Tx, uid, change string, fields []string, previous map[string]any) error {
+	if fields == nil {
+		fields = []string{}
+	}
+	sql, args, _ := o.Builder.
+		Insert("order_changes").
+		Columns("order_uid", "change", "fields", "previous").
+		Values(uid, change, fields, previous).
+		ToSql()
+	if _, err := tx.Exec(ctx, sql, args...); err != nil {
+		return fmt.Errorf("record change: %w", err)
+	}
+	return nil
+}
+
+// diffOrders returns the json names of the fields which differ and their
+// stored values.
+func diffOrders(stored, order *entity.Order) ([]string, map[string]any) {
+	var changed []string
+	previous := make(map[string]any)
+	diff := func(name string, equal bool, value any) {
+		if !equal {
+			changed = append(changed, name)
+			previous[name] = value
+		}
+	}
+
+	diff("track_number", stored.TrackNumber == order.TrackNumber, stored.TrackNumber)
+	diff("entry", stored.Entry == order.Entry, stored.Entry)
+	diff("delivery", stored.Delivery == order.Delivery, stored.Delivery)
+	diff("payment", stored.Payment == order.Payment, stored.Payment)
+	diff("items", slices.Equal(stored.Items, order.Items), stored.Items)
+	diff("locale", stored.Locale == order.Locale, stored.Locale)
+	diff("internal_signature", stored.InternalSignature == order.InternalSignature, stored.InternalSignature)
+	diff("customer_id", stored.CustomerID == order.CustomerID, stored.CustomerID)
+	diff("delivery_service", stored.DeliveryService == order.DeliveryService, stored.DeliveryService)
+	diff("shardkey", stored.ShardKey == order.ShardKey, stored.ShardKey)
+	diff("sm_id", stored.SmID == order.SmID, stored.SmID)
+	diff("date_created", stored.DateCreated.Equal(order.DateCreated), stored.DateCreated)
+	diff("off_shard", stored.OffShard == order.OffShard, stored.OffShard)
+	diff("version", stored.Version == order.Version, stored.Version)
+	return changed, previous
+}
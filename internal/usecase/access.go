@@ -0,0 +1,141 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/v7ktory/wb_task_one/internal/repo/pgdb"
+)
+
+const (
+	DefaultAccessFlushInterval = 5 * time.Second
+	DefaultAccessMaxPending    = 100_000
+	// bounds the last flush on shutdown
+	accessShutdownTimeout = 5 * time.Second
+)
+
+// AccessTracker records when orders are read and writes the access times to
+// postgres in batches, so reads neither wait for nor fail on a write.
+type AccessTracker struct {
+	orderRepo  pgdb.Order
+	interval   time.Duration
+	maxPending int
+	logger     *slog.Logger
+
+	mu      sync.Mutex
+	pending map[string]time.Time
+	dropped int
+	full    chan struct{}
+}
+
+// NewAccessTracker returns a tracker flushing every interval, or earlier
+// once maxPending orders wait for the flush. Non-positive values take the
+// defaults.
+func NewAccessTracker(orderRepo pgdb.Order, interval time.Duration, maxPending int, logger *slog.Logger) *AccessTracker {
+	if interval <= 0 {
+		interval = DefaultAccessFlushInterval
+	}
+	if maxPending <= 0 {
+		maxPending = DefaultAccessMaxPending
+	}
+	return &AccessTracker{
+		orderRepo:  orderRepo,
+		interval:   interval,
+		maxPending: maxPending,
+		logger:     logger,
+		pending:    make(map[string]time.Time),
+		full:       make(chan struct{}, 1),
+	}
+}
+
+// Record notes an access to the order. It never blocks: while maxPending
+// orders wait for the flush, accesses to further orders are dropped. Record
+// is a no-op on a nil tracker.
+func (t *AccessTracker) Record(uid string) {
+	if t == nil {
+		return
+	}
+	now := time.Now().UTC()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if _, found := t.pending[uid]; !found && len(t.pending) >= t.maxPending {
+		t.dropped++
+		return
+	}
+	t.pending[uid] = now
+	if len(t.pending) >= t.maxPending {
+		select {
+		case t.full <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Run flushes the recorded accesses periodically until ctx is done, then
+// one last time.
+func (t *AccessTracker) Run(ctx context.Context) {
+	ticker := time.NewTicker(t.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-t.full:
+		case <-ctx.Done():
+			flushCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), accessShutdownTimeout)
+			defer cancel()
+			t.Flush(flushCtx)
+			return
+		}
+		t.Flush(ctx)
+	}
+}
+
+// Flush writes the recorded accesses in one statement. After a failure the
+// accesses are kept for the next flush, as far as there is room.
+func (t *AccessTracker) Flush(ctx context.Context) error {
+	const op = "usecase.access.go - Flush"
+
+	t.mu.Lock()
+	pending, dropped := t.pending, t.dropped
+	t.pending, t.dropped = make(map[string]time.Time, len(pending)), 0
+	t.mu.Unlock()
+
+	if dropped > 0 {
+		t.logger.Warn("Order accesses dropped, too many pending", slog.Any("dropped", dropped), slog.Any("operation", op))
+	}
+	if len(pending) == 0 {
+		return nil
+	}
+
+	if err := t.orderRepo.TouchOrders(ctx, pending); err != nil {
+		t.logger.Error("Failed to save order accesses", slog.Any("error", err.Error()), slog.Any("orders", len(pending)), slog.Any("operation", op))
+		t.restore(pending)
+		return fmt.Errorf("%s - orderRepo.TouchOrders: %w", op, err)
+	}
+	t.logger.Debug("Order accesses saved", slog.Any("orders", len(pending)), slog.Any("operation", op))
+	return nil
+}
+
+// restore puts back the accesses of a failed flush, unless newer ones were
+// recorded meanwhile.
+func (t *AccessTracker) restore(accesses map[string]time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for uid, accessedAt := range accesses {
+		if _, found := t.pending[uid]; found {
+			continue
+		}
+		if len(t.pending) >= t.maxPending {
+			t.dropped++
+			continue
+		}
+		t.pending[uid] = accessedAt
+	}
+}
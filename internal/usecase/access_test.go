@@ -0,0 +1,53 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/mock"
+	"github.com/v7ktory/wb_task_one/internal/controller/mocks"
+)
+
+func TestAccessTracker(t *testing.T) {
+	mockLogger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	mockOrder := mocks.NewOrder(t)
+	tracker := NewAccessTracker(mockOrder, time.Hour, 2, mockLogger)
+
+	var flushed []map[string]time.Time
+	touch := func(ctx context.Context, accesses map[string]time.Time) error {
+		flushed = append(flushed, accesses)
+		return nil
+	}
+
+	// The third order exceeds maxPending and is dropped
+	tracker.Record("a")
+	tracker.Record("b")
+	tracker.Record("a")
+	tracker.Record("c")
+
+	mockOrder.On("TouchOrders", mock.Anything, mock.Anything).Return(errors.New("connection refused")).Once()
+	if err := tracker.Flush(context.Background()); err == nil {
+		t.Errorf("Expected an error, received=%v", err)
+	}
+
+	// The failed accesses are flushed with the next batch
+	mockOrder.On("TouchOrders", mock.Anything, mock.Anything).Return(touch).Once()
+	if err := tracker.Flush(context.Background()); err != nil {
+		t.Errorf("Expected err=%v, received=%v", nil, err)
+	}
+	if len(flushed) != 1 {
+		t.Fatalf("Expected flushes=%v, received=%v", 1, len(flushed))
+	}
+	if _, found := flushed[0]["c"]; len(flushed[0]) != 2 || found {
+		t.Errorf("Expected accesses=%v, received=%v", "a, b", flushed[0])
+	}
+
+	// Nothing recorded, nothing written
+	if err := tracker.Flush(context.Background()); err != nil {
+		t.Errorf("Expected err=%v, received=%v", nil, err)
+	}
+}
@@ -0,0 +1,150 @@
+package usecase
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+
+	"github.com/v7ktory/wb_task_one/internal/entity"
+	"github.com/v7ktory/wb_task_one/internal/model"
+	"github.com/v7ktory/wb_task_one/internal/repo/pgdb"
+)
+
+const (
+	DefaultImportBatchSize = 500
+	// postgres accepts at most 65535 parameters per statement, 12 per order
+	maxImportBatchSize = 4_000
+	// longest accepted line, an order is a few kilobytes
+	maxImportLineSize = 1 << 20
+)
+
+// Statuses of an imported line
+const (
+	ImportAccepted  = "accepted"
+	ImportDuplicate = "duplicate"
+	ImportInvalid   = "invalid"
+	// a newer version of the order is saved, the line was ignored
+	ImportStale = "stale"
+)
+
+// ImportLine reports the outcome of one non-empty line of an import.
+type ImportLine struct {
+	Line     int               `json:"line"`
+	UID      string            `json:"order_uid,omitempty"`
+	Status   string            `json:"status"`
+	Error    string            `json:"error,omitempty"`
+	Problems map[string]string `json:"problems,omitempty"`
+}
+
+type ImportReport struct {
+	Accepted  int          `json:"accepted"`
+	Duplicate int          `json:"duplicate"`
+	Invalid   int          `json:"invalid"`
+	Stale     int          `json:"stale"`
+	Lines     []ImportLine `json:"lines"`
+}
+
+func (r *ImportReport) add(line ImportLine) {
+	switch line.Status {
+	case ImportAccepted:
+		r.Accepted++
+	case ImportDuplicate:
+		r.Duplicate++
+	case ImportInvalid:
+		r.Invalid++
+	case ImportStale:
+		r.Stale++
+	}
+	r.Lines = append(r.Lines, line)
+}
+
+// Import reads newline-delimited JSON orders, validates each and saves the
+// valid ones batchSize at a time. Invalid lines don't stop the import, but a
+// failed batch does: the report then covers the lines saved before it.
+func (u *OrderUseCase) Import(ctx context.Context, r io.Reader, batchSize int) (ImportReport, error) {
+	const op = "usecase.import.go - Import"
+
+	if batchSize <= 0 {
+		batchSize = DefaultImportBatchSize
+	}
+	batchSize = min(batchSize, maxImportBatchSize)
+
+	var report ImportReport
+	batch := make([]*entity.Order, 0, batchSize)
+	batchLines := make([]int, 0, batchSize)
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		writeResults, results, err := u.saveBatch(ctx, batch)
+		if err != nil {
+			return err
+		}
+		for i, order := range batch {
+			line := ImportLine{Line: batchLines[i], UID: order.UID, Status: ImportAccepted}
+			switch {
+			case results[i] == nil && writeResults[i].Outcome == pgdb.OutcomeStale:
+				line.Status = ImportStale
+				line.Error = "a newer version of the order is saved"
+			case results[i] == nil:
+			case errors.Is(results[i], pgdb.ErrAlreadyExists):
+				line.Status = ImportDuplicate
+			case errors.Is(results[i], pgdb.ErrConflict):
+				line.Status = ImportInvalid
+				line.Error = pgdb.ErrConflict.Error()
+			default:
+				return results[i]
+			}
+			report.add(line)
+		}
+		batch = batch[:0]
+		batchLines = batchLines[:0]
+		return nil
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64<<10), maxImportLineSize)
+	n := 0
+	for scanner.Scan() {
+		n++
+		data := scanner.Bytes()
+		if len(bytes.TrimSpace(data)) == 0 {
+			continue
+		}
+
+		var orderRequest model.Order
+		if err := json.Unmarshal(data, &orderRequest); err != nil {
+			report.add(ImportLine{Line: n, Status: ImportInvalid, Error: fmt.Sprintf("decode json: %s", err)})
+			continue
+		}
+		if problems := orderRequest.Valid(ctx); len(problems) > 0 {
+			report.add(ImportLine{Line: n, UID: orderRequest.UID, Status: ImportInvalid, Problems: problems})
+			continue
+		}
+
+		batch = append(batch, convertOrder(orderRequest))
+		batchLines = append(batchLines, n)
+		if len(batch) == batchSize {
+			if err := flush(); err != nil {
+				return report, fmt.Errorf("%s - %w", op, err)
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return report, fmt.Errorf("%s - read line %d: %w", op, n+1, err)
+	}
+	if err := flush(); err != nil {
+		return report, fmt.Errorf("%s - %w", op, err)
+	}
+
+	u.logger.Info("Orders imported", slog.Any("accepted", report.Accepted), slog.Any("duplicate", report.Duplicate), slog.Any("invalid", report.Invalid), slog.Any("stale", report.Stale), slog.Any("operation", op))
+	return report, nil
+}
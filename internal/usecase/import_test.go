@@ -0,0 +1,106 @@
+package usecase
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/mock"
+	"github.com/v7ktory/wb_task_one/internal/controller/mocks"
+	"github.com/v7ktory/wb_task_one/internal/entity"
+	"github.com/v7ktory/wb_task_one/internal/model"
+	"github.com/v7ktory/wb_task_one/internal/repo/pgdb"
+)
+
+func TestImport(t *testing.T) {
+	mockLogger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	mockOrder := mocks.NewOrder(t)
+	mockCache := mocks.NewCache[string, *entity.Order](t)
+
+	line := func(uid string) string {
+		order := testOrder()
+		order.UID = uid
+		data, _ := json.Marshal(order)
+		return string(data)
+	}
+	input := strings.Join([]string{
+		line("order1"),
+		line("order2"),
+		`Invalid message`,
+		"",
+		line("order3"),
+		`{"order_uid": "order4"}`,
+	}, "\n")
+
+	mockOrder.On("SaveOrders", mock.Anything, mock.MatchedBy(func(orders []*entity.Order) bool {
+		return len(orders) == 2 && orders[0].UID == "order1" && orders[1].UID == "order2"
+	})).Return([]error{nil, pgdb.ErrAlreadyExists}, nil).Once()
+	mockOrder.On("SaveOrders", mock.Anything, mock.MatchedBy(func(orders []*entity.Order) bool {
+		return len(orders) == 1 && orders[0].UID == "order3"
+	})).Return([]error{nil}, nil).Once()
+	mockCache.On("Put", "order1", mock.AnythingOfType("*entity.Order")).Return().Once()
+	mockCache.On("Put", "order3", mock.AnythingOfType("*entity.Order")).Return().Once()
+
+	u := NewOrderUseCase(mockOrder, pgdb.WriteStrict, mockCache, nil, mockLogger)
+	report, err := u.Import(context.Background(), strings.NewReader(input), 2)
+	if err != nil {
+		t.Fatalf("Import: %v", err)
+	}
+
+	if report.Accepted != 2 || report.Duplicate != 1 || report.Invalid != 2 {
+		t.Errorf("Expected accepted=2 duplicate=1 invalid=2, received accepted=%v duplicate=%v invalid=%v", report.Accepted, report.Duplicate, report.Invalid)
+	}
+	expected := map[int]string{1: ImportAccepted, 2: ImportDuplicate, 3: ImportInvalid, 5: ImportAccepted, 6: ImportInvalid}
+	for _, l := range report.Lines {
+		if expected[l.Line] != l.Status {
+			t.Errorf("Expected line %d status=%v, received=%v", l.Line, expected[l.Line], l.Status)
+		}
+	}
+	if len(report.Lines) != len(expected) {
+		t.Errorf("Expected lines=%v, received=%v", len(expected), len(report.Lines))
+	}
+}
+
+func TestImportStale(t *testing.T) {
+	mockLogger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	mockOrder := mocks.NewOrder(t)
+	mockCache := mocks.NewCache[string, *entity.Order](t)
+
+	data, _ := json.Marshal(testOrder())
+	mockOrder.On("SaveOrders", mock.Anything, mock.Anything).Return([]error{pgdb.ErrAlreadyExists}, nil)
+	mockOrder.On("UpsertOrder", mock.Anything, mock.AnythingOfType("*entity.Order"), pgdb.WriteUpsertByVersion).Return(pgdb.WriteResult{Outcome: pgdb.OutcomeStale}, nil)
+
+	u := NewOrderUseCase(mockOrder, pgdb.WriteUpsertByVersion, mockCache, nil, mockLogger)
+	report, err := u.Import(context.Background(), strings.NewReader(string(data)), 0)
+	if err != nil {
+		t.Fatalf("Import: %v", err)
+	}
+
+	if report.Accepted != 0 || report.Stale != 1 {
+		t.Errorf("Expected accepted=0 stale=1, received accepted=%v stale=%v", report.Accepted, report.Stale)
+	}
+	if len(report.Lines) != 1 || report.Lines[0].Status != ImportStale {
+		t.Errorf("Expected lines=%v, received=%v", []string{ImportStale}, report.Lines)
+	}
+}
+
+func testOrder() model.Order {
+	return model.Order{
+		UID:             "b563feb7b2b84b6test",
+		TrackNumber:     "WBILMTESTTRACK",
+		Entry:           "WBIL",
+		Items:           []model.ItemAttrs{{ChrtID: 9934930, Price: 453, Name: "Mascaras", NmID: 2389212, Brand: "Vivienne Sabo"}},
+		Locale:          "en",
+		CustomerID:      "test",
+		DeliveryService: "meest",
+		ShardKey:        "9",
+		SmID:            99,
+		DateCreated:     time.Date(2021, 11, 26, 6, 22, 19, 0, time.UTC),
+		Delivery:        model.DeliveryAttrs{Name: "Test Testov", Phone: "+9720000000", Zip: "2639809", City: "Kiryat Mozkin", Address: "Ploshad Mira 15", Region: "Kraiot", Email: "test@gmail.com"},
+		Payment:         model.PaymentAttrs{Transaction: "b563feb7b2b84b6test", Currency: "USD", Provider: "wbpay", Amount: 1817},
+	}
+}
@@ -0,0 +1,176 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/v7ktory/wb_task_one/internal/entity"
+	"github.com/v7ktory/wb_task_one/internal/model"
+	"github.com/v7ktory/wb_task_one/internal/repo/cache"
+	"github.com/v7ktory/wb_task_one/internal/repo/pgdb"
+)
+
+// Kinds of order changes announced to the other instances
+const (
+	ChangeUpsert = "upsert"
+	ChangeDelete = "delete"
+)
+
+// Notifier announces changed orders to the other instances.
+type Notifier interface {
+	Publish(uid, change string) error
+}
+
+// ValidationError is returned for orders failing model.Order.Valid.
+type ValidationError struct {
+	Problems map[string]string
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("invalid order: %d problems", len(e.Problems))
+}
+
+// OrderUseCase is the single way orders enter the system, whether they come
+// from NATS or over HTTP.
+type OrderUseCase struct {
+	orderRepo pgdb.Order
+	writeMode pgdb.WriteMode
+	cache     cache.Cache[string, *entity.Order]
+	notifier  Notifier
+	logger    *slog.Logger
+}
+
+// NewOrderUseCase returns the ingestion service. The write mode decides what
+// happens to orders saved before, strict by default. The cache may be nil
+// when the process doesn't serve orders, e.g. a one-off import, and the
+// notifier when there are no other instances to tell.
+func NewOrderUseCase(orderRepo pgdb.Order, writeMode pgdb.WriteMode, cache cache.Cache[string, *entity.Order], notifier Notifier, logger *slog.Logger) *OrderUseCase {
+	if writeMode == "" {
+		writeMode = pgdb.WriteStrict
+	}
+	return &OrderUseCase{
+		orderRepo: orderRepo,
+		writeMode: writeMode,
+		cache:     cache,
+		notifier:  notifier,
+		logger:    logger,
+	}
+}
+
+// Ingest validates and writes the order according to the write mode, then
+// caches it. It returns a *ValidationError for invalid orders. Orders saved
+// before fail with pgdb.ErrAlreadyExists in strict mode and with
+// pgdb.ErrConflict in idempotent mode when the content differs.
+func (u *OrderUseCase) Ingest(ctx context.Context, orderRequest model.Order) (pgdb.WriteResult, error) {
+	const op = "usecase.order.go - Ingest"
+
+	if problems := orderRequest.Valid(ctx); len(problems) > 0 {
+		return pgdb.WriteResult{}, &ValidationError{Problems: problems}
+	}
+
+	order := convertOrder(orderRequest)
+	result, err := u.write(ctx, order)
+	if err != nil {
+		return pgdb.WriteResult{}, fmt.Errorf("%s - %w", op, err)
+	}
+	return result, nil
+}
+
+// IngestBatch validates the orders and saves the valid ones in one
+// transaction. The returned slice has an entry per order: nil when written,
+// a *ValidationError or the error Ingest would return otherwise. An error
+// means the batch as a whole failed and nothing was saved.
+func (u *OrderUseCase) IngestBatch(ctx context.Context, orderRequests []model.Order) ([]error, error) {
+	const op = "usecase.order.go - IngestBatch"
+
+	results := make([]error, len(orderRequests))
+	orders := make([]*entity.Order, 0, len(orderRequests))
+	positions := make([]int, 0, len(orderRequests))
+	for i, orderRequest := range orderRequests {
+		if problems := orderRequest.Valid(ctx); len(problems) > 0 {
+			results[i] = &ValidationError{Problems: problems}
+			continue
+		}
+		orders = append(orders, convertOrder(orderRequest))
+		positions = append(positions, i)
+	}
+
+	_, saveResults, err := u.saveBatch(ctx, orders)
+	if err != nil {
+		return nil, fmt.Errorf("%s - %w", op, err)
+	}
+	for i, position := range positions {
+		results[position] = saveResults[i]
+	}
+	return results, nil
+}
+
+// saveBatch saves valid orders in one transaction and handles the saved ones.
+// Outside strict mode the orders saved before are written one by one. Every
+// order gets its write result, valid where its error is nil.
+func (u *OrderUseCase) saveBatch(ctx context.Context, orders []*entity.Order) ([]pgdb.WriteResult, []error, error) {
+	if len(orders) == 0 {
+		return nil, nil, nil
+	}
+	results, err := u.orderRepo.SaveOrders(ctx, orders)
+	if err != nil {
+		return nil, nil, fmt.Errorf("orderRepo.SaveOrders: %w", err)
+	}
+	writeResults := make([]pgdb.WriteResult, len(orders))
+	for i, order := range orders {
+		switch {
+		case results[i] == nil:
+			writeResults[i].Outcome = pgdb.OutcomeInserted
+			u.saved(order)
+		case errors.Is(results[i], pgdb.ErrAlreadyExists) && u.writeMode != pgdb.WriteStrict:
+			writeResults[i], results[i] = u.write(ctx, order)
+		}
+	}
+	return writeResults, results, nil
+}
+
+// write saves the order according to the write mode and handles it when
+// it was inserted or updated.
+func (u *OrderUseCase) write(ctx context.Context, order *entity.Order) (pgdb.WriteResult, error) {
+	const op = "usecase.order.go - write"
+
+	var result pgdb.WriteResult
+	if u.writeMode == pgdb.WriteStrict {
+		if _, err := u.orderRepo.SaveOrder(ctx, order); err != nil {
+			return pgdb.WriteResult{}, fmt.Errorf("orderRepo.SaveOrder: %w", err)
+		}
+		result.Outcome = pgdb.OutcomeInserted
+	} else {
+		var err error
+		result, err = u.orderRepo.UpsertOrder(ctx, order, u.writeMode)
+		if err != nil {
+			return pgdb.WriteResult{}, fmt.Errorf("orderRepo.UpsertOrder: %w", err)
+		}
+	}
+
+	switch result.Outcome {
+	case pgdb.OutcomeInserted, pgdb.OutcomeUpdated:
+		u.saved(order)
+		u.logger.Debug("Order saved successfully", slog.Any("order_uid", order.UID), slog.Any("outcome", result.Outcome), slog.Any("changed", result.Changed), slog.Any("operation", op))
+	case pgdb.OutcomeStale:
+		u.logger.Info("Newer order already saved, keeping it", slog.Any("order_uid", order.UID), slog.Any("operation", op))
+	}
+	return result, nil
+}
+
+// saved caches a newly saved or updated order and tells the other instances about it.
+func (u *OrderUseCase) saved(order *entity.Order) {
+	const op = "usecase.order.go - saved"
+
+	if u.cache != nil {
+		u.cache.Put(order.UID, order)
+	}
+	if u.notifier != nil {
+		if err := u.notifier.Publish(order.UID, ChangeUpsert); err != nil {
+			// The order is saved, other instances catch up when their copy expires
+			u.logger.Error("Failed to publish invalidation", slog.Any("error", err.Error()), slog.Any("operation", op))
+		}
+	}
+}
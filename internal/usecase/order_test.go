@@ -0,0 +1,228 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/mock"
+	"github.com/v7ktory/wb_task_one/internal/controller/mocks"
+	"github.com/v7ktory/wb_task_one/internal/entity"
+	"github.com/v7ktory/wb_task_one/internal/model"
+	"github.com/v7ktory/wb_task_one/internal/repo/pgdb"
+)
+
+type notifierFunc func(uid, change string) error
+
+func (f notifierFunc) Publish(uid, change string) error {
+	return f(uid, change)
+}
+
+func TestIngest(t *testing.T) {
+	mockLogger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	validOrder := testOrder()
+
+	tests := []struct {
+		name      string
+		order     model.Order
+		mockSetup func(mockOrder *mocks.Order, mockCache *mocks.Cache[string, *entity.Order])
+		notified  int
+		err       error
+	}{
+		{
+			name:  "Test valid order",
+			order: validOrder,
+			mockSetup: func(mockOrder *mocks.Order, mockCache *mocks.Cache[string, *entity.Order]) {
+				mockOrder.On("SaveOrder", mock.Anything, mock.AnythingOfType("*entity.Order")).Return("b563feb7b2b84b6test", nil)
+				mockCache.On("Put", "b563feb7b2b84b6test", mock.AnythingOfType("*entity.Order")).Return()
+			},
+			notified: 1,
+		},
+		{
+			name:      "Test invalid order",
+			order:     model.Order{UID: "b563feb7b2b84b6test"},
+			mockSetup: func(mockOrder *mocks.Order, mockCache *mocks.Cache[string, *entity.Order]) {},
+			err:       &ValidationError{},
+		},
+		{
+			name:  "Test existing order",
+			order: validOrder,
+			mockSetup: func(mockOrder *mocks.Order, mockCache *mocks.Cache[string, *entity.Order]) {
+				mockOrder.On("SaveOrder", mock.Anything, mock.AnythingOfType("*entity.Order")).Return("", pgdb.ErrAlreadyExists)
+			},
+			err: pgdb.ErrAlreadyExists,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockOrder := mocks.NewOrder(t)
+			mockCache := mocks.NewCache[string, *entity.Order](t)
+			tt.mockSetup(mockOrder, mockCache)
+			notified := 0
+			u := NewOrderUseCase(mockOrder, pgdb.WriteStrict, mockCache, notifierFunc(func(uid, change string) error {
+				notified++
+				return nil
+			}), mockLogger)
+
+			_, err := u.Ingest(context.Background(), tt.order)
+			var validationErr *ValidationError
+			switch expected := tt.err.(type) {
+			case nil:
+				if err != nil {
+					t.Errorf("Expected err=%v, received=%v", nil, err)
+				}
+			case *ValidationError:
+				if !errors.As(err, &validationErr) || len(validationErr.Problems) == 0 {
+					t.Errorf("Expected err=%T, received=%v", expected, err)
+				}
+			default:
+				if !errors.Is(err, expected) {
+					t.Errorf("Expected err=%v, received=%v", expected, err)
+				}
+			}
+			if notified != tt.notified {
+				t.Errorf("Expected notified=%v, received=%v", tt.notified, notified)
+			}
+		})
+	}
+}
+
+func TestIngestWriteModes(t *testing.T) {
+	mockLogger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+
+	tests := []struct {
+		name     string
+		mode     pgdb.WriteMode
+		result   pgdb.WriteResult
+		err      error
+		cached   bool
+		expected string
+	}{
+		{
+			name:     "Test idempotent same content",
+			mode:     pgdb.WriteIdempotent,
+			result:   pgdb.WriteResult{Outcome: pgdb.OutcomeUnchanged},
+			expected: pgdb.OutcomeUnchanged,
+		},
+		{
+			name: "Test idempotent different content",
+			mode: pgdb.WriteIdempotent,
+			err:  pgdb.ErrConflict,
+		},
+		{
+			name:     "Test upsert newer version",
+			mode:     pgdb.WriteUpsertByVersion,
+			result:   pgdb.WriteResult{Outcome: pgdb.OutcomeUpdated, Changed: []string{"track_number", "version"}},
+			cached:   true,
+			expected: pgdb.OutcomeUpdated,
+		},
+		{
+			name:     "Test upsert older date",
+			mode:     pgdb.WriteUpsertByDate,
+			result:   pgdb.WriteResult{Outcome: pgdb.OutcomeStale},
+			expected: pgdb.OutcomeStale,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockOrder := mocks.NewOrder(t)
+			mockCache := mocks.NewCache[string, *entity.Order](t)
+			mockOrder.On("UpsertOrder", mock.Anything, mock.AnythingOfType("*entity.Order"), tt.mode).Return(tt.result, tt.err)
+			if tt.cached {
+				mockCache.On("Put", "b563feb7b2b84b6test", mock.AnythingOfType("*entity.Order")).Return()
+			}
+			u := NewOrderUseCase(mockOrder, tt.mode, mockCache, nil, mockLogger)
+
+			result, err := u.Ingest(context.Background(), testOrder())
+			if !errors.Is(err, tt.err) {
+				t.Errorf("Expected err=%v, received=%v", tt.err, err)
+			}
+			if result.Outcome != tt.expected {
+				t.Errorf("Expected outcome=%v, received=%v", tt.expected, result.Outcome)
+			}
+		})
+	}
+}
+
+func TestIngestNonUTCDate(t *testing.T) {
+	mockLogger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	stored := time.Date(2021, 11, 26, 6, 22, 19, 123456000, time.UTC)
+	// The resent order carries the stored date in another zone and with
+	// nanoseconds postgres doesn't keep
+	order := testOrder()
+	order.DateCreated = stored.In(time.FixedZone("MSK", 3*60*60)).Add(789 * time.Nanosecond)
+	storedDate := mock.MatchedBy(func(order *entity.Order) bool {
+		return order.DateCreated == stored
+	})
+
+	tests := []struct {
+		name     string
+		mode     pgdb.WriteMode
+		err      error
+		expected string
+	}{
+		{
+			name: "Test strict",
+			mode: pgdb.WriteStrict,
+			err:  pgdb.ErrAlreadyExists,
+		},
+		{
+			name:     "Test idempotent",
+			mode:     pgdb.WriteIdempotent,
+			expected: pgdb.OutcomeUnchanged,
+		},
+		{
+			name:     "Test upsert by date",
+			mode:     pgdb.WriteUpsertByDate,
+			expected: pgdb.OutcomeUnchanged,
+		},
+		{
+			name:     "Test upsert by version",
+			mode:     pgdb.WriteUpsertByVersion,
+			expected: pgdb.OutcomeUnchanged,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockOrder := mocks.NewOrder(t)
+			if tt.mode == pgdb.WriteStrict {
+				mockOrder.On("SaveOrder", mock.Anything, storedDate).Return("", pgdb.ErrAlreadyExists)
+			} else {
+				mockOrder.On("UpsertOrder", mock.Anything, storedDate, tt.mode).Return(pgdb.WriteResult{Outcome: pgdb.OutcomeUnchanged}, nil)
+			}
+			u := NewOrderUseCase(mockOrder, tt.mode, nil, nil, mockLogger)
+
+			result, err := u.Ingest(context.Background(), order)
+			if !errors.Is(err, tt.err) {
+				t.Errorf("Expected err=%v, received=%v", tt.err, err)
+			}
+			if result.Outcome != tt.expected {
+				t.Errorf("Expected outcome=%v, received=%v", tt.expected, result.Outcome)
+			}
+		})
+	}
+}
+
+func TestIngestBatchUpsertsExisting(t *testing.T) {
+	mockLogger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	mockOrder := mocks.NewOrder(t)
+	mockCache := mocks.NewCache[string, *entity.Order](t)
+	mockOrder.On("SaveOrders", mock.Anything, mock.AnythingOfType("[]*entity.Order")).Return([]error{pgdb.ErrAlreadyExists}, nil)
+	mockOrder.On("UpsertOrder", mock.Anything, mock.AnythingOfType("*entity.Order"), pgdb.WriteUpsertByDate).Return(pgdb.WriteResult{Outcome: pgdb.OutcomeUpdated}, nil)
+	mockCache.On("Put", "b563feb7b2b84b6test", mock.AnythingOfType("*entity.Order")).Return()
+	u := NewOrderUseCase(mockOrder, pgdb.WriteUpsertByDate, mockCache, nil, mockLogger)
+
+	results, err := u.IngestBatch(context.Background(), []model.Order{testOrder()})
+	if err != nil {
+		t.Fatalf("Expected err=%v, received=%v", nil, err)
+	}
+	if results[0] != nil {
+		t.Errorf("Expected result=%v, received=%v", nil, results[0])
+	}
+}
@@ -0,0 +1,247 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/v7ktory/wb_task_one/internal/entity"
+	"github.com/v7ktory/wb_task_one/internal/repo/cache"
+	"github.com/v7ktory/wb_task_one/internal/repo/pgdb"
+	"github.com/v7ktory/wb_task_one/pkg/postgres"
+)
+
+const (
+	DefaultRetentionInterval  = time.Hour
+	DefaultRetentionBatchSize = 1000
+	// the archive table takes 4 parameters per order
+	maxRetentionBatchSize = 10_000
+	// orders listed in a report, the count covers all of them
+	maxReportedOrders = 100
+)
+
+// Transactor runs functions in a transaction carried by their ctx.
+type Transactor interface {
+	WithTx(ctx context.Context, fn postgres.TxFunc) error
+}
+
+// RetentionPolicy decides which orders the retention job archives.
+type RetentionPolicy struct {
+	// MaxIdle archives orders not accessed for longer, zero disables the job
+	MaxIdle   time.Duration
+	Interval  time.Duration
+	BatchSize int
+	// DryRun only reports the orders which would be archived
+	DryRun bool
+}
+
+func (p RetentionPolicy) withDefaults() RetentionPolicy {
+	if p.Interval <= 0 {
+		p.Interval = DefaultRetentionInterval
+	}
+	if p.BatchSize <= 0 {
+		p.BatchSize = DefaultRetentionBatchSize
+	}
+	p.BatchSize = min(p.BatchSize, maxRetentionBatchSize)
+	return p
+}
+
+type RetentionReport struct {
+	DryRun bool      `json:"dry_run"`
+	Before time.Time `json:"idle_before"`
+	Orders int       `json:"orders"`
+	// UIDs lists the first of the orders
+	UIDs []string `json:"order_uids,omitempty"`
+}
+
+func (r *RetentionReport) add(orders []*entity.Order) {
+	r.Orders += len(orders)
+	for _, order := range orders {
+		if len(r.UIDs) == maxReportedOrders {
+			return
+		}
+		r.UIDs = append(r.UIDs, order.UID)
+	}
+}
+
+// RetentionJob moves idle orders from the orders table to the archive.
+type RetentionJob struct {
+	tx        Transactor
+	orderRepo pgdb.Order
+	archive   pgdb.Archive
+	cache     cache.Cache[string, *entity.Order]
+	notifier  Notifier
+	policy    RetentionPolicy
+	logger    *slog.Logger
+}
+
+// NewRetentionJob returns the job. The cache and notifier may be nil, as for
+// NewOrderUseCase.
+func NewRetentionJob(tx Transactor, orderRepo pgdb.Order, archive pgdb.Archive, cache cache.Cache[string, *entity.Order], notifier Notifier, policy RetentionPolicy, logger *slog.Logger) *RetentionJob {
+	return &RetentionJob{
+		tx:        tx,
+		orderRepo: orderRepo,
+		archive:   archive,
+		cache:     cache,
+		notifier:  notifier,
+		policy:    policy.withDefaults(),
+		logger:    logger,
+	}
+}
+
+// Run archives idle orders every interval until ctx is done.
+func (j *RetentionJob) Run(ctx context.Context) {
+	const op = "usecase.retention.go - Run"
+
+	if j.policy.MaxIdle <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(j.policy.Interval)
+	defer ticker.Stop()
+	for {
+		report, err := j.RunOnce(ctx)
+		if err != nil {
+			j.logger.Error("Retention run failed", slog.Any("error", err.Error()), slog.Any("archived", report.Orders), slog.Any("operation", op))
+		} else {
+			j.logger.Info("Retention run finished", slog.Any("dry_run", report.DryRun), slog.Any("orders", report.Orders), slog.Any("order_uids", report.UIDs), slog.Any("operation", op))
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// RunOnce archives the orders not accessed within MaxIdle, a batch per
+// transaction, or only reports them in dry-run mode. After an error the
+// report covers the batches archived before.
+func (j *RetentionJob) RunOnce(ctx context.Context) (RetentionReport, error) {
+	const op = "usecase.retention.go - RunOnce"
+
+	report := RetentionReport{
+		DryRun: j.policy.DryRun,
+		Before: time.Now().UTC().Add(-j.policy.MaxIdle),
+	}
+	if j.policy.MaxIdle <= 0 {
+		return report, nil
+	}
+
+	var cursor *pgdb.LRUCursor
+	for {
+		if err := ctx.Err(); err != nil {
+			return report, fmt.Errorf("%s - %w", op, err)
+		}
+
+		var (
+			batch []*entity.Order
+			next  *pgdb.LRUCursor
+			err   error
+		)
+		if j.policy.DryRun {
+			// Reporting only, so neither take nor skip row locks
+			batch, next, err = j.orderRepo.ListIdleOrders(ctx, report.Before, cursor, j.policy.BatchSize)
+		} else {
+			batch, next, err = j.archiveBatch(ctx, report.Before, cursor)
+		}
+		if err != nil {
+			return report, fmt.Errorf("%s - %w", op, err)
+		}
+
+		report.add(batch)
+		if !j.policy.DryRun {
+			j.archived(batch)
+		}
+		if next == nil {
+			return report, nil
+		}
+		cursor = next
+	}
+}
+
+// archiveBatch moves a batch of idle orders to the archive in a transaction.
+// An archive which can't join the transaction stages the orders in it and
+// publishes them once it committed, or discards them when it rolled back or
+// is retried. The table archive makes the move atomic.
+func (j *RetentionJob) archiveBatch(ctx context.Context, before time.Time, after *pgdb.LRUCursor) ([]*entity.Order, *pgdb.LRUCursor, error) {
+	const op = "usecase.retention.go - archiveBatch"
+
+	var (
+		batch  []*entity.Order
+		next   *pgdb.LRUCursor
+		staged pgdb.StagedOrders
+	)
+	discard := func() {
+		if staged == nil {
+			return
+		}
+		if err := staged.Discard(); err != nil {
+			j.logger.Error("Failed to discard staged orders", slog.Any("error", err.Error()), slog.Any("operation", op))
+		}
+		staged = nil
+	}
+
+	err := j.tx.WithTx(ctx, func(ctx context.Context, _ pgx.Tx) error {
+		// A retry selects the batch again, so it stages it again
+		discard()
+
+		var err error
+		batch, next, err = j.orderRepo.GetIdleOrders(ctx, before, after, j.policy.BatchSize)
+		if err != nil {
+			return fmt.Errorf("orderRepo.GetIdleOrders: %w", err)
+		}
+		if len(batch) == 0 {
+			return nil
+		}
+
+		if stager, ok := j.archive.(pgdb.StagedArchive); ok {
+			staged, err = stager.StageOrders(ctx, batch)
+			if err != nil {
+				return fmt.Errorf("archive.StageOrders: %w", err)
+			}
+		} else if err := j.archive.ArchiveOrders(ctx, batch); err != nil {
+			return fmt.Errorf("archive.ArchiveOrders: %w", err)
+		}
+		uids := make([]string, 0, len(batch))
+		for _, order := range batch {
+			uids = append(uids, order.UID)
+		}
+		if err := j.orderRepo.DeleteOrders(ctx, uids); err != nil {
+			return fmt.Errorf("orderRepo.DeleteOrders: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		discard()
+		return nil, nil, err
+	}
+
+	if staged != nil {
+		// The orders are deleted, the archive publishes abandoned stages later
+		if err := staged.Publish(); err != nil {
+			return nil, nil, fmt.Errorf("staged.Publish: %w", err)
+		}
+	}
+	return batch, next, nil
+}
+
+// archived evicts archived orders from the caches of all instances. Reads
+// load them from the archive again.
+func (j *RetentionJob) archived(orders []*entity.Order) {
+	const op = "usecase.retention.go - archived"
+
+	for _, order := range orders {
+		if j.cache != nil {
+			j.cache.Delete(order.UID)
+		}
+		if j.notifier != nil {
+			if err := j.notifier.Publish(order.UID, ChangeDelete); err != nil {
+				j.logger.Error("Failed to publish invalidation", slog.Any("error", err.Error()), slog.Any("operation", op))
+			}
+		}
+	}
+}
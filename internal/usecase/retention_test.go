@@ -0,0 +1,219 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/stretchr/testify/mock"
+	"github.com/v7ktory/wb_task_one/internal/controller/mocks"
+	"github.com/v7ktory/wb_task_one/internal/entity"
+	"github.com/v7ktory/wb_task_one/internal/repo/pgdb"
+	"github.com/v7ktory/wb_task_one/pkg/postgres"
+)
+
+type transactorFunc func(ctx context.Context, fn postgres.TxFunc) error
+
+func (f transactorFunc) WithTx(ctx context.Context, fn postgres.TxFunc) error {
+	return f(ctx, fn)
+}
+
+type fakeArchive struct {
+	orders []*entity.Order
+	err    error
+}
+
+func (a *fakeArchive) ArchiveOrders(ctx context.Context, orders []*entity.Order) error {
+	if a.err != nil {
+		return a.err
+	}
+	a.orders = append(a.orders, orders...)
+	return nil
+}
+
+func (a *fakeArchive) GetArchivedOrder(ctx context.Context, uid string) (*entity.Order, error) {
+	return nil, pgdb.ErrNotFound
+}
+
+func TestRetentionJob(t *testing.T) {
+	mockLogger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	first := []*entity.Order{{UID: "a"}, {UID: "b"}}
+	second := []*entity.Order{{UID: "c"}}
+	cursor := &pgdb.LRUCursor{UID: "b"}
+
+	tests := []struct {
+		name       string
+		dryRun     bool
+		archiveErr error
+		mockSetup  func(mockOrder *mocks.Order, mockCache *mocks.Cache[string, *entity.Order])
+		archived   int
+		txs        int
+		report     int
+		err        error
+	}{
+		{
+			name:   "Test dry run",
+			dryRun: true,
+			mockSetup: func(mockOrder *mocks.Order, mockCache *mocks.Cache[string, *entity.Order]) {
+				mockOrder.On("ListIdleOrders", mock.Anything, mock.Anything, (*pgdb.LRUCursor)(nil), 2).Return(first, cursor, nil)
+				mockOrder.On("ListIdleOrders", mock.Anything, mock.Anything, cursor, 2).Return(second, nil, nil)
+			},
+			report: 3,
+		},
+		{
+			name: "Test archive",
+			mockSetup: func(mockOrder *mocks.Order, mockCache *mocks.Cache[string, *entity.Order]) {
+				mockOrder.On("GetIdleOrders", mock.Anything, mock.Anything, (*pgdb.LRUCursor)(nil), 2).Return(first, cursor, nil)
+				mockOrder.On("GetIdleOrders", mock.Anything, mock.Anything, cursor, 2).Return(second, nil, nil)
+				mockOrder.On("DeleteOrders", mock.Anything, []string{"a", "b"}).Return(nil)
+				mockOrder.On("DeleteOrders", mock.Anything, []string{"c"}).Return(nil)
+				for _, uid := range []string{"a", "b", "c"} {
+					mockCache.On("Delete", uid).Return(false)
+				}
+			},
+			archived: 3,
+			txs:      2,
+			report:   3,
+		},
+		{
+			name:       "Test archive failure keeps orders",
+			archiveErr: errors.New("disk full"),
+			mockSetup: func(mockOrder *mocks.Order, mockCache *mocks.Cache[string, *entity.Order]) {
+				mockOrder.On("GetIdleOrders", mock.Anything, mock.Anything, (*pgdb.LRUCursor)(nil), 2).Return(first, cursor, nil)
+			},
+			txs: 1,
+			err: errors.New("disk full"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockOrder := mocks.NewOrder(t)
+			mockCache := mocks.NewCache[string, *entity.Order](t)
+			tt.mockSetup(mockOrder, mockCache)
+			archive := &fakeArchive{err: tt.archiveErr}
+			txs := 0
+			tx := transactorFunc(func(ctx context.Context, fn postgres.TxFunc) error {
+				txs++
+				return fn(ctx, pgx.Tx(nil))
+			})
+			job := NewRetentionJob(tx, mockOrder, archive, mockCache, nil, RetentionPolicy{MaxIdle: 24 * time.Hour, BatchSize: 2, DryRun: tt.dryRun}, mockLogger)
+
+			report, err := job.RunOnce(context.Background())
+			if (err != nil) != (tt.err != nil) {
+				t.Errorf("Expected err=%v, received=%v", tt.err, err)
+			}
+			if report.Orders != tt.report {
+				t.Errorf("Expected report orders=%v, received=%v", tt.report, report.Orders)
+			}
+			if report.DryRun != tt.dryRun {
+				t.Errorf("Expected dry run=%v, received=%v", tt.dryRun, report.DryRun)
+			}
+			if len(archive.orders) != tt.archived {
+				t.Errorf("Expected archived=%v, received=%v", tt.archived, len(archive.orders))
+			}
+			if txs != tt.txs {
+				t.Errorf("Expected transactions=%v, received=%v", tt.txs, txs)
+			}
+		})
+	}
+}
+
+type fakeStaged struct {
+	published, discarded bool
+}
+
+func (s *fakeStaged) Publish() error {
+	s.published = true
+	return nil
+}
+
+func (s *fakeStaged) Discard() error {
+	s.discarded = true
+	return nil
+}
+
+// fakeStagedArchive records the stages of ArchiveOrders.
+type fakeStagedArchive struct {
+	fakeArchive
+	staged []*fakeStaged
+}
+
+func (a *fakeStagedArchive) StageOrders(ctx context.Context, orders []*entity.Order) (pgdb.StagedOrders, error) {
+	staged := &fakeStaged{}
+	a.staged = append(a.staged, staged)
+	return staged, nil
+}
+
+func TestRetentionJobStagesOrders(t *testing.T) {
+	mockLogger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	batch := []*entity.Order{{UID: "a"}}
+
+	tests := []struct {
+		name      string
+		attempts  int
+		commitErr error
+		mockSetup func(mockOrder *mocks.Order, mockCache *mocks.Cache[string, *entity.Order])
+		published []bool
+	}{
+		{
+			name:     "Test retried transaction discards the first stage",
+			attempts: 2,
+			mockSetup: func(mockOrder *mocks.Order, mockCache *mocks.Cache[string, *entity.Order]) {
+				mockOrder.On("GetIdleOrders", mock.Anything, mock.Anything, (*pgdb.LRUCursor)(nil), 2).Return(batch, nil, nil).Twice()
+				mockOrder.On("DeleteOrders", mock.Anything, []string{"a"}).Return(nil).Twice()
+				mockCache.On("Delete", "a").Return(false).Once()
+			},
+			published: []bool{false, true},
+		},
+		{
+			name:      "Test failed commit discards the stage",
+			attempts:  1,
+			commitErr: errors.New("connection reset"),
+			mockSetup: func(mockOrder *mocks.Order, mockCache *mocks.Cache[string, *entity.Order]) {
+				mockOrder.On("GetIdleOrders", mock.Anything, mock.Anything, (*pgdb.LRUCursor)(nil), 2).Return(batch, nil, nil).Once()
+				mockOrder.On("DeleteOrders", mock.Anything, []string{"a"}).Return(nil).Once()
+			},
+			published: []bool{false},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockOrder := mocks.NewOrder(t)
+			mockCache := mocks.NewCache[string, *entity.Order](t)
+			tt.mockSetup(mockOrder, mockCache)
+			archive := &fakeStagedArchive{}
+			// Every attempt but the last fails to commit and is retried
+			tx := transactorFunc(func(ctx context.Context, fn postgres.TxFunc) error {
+				for i := 0; i < tt.attempts; i++ {
+					if err := fn(ctx, pgx.Tx(nil)); err != nil {
+						return err
+					}
+				}
+				return tt.commitErr
+			})
+			job := NewRetentionJob(tx, mockOrder, archive, mockCache, nil, RetentionPolicy{MaxIdle: time.Hour, BatchSize: 2}, mockLogger)
+
+			_, err := job.RunOnce(context.Background())
+			if (err != nil) != (tt.commitErr != nil) {
+				t.Errorf("Expected err=%v, received=%v", tt.commitErr, err)
+			}
+			if len(archive.orders) != 0 {
+				t.Errorf("Expected archived=%v, received=%v", 0, len(archive.orders))
+			}
+			if len(archive.staged) != len(tt.published) {
+				t.Fatalf("Expected stages=%v, received=%v", len(tt.published), len(archive.staged))
+			}
+			for i, staged := range archive.staged {
+				if staged.published != tt.published[i] || staged.discarded == tt.published[i] {
+					t.Errorf("Expected stage %d published=%v, received published=%v discarded=%v", i, tt.published[i], staged.published, staged.discarded)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,9 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE INDEX "orders_created_at_order_uid_idx" ON "orders" ("created_at" DESC, "order_uid" DESC);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX "orders_created_at_order_uid_idx";
+-- +goose StatementEnd
@@ -0,0 +1,21 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Keyset pagination of the order listing, also serves date_created ranges
+CREATE INDEX "orders_date_created_order_uid_idx" ON "orders" ("date_created", "order_uid");
+CREATE INDEX "orders_customer_id_date_created_idx" ON "orders" ("customer_id", "date_created", "order_uid");
+CREATE INDEX "orders_track_number_idx" ON "orders" ("track_number");
+CREATE INDEX "orders_payment_currency_idx" ON "orders" ((payment->>'Currency'));
+CREATE INDEX "orders_payment_provider_idx" ON "orders" ((payment->>'Provider'));
+-- Containment lookups of item brand and nm_id
+CREATE INDEX "orders_items_idx" ON "orders" USING gin ("items" jsonb_path_ops);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX "orders_items_idx";
+DROP INDEX "orders_payment_provider_idx";
+DROP INDEX "orders_payment_currency_idx";
+DROP INDEX "orders_track_number_idx";
+DROP INDEX "orders_customer_id_date_created_idx";
+DROP INDEX "orders_date_created_order_uid_idx";
+-- +goose StatementEnd
@@ -0,0 +1,21 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE "orders" ADD COLUMN "version" bigint NOT NULL DEFAULT 0;
+
+-- One row per insert or update of an order applied by an upsert
+CREATE TABLE "order_changes" (
+  "id" bigserial PRIMARY KEY,
+  "order_uid" varchar(255) NOT NULL,
+  "change" varchar(16) NOT NULL,
+  "fields" text[] NOT NULL,
+  "previous" jsonb,
+  "changed_at" timestamp NOT NULL DEFAULT (now() AT TIME ZONE 'utc')
+);
+CREATE INDEX "order_changes_order_uid_idx" ON "order_changes" ("order_uid", "changed_at");
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE "order_changes";
+ALTER TABLE "orders" DROP COLUMN "version";
+-- +goose StatementEnd
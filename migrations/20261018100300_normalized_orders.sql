@@ -0,0 +1,111 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE "deliveries" (
+  "order_uid" varchar(255) PRIMARY KEY REFERENCES "orders" ("order_uid") ON DELETE CASCADE,
+  "name" varchar(255) NOT NULL,
+  "phone" varchar(255) NOT NULL,
+  "zip" varchar(255) NOT NULL,
+  "city" varchar(255) NOT NULL,
+  "address" varchar(255) NOT NULL,
+  "region" varchar(255) NOT NULL,
+  "email" varchar(255) NOT NULL
+);
+
+CREATE TABLE "payments" (
+  "order_uid" varchar(255) PRIMARY KEY REFERENCES "orders" ("order_uid") ON DELETE CASCADE,
+  "transaction" varchar(255) NOT NULL,
+  "request_id" varchar(255) NOT NULL,
+  "currency" varchar(255) NOT NULL,
+  "provider" varchar(255) NOT NULL,
+  "amount" int NOT NULL,
+  "payment_dt" bigint NOT NULL,
+  "bank" varchar(255) NOT NULL,
+  "delivery_cost" int NOT NULL,
+  "goods_total" int NOT NULL,
+  "custom_fee" int NOT NULL
+);
+CREATE INDEX "payments_transaction_idx" ON "payments" ("transaction");
+CREATE INDEX "payments_currency_idx" ON "payments" ("currency");
+CREATE INDEX "payments_provider_idx" ON "payments" ("provider");
+
+-- position keeps the items in the order they were received
+CREATE TABLE "order_items" (
+  "order_uid" varchar(255) NOT NULL REFERENCES "orders" ("order_uid") ON DELETE CASCADE,
+  "position" int NOT NULL,
+  "chrt_id" bigint NOT NULL,
+  "track_number" varchar(255) NOT NULL,
+  "price" int NOT NULL,
+  "rid" varchar(255) NOT NULL,
+  "name" varchar(255) NOT NULL,
+  "sale" int NOT NULL,
+  "size" varchar(255) NOT NULL,
+  "total_price" int NOT NULL,
+  "nm_id" bigint NOT NULL,
+  "brand" varchar(255) NOT NULL,
+  "status" int NOT NULL,
+  PRIMARY KEY ("order_uid", "position")
+);
+CREATE INDEX "order_items_chrt_id_idx" ON "order_items" ("chrt_id");
+CREATE INDEX "order_items_nm_id_idx" ON "order_items" ("nm_id");
+CREATE INDEX "order_items_brand_idx" ON "order_items" ("brand");
+
+-- The jsonb keys are the entity field names
+INSERT INTO "deliveries"
+SELECT "order_uid",
+  "delivery"->>'Name', "delivery"->>'Phone', "delivery"->>'Zip', "delivery"->>'City',
+  "delivery"->>'Address', "delivery"->>'Region', "delivery"->>'Email'
+FROM "orders";
+
+INSERT INTO "payments"
+SELECT "order_uid",
+  "payment"->>'Transaction', "payment"->>'RequestID', "payment"->>'Currency', "payment"->>'Provider',
+  ("payment"->>'Amount')::int, ("payment"->>'PaymentDt')::bigint, "payment"->>'Bank',
+  ("payment"->>'DeliveryCost')::int, ("payment"->>'GoodsTotal')::int, ("payment"->>'CustomFee')::int
+FROM "orders";
+
+INSERT INTO "order_items"
+SELECT o."order_uid", i."position" - 1,
+  (i."item"->>'ChrtID')::bigint, i."item"->>'TrackNumber', (i."item"->>'Price')::int, i."item"->>'Rid',
+  i."item"->>'Name', (i."item"->>'Sale')::int, i."item"->>'Size', (i."item"->>'TotalPrice')::int,
+  (i."item"->>'NmID')::bigint, i."item"->>'Brand', (i."item"->>'Status')::int
+FROM "orders" o, jsonb_array_elements(o."items") WITH ORDINALITY AS i("item", "position");
+
+-- Drops the jsonb indexes along with the columns
+ALTER TABLE "orders" DROP COLUMN "delivery", DROP COLUMN "payment", DROP COLUMN "items";
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE "orders" ADD COLUMN "delivery" jsonb, ADD COLUMN "payment" jsonb, ADD COLUMN "items" jsonb;
+
+UPDATE "orders" o SET "delivery" = jsonb_build_object(
+  'Name', d."name", 'Phone', d."phone", 'Zip', d."zip", 'City', d."city",
+  'Address', d."address", 'Region', d."region", 'Email', d."email")
+FROM "deliveries" d WHERE d."order_uid" = o."order_uid";
+
+UPDATE "orders" o SET "payment" = jsonb_build_object(
+  'Transaction', p."transaction", 'RequestID', p."request_id", 'Currency', p."currency", 'Provider', p."provider",
+  'Amount', p."amount", 'PaymentDt', p."payment_dt", 'Bank', p."bank",
+  'DeliveryCost', p."delivery_cost", 'GoodsTotal', p."goods_total", 'CustomFee', p."custom_fee")
+FROM "payments" p WHERE p."order_uid" = o."order_uid";
+
+UPDATE "orders" o SET "items" = COALESCE((
+  SELECT jsonb_agg(jsonb_build_object(
+    'ChrtID', i."chrt_id", 'TrackNumber', i."track_number", 'Price', i."price", 'Rid', i."rid",
+    'Name', i."name", 'Sale', i."sale", 'Size', i."size", 'TotalPrice', i."total_price",
+    'NmID', i."nm_id", 'Brand', i."brand", 'Status', i."status") ORDER BY i."position")
+  FROM "order_items" i WHERE i."order_uid" = o."order_uid"), '[]'::jsonb);
+
+ALTER TABLE "orders"
+  ALTER COLUMN "delivery" SET NOT NULL,
+  ALTER COLUMN "payment" SET NOT NULL,
+  ALTER COLUMN "items" SET NOT NULL;
+
+CREATE INDEX "orders_payment_currency_idx" ON "orders" ((payment->>'Currency'));
+CREATE INDEX "orders_payment_provider_idx" ON "orders" ((payment->>'Provider'));
+CREATE INDEX "orders_items_idx" ON "orders" USING gin ("items" jsonb_path_ops);
+
+DROP TABLE "order_items";
+DROP TABLE "payments";
+DROP TABLE "deliveries";
+-- +goose StatementEnd
@@ -0,0 +1,16 @@
+-- +goose Up
+-- +goose StatementBegin
+-- created_at used to be overwritten on every read, so it holds the last access
+ALTER TABLE "orders" ADD COLUMN "last_accessed_at" timestamp NOT NULL DEFAULT (now() AT TIME ZONE 'utc');
+UPDATE "orders" SET "last_accessed_at" = "created_at";
+CREATE INDEX "orders_last_accessed_at_order_uid_idx" ON "orders" ("last_accessed_at" DESC, "order_uid" DESC);
+DROP INDEX "orders_created_at_order_uid_idx";
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+UPDATE "orders" SET "created_at" = "last_accessed_at";
+CREATE INDEX "orders_created_at_order_uid_idx" ON "orders" ("created_at" DESC, "order_uid" DESC);
+DROP INDEX "orders_last_accessed_at_order_uid_idx";
+ALTER TABLE "orders" DROP COLUMN "last_accessed_at";
+-- +goose StatementEnd
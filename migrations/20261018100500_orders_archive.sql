@@ -0,0 +1,18 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Orders moved out of the orders table by the retention job, data is the
+-- whole order with the entity field names as keys
+CREATE TABLE "orders_archive" (
+  "order_uid" varchar(255) PRIMARY KEY,
+  "data" jsonb NOT NULL,
+  "customer_id" varchar(255) NOT NULL,
+  "date_created" timestamp NOT NULL,
+  "archived_at" timestamp NOT NULL DEFAULT (now() AT TIME ZONE 'utc')
+);
+CREATE INDEX "orders_archive_archived_at_idx" ON "orders_archive" ("archived_at");
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE "orders_archive";
+-- +goose StatementEnd
@@ -0,0 +1,433 @@
+package postgres
+
+import (
+	"bufio"
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// versionTable is the table goose keeps the applied migrations in, so the
+// goose binary and the Migrator can be used on the same database.
+const versionTable = "goose_db_version"
+
+// migrationLockKey is the advisory lock goose takes for its session locker.
+const migrationLockKey int64 = 5887940537704921958
+
+var (
+	// ErrSchemaAhead is returned when the database has migrations applied
+	// which are newer than the ones the binary knows about.
+	ErrSchemaAhead = errors.New("database schema is ahead of the binary")
+	ErrNoMigration = errors.New("no migration to roll back")
+)
+
+// Migration is a goose SQL migration: a <version>_<name>.sql file with the
+// statements after the "-- +goose Up" and "-- +goose Down" annotations.
+// A statement ends with a line ending in a semicolon, or spans the lines
+// between "-- +goose StatementBegin" and "-- +goose StatementEnd".
+type Migration struct {
+	Version int64
+	Name    string
+	Up      []string
+	Down    []string
+	// NoTx is set by "-- +goose NO TRANSACTION", e.g. for CREATE INDEX CONCURRENTLY
+	NoTx bool
+}
+
+type MigrationStatus struct {
+	Migration
+	Applied   bool
+	AppliedAt time.Time
+}
+
+// LoadMigrations reads the .sql migrations in the root of fsys ordered by
+// version.
+func LoadMigrations(fsys fs.FS) ([]Migration, error) {
+	const op = "postgres.migrate.go - LoadMigrations"
+
+	paths, err := fs.Glob(fsys, "*.sql")
+	if err != nil {
+		return nil, fmt.Errorf("%s - fs.Glob: %w", op, err)
+	}
+
+	migrations := make([]Migration, 0, len(paths))
+	seen := make(map[int64]string, len(paths))
+	for _, p := range paths {
+		data, err := fs.ReadFile(fsys, p)
+		if err != nil {
+			return nil, fmt.Errorf("%s - fs.ReadFile: %w", op, err)
+		}
+		m, err := parseMigration(path.Base(p), string(data))
+		if err != nil {
+			return nil, fmt.Errorf("%s - %s: %w", op, p, err)
+		}
+		if other, found := seen[m.Version]; found {
+			return nil, fmt.Errorf("%s - %s and %s have the same version", op, other, p)
+		}
+		seen[m.Version] = p
+		migrations = append(migrations, m)
+	}
+
+	slices.SortFunc(migrations, func(a, b Migration) int {
+		return cmp.Compare(a.Version, b.Version)
+	})
+	return migrations, nil
+}
+
+func parseMigration(name, data string) (Migration, error) {
+	version, rest, found := strings.Cut(strings.TrimSuffix(name, ".sql"), "_")
+	if !found {
+		return Migration{}, errors.New("name is not <version>_<name>.sql")
+	}
+	m := Migration{Name: rest}
+	var err error
+	m.Version, err = strconv.ParseInt(version, 10, 64)
+	if err != nil || m.Version <= 0 {
+		return Migration{}, fmt.Errorf("invalid version %q", version)
+	}
+
+	var up, down []string
+	var section *[]string
+	var statement strings.Builder
+	inBlock := false
+	// end adds the statement read so far to the section
+	end := func() {
+		if text := strings.TrimSpace(statement.String()); text != "" && section != nil {
+			*section = append(*section, text)
+		}
+		statement.Reset()
+	}
+	// unterminated reports whether more than comments follow the last statement
+	unterminated := func() bool {
+		for _, line := range strings.Split(statement.String(), "\n") {
+			if line = strings.TrimSpace(line); line != "" && !strings.HasPrefix(line, "--") {
+				return true
+			}
+		}
+		return false
+	}
+
+	scanner := bufio.NewScanner(strings.NewReader(data))
+	for scanner.Scan() {
+		line := scanner.Text()
+		annotation, isAnnotation := strings.CutPrefix(strings.TrimSpace(line), "-- +goose ")
+		if !isAnnotation {
+			if section == nil {
+				continue
+			}
+			statement.WriteString(line)
+			statement.WriteByte('\n')
+			if !inBlock && endsStatement(line) {
+				end()
+			}
+			continue
+		}
+
+		switch annotation = strings.TrimSpace(annotation); annotation {
+		case "Up", "Down":
+			if inBlock || unterminated() {
+				return Migration{}, errors.New("statement not terminated before the next section")
+			}
+			statement.Reset()
+			section = &up
+			if annotation == "Down" {
+				section = &down
+			}
+		case "StatementBegin":
+			if unterminated() {
+				return Migration{}, errors.New("statement not terminated before StatementBegin")
+			}
+			statement.Reset()
+			inBlock = true
+		case "StatementEnd":
+			if !inBlock {
+				return Migration{}, errors.New("StatementEnd without StatementBegin")
+			}
+			end()
+			inBlock = false
+		case "NO TRANSACTION":
+			m.NoTx = true
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return Migration{}, err
+	}
+	if inBlock || unterminated() {
+		return Migration{}, errors.New("statement not terminated at the end of the file")
+	}
+	if len(up) == 0 {
+		return Migration{}, errors.New("no -- +goose Up statements")
+	}
+
+	m.Up, m.Down = up, down
+	return m, nil
+}
+
+// endsStatement reports whether the line ends with a semicolon, ignoring a
+// trailing comment.
+func endsStatement(line string) bool {
+	code, _, _ := strings.Cut(line, "--")
+	return strings.HasSuffix(strings.TrimSpace(code), ";")
+}
+
+// Migrator applies migrations holding an advisory lock, so instances
+// starting together apply each migration once.
+type Migrator struct {
+	pg         *Postgres
+	migrations []Migration
+}
+
+func NewMigrator(pg *Postgres, migrations []Migration) *Migrator {
+	return &Migrator{
+		pg:         pg,
+		migrations: migrations,
+	}
+}
+
+// Up applies the migrations which haven't been applied yet, older ones
+// missing in between included, and returns them. It refuses to touch a
+// database which is ahead of the binary.
+func (m *Migrator) Up(ctx context.Context) ([]Migration, error) {
+	const op = "postgres.migrate.go - Up"
+
+	var applied []Migration
+	err := m.locked(ctx, func(conn *pgxpool.Conn) error {
+		versions, err := appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+		if err := m.checkAhead(versions); err != nil {
+			return err
+		}
+
+		for _, migration := range m.migrations {
+			if _, found := versions[migration.Version]; found {
+				continue
+			}
+			if err := apply(ctx, conn, migration, migration.Up, true); err != nil {
+				return err
+			}
+			applied = append(applied, migration)
+		}
+		return nil
+	})
+	if err != nil {
+		return applied, fmt.Errorf("%s - %w", op, err)
+	}
+	return applied, nil
+}
+
+// Down rolls back the most recently applied migration and returns it.
+func (m *Migrator) Down(ctx context.Context) (Migration, error) {
+	const op = "postgres.migrate.go - Down"
+
+	var rolledBack Migration
+	err := m.locked(ctx, func(conn *pgxpool.Conn) error {
+		versions, err := appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+		if err := m.checkAhead(versions); err != nil {
+			return err
+		}
+
+		for _, migration := range slices.Backward(m.migrations) {
+			if _, found := versions[migration.Version]; found {
+				rolledBack = migration
+				return apply(ctx, conn, migration, migration.Down, false)
+			}
+		}
+		return ErrNoMigration
+	})
+	if err != nil {
+		return Migration{}, fmt.Errorf("%s - %w", op, err)
+	}
+	return rolledBack, nil
+}
+
+// Status reports for every migration whether it has been applied.
+func (m *Migrator) Status(ctx context.Context) ([]MigrationStatus, error) {
+	const op = "postgres.migrate.go - Status"
+
+	var statuses []MigrationStatus
+	err := m.locked(ctx, func(conn *pgxpool.Conn) error {
+		versions, err := appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+		for _, migration := range m.migrations {
+			appliedAt, applied := versions[migration.Version]
+			statuses = append(statuses, MigrationStatus{Migration: migration, Applied: applied, AppliedAt: appliedAt})
+		}
+		return m.checkAhead(versions)
+	})
+	if err != nil {
+		return statuses, fmt.Errorf("%s - %w", op, err)
+	}
+	return statuses, nil
+}
+
+// checkAhead fails if a migration newer than the newest known one has been
+// applied, i.e. a newer binary migrated the database.
+func (m *Migrator) checkAhead(versions map[int64]time.Time) error {
+	var latest int64
+	if len(m.migrations) > 0 {
+		latest = m.migrations[len(m.migrations)-1].Version
+	}
+	for version := range versions {
+		if version > latest {
+			return fmt.Errorf("%w: version %d applied, binary knows up to %d", ErrSchemaAhead, version, latest)
+		}
+	}
+	return nil
+}
+
+// locked runs fn on a connection holding the migration lock. The lock is
+// taken for the session, so it is released with the connection even if the
+// unlock fails.
+func (m *Migrator) locked(ctx context.Context, fn func(conn *pgxpool.Conn) error) error {
+	conn, err := m.pg.Pool.Acquire(ctx)
+	if err != nil {
+		return fmt.Errorf("Pool.Acquire: %w", err)
+	}
+	defer conn.Release()
+
+	if _, err := conn.Exec(ctx, "SELECT pg_advisory_lock($1)", migrationLockKey); err != nil {
+		return fmt.Errorf("lock: %w", err)
+	}
+	defer func() {
+		_, err := conn.Exec(context.WithoutCancel(ctx), "SELECT pg_advisory_unlock($1)", migrationLockKey)
+		if err != nil {
+			// Drop the connection, which ends the session and its lock
+			conn.Hijack().Close(context.Background())
+		}
+	}()
+
+	if err := ensureVersionTable(ctx, conn); err != nil {
+		return err
+	}
+	return fn(conn)
+}
+
+// ensureVersionTable creates the version table the way goose does.
+func ensureVersionTable(ctx context.Context, conn *pgxpool.Conn) error {
+	var exists bool
+	err := conn.QueryRow(ctx, "SELECT to_regclass($1) IS NOT NULL", versionTable).Scan(&exists)
+	if err != nil {
+		return fmt.Errorf("check version table: %w", err)
+	}
+	if exists {
+		return nil
+	}
+
+	_, err = conn.Exec(ctx, `CREATE TABLE `+versionTable+` (
+		id serial PRIMARY KEY,
+		version_id bigint NOT NULL,
+		is_applied boolean NOT NULL,
+		tstamp timestamp NULL DEFAULT now()
+	);
+	INSERT INTO `+versionTable+` (version_id, is_applied) VALUES (0, true);`)
+	if err != nil {
+		return fmt.Errorf("create version table: %w", err)
+	}
+	return nil
+}
+
+// appliedVersions returns the applied migrations with the time they were
+// applied. The latest row of a version decides, as rows of rolled back
+// migrations are kept by older goose releases.
+func appliedVersions(ctx context.Context, conn *pgxpool.Conn) (map[int64]time.Time, error) {
+	rows, err := conn.Query(ctx, "SELECT version_id, is_applied, tstamp FROM "+versionTable+" WHERE version_id > 0 ORDER BY id DESC")
+	if err != nil {
+		return nil, fmt.Errorf("read versions: %w", err)
+	}
+	defer rows.Close()
+
+	seen := make(map[int64]bool)
+	versions := make(map[int64]time.Time)
+	for rows.Next() {
+		var version int64
+		var isApplied bool
+		var tstamp *time.Time
+		if err := rows.Scan(&version, &isApplied, &tstamp); err != nil {
+			return nil, fmt.Errorf("scan version: %w", err)
+		}
+		if seen[version] {
+			continue
+		}
+		seen[version] = true
+		if isApplied {
+			var appliedAt time.Time
+			if tstamp != nil {
+				appliedAt = *tstamp
+			}
+			versions[version] = appliedAt
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("read versions: %w", err)
+	}
+	return versions, nil
+}
+
+// migrationConn is the connection a migration is applied on.
+type migrationConn interface {
+	Querier
+	Begin(ctx context.Context) (pgx.Tx, error)
+}
+
+// apply runs the statements of one direction of the migration and records
+// the result, in one transaction unless the migration opts out.
+func apply(ctx context.Context, conn migrationConn, migration Migration, statements []string, up bool) error {
+	record := func(ctx context.Context, q Querier) error {
+		var err error
+		if up {
+			_, err = q.Exec(ctx, "INSERT INTO "+versionTable+" (version_id, is_applied) VALUES ($1, true)", migration.Version)
+		} else {
+			_, err = q.Exec(ctx, "DELETE FROM "+versionTable+" WHERE version_id = $1", migration.Version)
+		}
+		return err
+	}
+
+	if migration.NoTx {
+		if err := execStatements(ctx, conn, statements); err != nil {
+			return fmt.Errorf("migration %d: %w", migration.Version, err)
+		}
+		if err := record(ctx, conn); err != nil {
+			return fmt.Errorf("record migration %d: %w", migration.Version, err)
+		}
+		return nil
+	}
+
+	return pgx.BeginFunc(ctx, conn, func(tx pgx.Tx) error {
+		if err := execStatements(ctx, tx, statements); err != nil {
+			return fmt.Errorf("migration %d: %w", migration.Version, err)
+		}
+		if err := record(ctx, tx); err != nil {
+			return fmt.Errorf("record migration %d: %w", migration.Version, err)
+		}
+		return nil
+	})
+}
+
+// execStatements runs the statements one at a time. Without arguments Exec
+// sends each as a simple query, so a StatementBegin block may still hold
+// several statements, which postgres then runs in an implicit transaction.
+func execStatements(ctx context.Context, q Querier, statements []string) error {
+	for _, statement := range statements {
+		if _, err := q.Exec(ctx, statement); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,150 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/v7ktory/wb_task_one/migrations"
+)
+
+func TestLoadMigrations(t *testing.T) {
+	fsys := fstest.MapFS{
+		"2_index.sql": {Data: []byte("-- +goose NO TRANSACTION\n-- +goose Up\nCREATE INDEX CONCURRENTLY i ON t (c);\n-- +goose Down\nDROP INDEX i;\n")},
+		"1_table.sql": {Data: []byte("-- +goose Up\n-- +goose StatementBegin\nCREATE TABLE t (c int);\n-- +goose StatementEnd\n\n-- +goose Down\nDROP TABLE t;\n")},
+		"README.md":   {Data: []byte("not a migration")},
+	}
+
+	list, err := LoadMigrations(fsys)
+	if err != nil {
+		t.Fatalf("Expected err=%v, received=%v", nil, err)
+	}
+	if len(list) != 2 {
+		t.Fatalf("Expected migrations=%v, received=%v", 2, len(list))
+	}
+	if list[0].Version != 1 || list[0].Name != "table" || list[0].NoTx {
+		t.Errorf("Expected migration=%v, received=%+v", "1 table", list[0])
+	}
+	if !slices.Equal(list[0].Up, []string{"CREATE TABLE t (c int);"}) {
+		t.Errorf("Expected up=%q, received=%q", "CREATE TABLE t (c int);", list[0].Up)
+	}
+	if !slices.Equal(list[0].Down, []string{"DROP TABLE t;"}) {
+		t.Errorf("Expected down=%q, received=%q", "DROP TABLE t;", list[0].Down)
+	}
+	if !list[1].NoTx {
+		t.Errorf("Expected noTx=%v, received=%v", true, list[1].NoTx)
+	}
+
+	tests := []struct {
+		name string
+		fsys fstest.MapFS
+	}{
+		{name: "Test missing version", fsys: fstest.MapFS{"table.sql": {Data: []byte("-- +goose Up\nSELECT 1;\n")}}},
+		{name: "Test missing up", fsys: fstest.MapFS{"1_table.sql": {Data: []byte("-- +goose Down\nSELECT 1;\n")}}},
+		{name: "Test unterminated statement", fsys: fstest.MapFS{"1_table.sql": {Data: []byte("-- +goose Up\nSELECT 1\n-- +goose Down\nSELECT 1;\n")}}},
+		{name: "Test unterminated block", fsys: fstest.MapFS{"1_table.sql": {Data: []byte("-- +goose Up\n-- +goose StatementBegin\nSELECT 1;\n")}}},
+		{name: "Test repeated version", fsys: fstest.MapFS{
+			"1_a.sql": {Data: []byte("-- +goose Up\nSELECT 1;\n")},
+			"1_b.sql": {Data: []byte("-- +goose Up\nSELECT 1;\n")},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := LoadMigrations(tt.fsys); err == nil {
+				t.Errorf("Expected an error, received=%v", err)
+			}
+		})
+	}
+}
+
+func TestEmbeddedMigrations(t *testing.T) {
+	list, err := LoadMigrations(migrations.FS)
+	if err != nil {
+		t.Fatalf("Expected err=%v, received=%v", nil, err)
+	}
+	for _, m := range list {
+		if len(m.Down) == 0 {
+			t.Errorf("Expected migration %d to have down statements", m.Version)
+		}
+	}
+}
+
+func TestCheckAhead(t *testing.T) {
+	m := NewMigrator(nil, []Migration{{Version: 1}, {Version: 2}})
+
+	if err := m.checkAhead(map[int64]time.Time{1: {}, 2: {}}); err != nil {
+		t.Errorf("Expected err=%v, received=%v", nil, err)
+	}
+	if err := m.checkAhead(map[int64]time.Time{1: {}, 3: {}}); !errors.Is(err, ErrSchemaAhead) {
+		t.Errorf("Expected err=%v, received=%v", ErrSchemaAhead, err)
+	}
+}
+
+// fakeConn records the statements executed outside a transaction.
+type fakeConn struct {
+	Querier
+	executed []string
+}
+
+func (c *fakeConn) Exec(ctx context.Context, sql string, arguments ...any) (pgconn.CommandTag, error) {
+	c.executed = append(c.executed, sql)
+	return pgconn.CommandTag{}, nil
+}
+
+func (c *fakeConn) Begin(ctx context.Context) (pgx.Tx, error) {
+	return nil, errors.New("unexpected transaction")
+}
+
+func TestApplyNoTransaction(t *testing.T) {
+	data := `-- +goose NO TRANSACTION
+-- +goose Up
+-- indexes are built without blocking writes
+CREATE INDEX CONCURRENTLY i ON t (c);
+CREATE INDEX CONCURRENTLY j ON t (d); -- second index
+-- +goose StatementBegin
+CREATE FUNCTION f() RETURNS int AS $$
+BEGIN
+	RETURN 1;
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+-- +goose Down
+DROP INDEX CONCURRENTLY j;
+DROP INDEX CONCURRENTLY i;
+`
+	m, err := parseMigration("3_concurrent.sql", data)
+	if err != nil {
+		t.Fatalf("Expected err=%v, received=%v", nil, err)
+	}
+	if !m.NoTx {
+		t.Errorf("Expected noTx=%v, received=%v", true, m.NoTx)
+	}
+	function := "CREATE FUNCTION f() RETURNS int AS $$\nBEGIN\n\tRETURN 1;\nEND;\n$$ LANGUAGE plpgsql;"
+	up := []string{
+		"-- indexes are built without blocking writes\nCREATE INDEX CONCURRENTLY i ON t (c);",
+		"CREATE INDEX CONCURRENTLY j ON t (d); -- second index",
+		function,
+	}
+	if !slices.Equal(m.Up, up) {
+		t.Errorf("Expected up=%q, received=%q", up, m.Up)
+	}
+	down := []string{"DROP INDEX CONCURRENTLY j;", "DROP INDEX CONCURRENTLY i;"}
+	if !slices.Equal(m.Down, down) {
+		t.Errorf("Expected down=%q, received=%q", down, m.Down)
+	}
+
+	// Every statement is a query of its own, followed by the version record
+	conn := &fakeConn{}
+	if err := apply(context.Background(), conn, m, m.Up, true); err != nil {
+		t.Fatalf("Expected err=%v, received=%v", nil, err)
+	}
+	if len(conn.executed) != len(up)+1 || !slices.Equal(conn.executed[:len(up)], up) {
+		t.Errorf("Expected executed=%q and the version record, received=%q", up, conn.executed)
+	}
+}
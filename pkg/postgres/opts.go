@@ -21,3 +21,11 @@ func ConnTimeout(timeout time.Duration) Option {
 		c.connTimeout = timeout
 	}
 }
+
+// TxAttempts bounds how often WithTx runs a transaction failing with a
+// serialization failure or deadlock.
+func TxAttempts(attempts int) Option {
+	return func(c *Postgres) {
+		c.txAttempts = attempts
+	}
+}
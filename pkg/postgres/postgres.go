@@ -16,11 +16,15 @@ const (
 	defaultMaxPoolSize  = 1
 	defaultConnAttempts = 10
 	defaultConnTimeout  = time.Second
+	defaultTxAttempts   = 3
 )
 
 type PgxPool interface {
 	Close()
 	Acquire(ctx context.Context) (*pgxpool.Conn, error)
+	Begin(ctx context.Context) (pgx.Tx, error)
+	BeginTx(ctx context.Context, txOptions pgx.TxOptions) (pgx.Tx, error)
+	CopyFrom(ctx context.Context, tableName pgx.Identifier, columnNames []string, rowSrc pgx.CopyFromSource) (int64, error)
 	Exec(ctx context.Context, sql string, arguments ...any) (pgconn.CommandTag, error)
 	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
 	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
@@ -31,6 +35,7 @@ type Postgres struct {
 	maxPoolSize  int
 	connAttempts int
 	connTimeout  time.Duration
+	txAttempts   int
 
 	Builder squirrel.StatementBuilderType
 	Pool    PgxPool
@@ -42,6 +47,7 @@ func New(url string, opts ...Option) (*Postgres, error) {
 		maxPoolSize:  defaultMaxPoolSize,
 		connAttempts: defaultConnAttempts,
 		connTimeout:  defaultConnTimeout,
+		txAttempts:   defaultTxAttempts,
 	}
 
 	for _, opt := range opts {
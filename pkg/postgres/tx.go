@@ -0,0 +1,115 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// Errors of concurrent transactions which succeed when simply run again
+const (
+	codeSerializationFailure = "40001"
+	codeDeadlockDetected     = "40P01"
+)
+
+// Querier runs statements on the pool or in a transaction.
+type Querier interface {
+	Exec(ctx context.Context, sql string, arguments ...any) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+	CopyFrom(ctx context.Context, tableName pgx.Identifier, columnNames []string, rowSrc pgx.CopyFromSource) (int64, error)
+}
+
+// TxFunc is run by WithTx. The ctx carries the transaction, so repository
+// methods called with it take part in the transaction.
+type TxFunc func(ctx context.Context, tx pgx.Tx) error
+
+type txKey struct{}
+
+// TxFromContext returns the transaction started by WithTx, if any.
+func TxFromContext(ctx context.Context) (pgx.Tx, bool) {
+	tx, ok := ctx.Value(txKey{}).(pgx.Tx)
+	return tx, ok
+}
+
+// Querier returns the transaction of ctx, or the pool outside of one.
+func (p *Postgres) Querier(ctx context.Context) Querier {
+	if tx, ok := TxFromContext(ctx); ok {
+		return tx
+	}
+	return p.Pool
+}
+
+// WithTx runs fn in a transaction with the default options.
+func (p *Postgres) WithTx(ctx context.Context, fn TxFunc) error {
+	return p.WithTxOptions(ctx, pgx.TxOptions{}, fn)
+}
+
+// WithTxOptions runs fn in a transaction, committing if fn succeeds and
+// rolling back otherwise. Serialization failures and deadlocks roll back and
+// run fn again, up to the configured attempts, so fn must not have effects
+// outside the transaction, or must undo them when run again. Inside a
+// transaction of ctx fn joins it, and the outermost WithTx decides about
+// commit and retries.
+func (p *Postgres) WithTxOptions(ctx context.Context, opts pgx.TxOptions, fn TxFunc) error {
+	const op = "postgres.tx.go - WithTx"
+
+	if tx, ok := TxFromContext(ctx); ok {
+		return fn(ctx, tx)
+	}
+
+	attempts := max(p.txAttempts, 1)
+	var err error
+	for attempt := 1; attempt <= attempts; attempt++ {
+		err = p.runTx(ctx, opts, fn)
+		if err == nil || !retryable(err) || attempt == attempts {
+			break
+		}
+
+		select {
+		case <-time.After(retryDelay(attempt)):
+		case <-ctx.Done():
+			return fmt.Errorf("%s - %w", op, errors.Join(err, ctx.Err()))
+		}
+	}
+	return err
+}
+
+func (p *Postgres) runTx(ctx context.Context, opts pgx.TxOptions, fn TxFunc) error {
+	const op = "postgres.tx.go - runTx"
+
+	tx, err := p.Pool.BeginTx(ctx, opts)
+	if err != nil {
+		return fmt.Errorf("%s - Pool.BeginTx: %w", op, err)
+	}
+	// A no-op after Commit
+	defer tx.Rollback(ctx)
+
+	if err := fn(context.WithValue(ctx, txKey{}, tx), tx); err != nil {
+		return err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("%s - tx.Commit: %w", op, err)
+	}
+	return nil
+}
+
+func retryable(err error) bool {
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) {
+		return false
+	}
+	return pgErr.Code == codeSerializationFailure || pgErr.Code == codeDeadlockDetected
+}
+
+// retryDelay spreads the retries of transactions which collided, so they
+// don't collide again.
+func retryDelay(attempt int) time.Duration {
+	base := 10 * time.Millisecond << (attempt - 1)
+	return base/2 + rand.N(base)
+}
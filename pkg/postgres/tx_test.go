@@ -0,0 +1,133 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+type fakeTx struct {
+	pgx.Tx
+	committed  bool
+	rolledBack bool
+}
+
+func (t *fakeTx) Commit(ctx context.Context) error {
+	t.committed = true
+	return nil
+}
+
+func (t *fakeTx) Rollback(ctx context.Context) error {
+	if !t.committed {
+		t.rolledBack = true
+	}
+	return nil
+}
+
+type fakePool struct {
+	PgxPool
+	txs []*fakeTx
+}
+
+func (p *fakePool) BeginTx(ctx context.Context, txOptions pgx.TxOptions) (pgx.Tx, error) {
+	tx := &fakeTx{}
+	p.txs = append(p.txs, tx)
+	return tx, nil
+}
+
+func TestWithTx(t *testing.T) {
+	serializationErr := &pgconn.PgError{Code: codeSerializationFailure}
+	deadlockErr := &pgconn.PgError{Code: codeDeadlockDetected}
+	otherErr := errors.New("boom")
+
+	tests := []struct {
+		name      string
+		failures  []error
+		attempts  int
+		committed bool
+		err       error
+	}{
+		{
+			name:      "Test success",
+			attempts:  1,
+			committed: true,
+		},
+		{
+			name:      "Test serialization failure retried",
+			failures:  []error{serializationErr, deadlockErr},
+			attempts:  3,
+			committed: true,
+		},
+		{
+			name:     "Test retries exhausted",
+			failures: []error{serializationErr, serializationErr, serializationErr},
+			attempts: 3,
+			err:      serializationErr,
+		},
+		{
+			name:     "Test other error not retried",
+			failures: []error{otherErr},
+			attempts: 1,
+			err:      otherErr,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pool := &fakePool{}
+			pg := &Postgres{Pool: pool, txAttempts: 3}
+
+			calls := 0
+			err := pg.WithTx(context.Background(), func(ctx context.Context, tx pgx.Tx) error {
+				if got, ok := TxFromContext(ctx); !ok || got != tx {
+					t.Errorf("Expected tx in context")
+				}
+				calls++
+				if calls <= len(tt.failures) {
+					return tt.failures[calls-1]
+				}
+				return nil
+			})
+
+			if !errors.Is(err, tt.err) {
+				t.Errorf("Expected err=%v, received=%v", tt.err, err)
+			}
+			if len(pool.txs) != tt.attempts {
+				t.Errorf("Expected attempts=%v, received=%v", tt.attempts, len(pool.txs))
+			}
+			last := pool.txs[len(pool.txs)-1]
+			if last.committed != tt.committed {
+				t.Errorf("Expected committed=%v, received=%v", tt.committed, last.committed)
+			}
+			if last.rolledBack == tt.committed {
+				t.Errorf("Expected rolledBack=%v, received=%v", !tt.committed, last.rolledBack)
+			}
+		})
+	}
+}
+
+func TestWithTxNested(t *testing.T) {
+	pool := &fakePool{}
+	pg := &Postgres{Pool: pool, txAttempts: 3}
+
+	err := pg.WithTx(context.Background(), func(ctx context.Context, outer pgx.Tx) error {
+		return pg.WithTx(ctx, func(ctx context.Context, inner pgx.Tx) error {
+			if inner != outer {
+				t.Errorf("Expected the inner call to join the outer transaction")
+			}
+			if pg.Querier(ctx) != outer {
+				t.Errorf("Expected Querier to return the transaction")
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		t.Errorf("Expected err=%v, received=%v", nil, err)
+	}
+	if len(pool.txs) != 1 {
+		t.Errorf("Expected transactions=%v, received=%v", 1, len(pool.txs))
+	}
+}